@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/client"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/seeds"
+)
+
+// batchCommand posts seed lists from files to running server and prints report for each of them
+func batchCommand(args []string) int {
+	flags, server := remoteFlags("batch", "FILE...")
+	format := flags.String("format", "", "format of seed files: json, csv or ndjson; decided by file extension if not set")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	c := client.New(*server)
+	exitCode := 0
+	for _, name := range flags.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open seed file '%s', reason: %s\n", name, err)
+			exitCode = 1
+			continue
+		}
+
+		f := seeds.Format(*format)
+		if f == "" {
+			f = seeds.FormatFor(name)
+		}
+		report, err := c.SubmitBatch(file, f)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to submit seed file '%s', reason: %s\n", name, err)
+			exitCode = 1
+			continue
+		}
+
+		printReport(os.Stdout, name, report)
+		if report.Rejected > 0 {
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// importSeeds submits seeds from local file at startup, failures and report are printed to out
+func importSeeds(name string, submitter seeds.Submitter, out io.Writer) {
+	file, err := os.Open(name)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to open seed file '%s', reason: %s\n", name, err)
+		log.WithFields(logrus.Fields{
+			"file": name,
+			"err":  err.Error(),
+		}).Error("Failed to open seed file")
+		return
+	}
+	defer file.Close()
+
+	rows, err := seeds.Parse(file, seeds.FormatFor(name))
+	if err != nil {
+		fmt.Fprintf(out, "Failed to read seed file '%s', reason: %s\n", name, err)
+		log.WithFields(logrus.Fields{
+			"file": name,
+			"err":  err.Error(),
+		}).Error("Failed to read seed file")
+		return
+	}
+
+	report := seeds.Submit(rows, submitter)
+	printReport(out, name, report)
+	log.WithFields(logrus.Fields{
+		"file":     name,
+		"accepted": report.Accepted,
+		"rejected": report.Rejected,
+	}).Info("Imported seed file")
+}
+
+// printReport prints rejected rows and summary of seed list submission to out
+func printReport(out io.Writer, name string, report seeds.Report) {
+	for _, result := range report.Results {
+		if result.Status == seeds.Rejected {
+			b, _ := json.Marshal(result)
+			fmt.Fprintln(out, string(b))
+		}
+	}
+	fmt.Fprintf(out, "Seed file '%s': %v accepted, %v rejected\n", name, report.Accepted, report.Rejected)
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/seeds"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// Client calls youtubeCrawler HTTP API
+type Client struct {
+	BaseURL    string // server address, e.g. `http://localhost:8080`
+	HTTPClient *http.Client
+}
+
+// New returns *Client for server at addr, `http://` is prepended if addr has no scheme
+func New(addr string) *Client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(addr, "/"),
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// SubmitBatch posts seed list to the server, format is detected by server if empty
+func (c *Client) SubmitBatch(seedList io.Reader, format seeds.Format) (seeds.Report, error) {
+	var report seeds.Report
+	uri := c.BaseURL + "/api/v1/jobs:batch"
+	if format != "" {
+		uri += "?format=" + url.QueryEscape(string(format))
+	}
+
+	res, err := c.HTTPClient.Post(uri, "", seedList)
+	if err != nil {
+		return report, err
+	}
+	defer res.Body.Close()
+
+	if err = checkResponse(res, http.StatusOK); err != nil {
+		return report, err
+	}
+	err = json.NewDecoder(res.Body).Decode(&report)
+	return report, err
+}
+
+// Submit creates new job from seed
+func (c *Client) Submit(seed models.Seed) (models.Job, error) {
+	var job models.Job
+	body, err := json.Marshal(seed)
+	if err != nil {
+		return job, err
+	}
+	err = c.do("POST", "/api/v1/jobs", bytes.NewReader(body), http.StatusCreated, &job)
+	return job, err
+}
+
+// Job returns job by its ID
+func (c *Client) Job(id string) (models.Job, error) {
+	var job models.Job
+	err := c.do("GET", "/api/v1/jobs/"+url.PathEscape(id), nil, http.StatusOK, &job)
+	return job, err
+}
+
+// Jobs returns all jobs known to the server
+func (c *Client) Jobs() ([]models.Job, error) {
+	var jobs []models.Job
+	err := c.do("GET", "/api/v1/jobs", nil, http.StatusOK, &jobs)
+	return jobs, err
+}
+
+// Cancel cancels job by its ID
+func (c *Client) Cancel(id string) (models.Job, error) {
+	var job models.Job
+	err := c.do("POST", "/api/v1/jobs/"+url.PathEscape(id)+"/cancel", nil, http.StatusOK, &job)
+	return job, err
+}
+
+// ReplayDeadLetters stores links from dead-letter file of the server to its store again
+func (c *Client) ReplayDeadLetters() (store.ReplayResult, error) {
+	var result store.ReplayResult
+	err := c.do("POST", "/api/v1/store/dead-letters/replay", nil, http.StatusOK, &result)
+	return result, err
+}
+
+// do sends request to the API and decodes JSON response to v if response status is the expected one
+func (c *Client) do(method, path string, body io.Reader, want int, v interface{}) error {
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err = checkResponse(res, want); err != nil {
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// checkResponse returns error with response body if response status isn't the expected one
+func checkResponse(res *http.Response, want int) error {
+	if res.StatusCode == want {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	return fmt.Errorf("server responded %s: %s", res.Status, strings.TrimSpace(string(body)))
+}
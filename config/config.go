@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const defaultNoOfGoroutines = 5
@@ -13,26 +16,138 @@ const defaultDbPwd = ""
 const defaultDbURL = "127.0.0.1:3306"
 const defaultDbName = ""
 const defaultFilePath = "defaultFile.dat"
+const defaultTablePrefix = ""
+const defaultBackend = "sqlite"
+const defaultFallback = ""
+const defaultDestinations = ""
+const defaultDeadLetterPath = "dead-letters.jsonl"
+const defaultWebhookURL = ""
+const defaultWebhookSecret = ""
+const defaultMQURL = "nats://127.0.0.1:4222"
+const defaultMQSubject = "youtube.videos"
+const defaultMQStream = "YOUTUBE_VIDEOS"
+const defaultMQBufferPath = "mq-buffer.jsonl"
+const defaultMQRetryEvery = 5 * time.Second
+const defaultBatchSize = 100
+const defaultFlushInterval = time.Second
+const defaultJSONLPath = "links.jsonl"
+const defaultCSVPath = "links.csv"
+const defaultJSONLCompression = ""
+const defaultJSONLSync = "1s"
+const defaultJSONLMaxSizeMB = 0
+const defaultJSONLRotateEvery = 0
+const defaultSQLitePath = "crawler.db"
+const defaultDbSSLMode = "disable"
+const defaultAutoMigrate = true
+const defaultSeedFile = ""
+const defaultBaseURL = "https://www.youtube.com"
+const defaultRateLimit = 0.0
+const defaultFrontierPath = "frontier.db"
+const defaultAddr = ":8080"
+const defaultServerURL = "http://localhost:8080"
+const defaultWebhooksFile = ""
+const defaultWebhookAttempts = 5
+const defaultS3Endpoint = ""
+const defaultS3Bucket = "youtube-crawler"
+const defaultS3Region = "us-east-1"
+const defaultS3AccessKey = ""
+const defaultS3SecretKey = ""
+const defaultS3Secure = false
+const defaultS3Prefix = ""
+const defaultS3SpoolDir = "spool"
+const defaultS3PartSizeMB = 16
+const defaultS3Attempts = 3
+const defaultS3RetryEvery = 30 * time.Second
+const defaultS3Pages = true
+const defaultS3ExportEvery = time.Hour
+const defaultS3ExportFormat = "parquet"
 
 //Config main config struct
 type Config struct {
 	CrawlerConfig CrawlerConfig
 	StoreConfig   StoreConfig
+	ServerConfig  ServerConfig
+	WebhookConfig WebhookConfig
+	S3Config      S3Config
+}
+
+// S3Config bucket raw pages and exports of ended jobs are uploaded to, e.g. local MinIO
+type S3Config struct {
+	Endpoint     string // host:port of S3 API, uploads are disabled if empty
+	Bucket       string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	Secure       bool          // use HTTPS
+	Prefix       string        // prepended to key of every object
+	SpoolDir     string        // objects are kept here until they are uploaded
+	PartSizeMB   int           // objects bigger than this are uploaded by multipart upload
+	Attempts     int           // number of attempts to upload object before it's left in spool for later
+	RetryEvery   time.Duration // how often objects left in spool are uploaded again
+	Pages        bool          // upload raw HTML of every fetched page
+	ExportEvery  time.Duration // how often jobs that ended meanwhile are exported, 0 disables exports
+	ExportFormat string        // format of exported datasets, csv or parquet
+}
+
+// WebhookConfig webhooks fired on job events
+type WebhookConfig struct {
+	File        string // JSON file with list of webhooks, webhooks are disabled if empty
+	MaxAttempts int    // number of attempts to deliver single event
+}
+
+// ServerConfig HTTP server settings, URL is used by command line client to reach the server
+type ServerConfig struct {
+	Addr string
+	URL  string
 }
 
 //CrawlerConfig crawler config struct
 type CrawlerConfig struct {
 	NumOfGoroutines int
 	NumOfCrawls     int
+	SeedFile        string  // file with seeds in JSON, CSV or NDJSON format to submit at startup
+	BaseURL         string  // URL of the site links are crawled from
+	RateLimit       float64 // max number of requests per second of all crawling threads, 0 for no limit
+	FrontierPath    string  // file jobs and their pending links are kept in to resume them after restart, empty disables it
 }
 
 //StoreConfig configuration for data storing, db connection settings, file path
 type StoreConfig struct {
-	DbUser   string
-	DbPwd    string
-	DbURL    string
-	DbName   string
-	FilePath string
+	Backend     string   // name of registered backend to store data to, e.g. sqlite, mysql, postgres or file
+	Fallback    []string // backends tried in order if Backend fails to open, none by default
+	DbUser      string
+	DbPwd       string
+	DbURL       string
+	DbName      string
+	DbSSLMode   string // sslmode of PostgreSQL connection
+	SQLitePath  string // SQLite DB file
+	TablePrefix string // prefix of all table names, e.g. `crawler_`
+	AutoMigrate bool   // apply DB migrations on startup
+	FilePath    string
+
+	BatchSize      int           // number of links stored at once by stores supporting batches, 1 stores links one by one
+	FlushInterval  time.Duration // max time link waits for batch to fill before it's stored
+	DeadLetterPath string        // links that fail to store are written here, empty stops the application on failure
+
+	JSONLPath        string        // JSON Lines file, rotated files are kept next to it
+	JSONLCompression string        // none, gzip or zstd
+	JSONLSync        string        // fsync policy: never, always or interval like 1s
+	JSONLMaxSizeMB   int           // rotate file once it has this many MB, 0 disables size rotation
+	JSONLRotateEvery time.Duration // rotate file once it's open this long, 0 disables time rotation
+
+	CSVPath string // CSV file the csv backend appends links to
+
+	Destinations  []string // backends every record is written to besides Backend as `name[:required|best-effort]`
+	WebhookURL    string   // URL webhook backend posts links to
+	WebhookSecret string   // secret signing posted links, unsigned if empty
+
+	MQURL        string        // NATS server the nats backend publishes links to
+	MQSubject    string        // links are published to subject `MQSubject.<video ID>`
+	MQStream     string        // JetStream stream of MQSubject, created if missing
+	MQBufferPath string        // links are kept here while NATS is down, empty fails links instead
+	MQRetryEvery time.Duration // how often buffered links are published again
+
+	Out io.Writer // messages about opening the store are printed here, os.Stdout if nil, it isn't read from environment
 }
 
 // New returns pointer to new config struct
@@ -41,40 +156,162 @@ func New() *Config {
 		CrawlerConfig: CrawlerConfig{
 			NumOfGoroutines: getEnvAsInt("GOROUTINES", defaultNoOfGoroutines),
 			NumOfCrawls:     getEnvAsInt("NUMOFCRAWLS", defaultNoOfCrawlsPerLink),
+			SeedFile:        getEnv("SEEDFILE", defaultSeedFile),
+			BaseURL:         getEnv("BASEURL", defaultBaseURL),
+			RateLimit:       getEnvAsFloat("RATELIMIT", defaultRateLimit),
+			FrontierPath:    getEnv("FRONTIER", defaultFrontierPath),
 		},
 		StoreConfig: StoreConfig{
-			DbUser:   getEnv("DBUSER", defaultDbUser),
-			DbPwd:    getEnv("DBPWD", defaultDbPwd),
-			DbURL:    getEnv("DBURL", defaultDbURL),
-			DbName:   getEnv("DBNAME", defaultDbName),
-			FilePath: getEnv("FILESTORE", defaultFilePath),
+			Backend:     getEnv("STORE_BACKEND", lookupEnv("DBDRIVER", defaultBackend)),
+			Fallback:    getEnvAsList("STORE_FALLBACK", defaultFallback),
+			DbUser:      getEnv("DBUSER", defaultDbUser),
+			DbPwd:       getEnv("DBPWD", defaultDbPwd),
+			DbURL:       getEnv("DBURL", defaultDbURL),
+			DbName:      getEnv("DBNAME", defaultDbName),
+			DbSSLMode:   getEnv("DBSSLMODE", defaultDbSSLMode),
+			SQLitePath:  getEnv("SQLITEPATH", defaultSQLitePath),
+			TablePrefix: getEnv("DBTABLEPREFIX", defaultTablePrefix),
+			AutoMigrate: getEnvAsBool("DBAUTOMIGRATE", defaultAutoMigrate),
+			FilePath:    getEnv("FILESTORE", defaultFilePath),
+
+			BatchSize:      getEnvAsInt("STORE_BATCH_SIZE", defaultBatchSize),
+			FlushInterval:  getEnvAsDuration("STORE_FLUSH_INTERVAL", defaultFlushInterval),
+			DeadLetterPath: getEnv("STORE_DEAD_LETTERS", defaultDeadLetterPath),
+
+			JSONLPath:        getEnv("JSONL_PATH", defaultJSONLPath),
+			JSONLCompression: getEnv("JSONL_COMPRESSION", defaultJSONLCompression),
+			JSONLSync:        getEnv("JSONL_SYNC", defaultJSONLSync),
+			JSONLMaxSizeMB:   getEnvAsInt("JSONL_MAX_SIZE_MB", defaultJSONLMaxSizeMB),
+			JSONLRotateEvery: getEnvAsDuration("JSONL_ROTATE_EVERY", defaultJSONLRotateEvery),
+			CSVPath:          getEnv("CSV_PATH", defaultCSVPath),
+
+			Destinations:  getEnvAsList("STORE_DESTINATIONS", defaultDestinations),
+			WebhookURL:    getEnv("STORE_WEBHOOK_URL", defaultWebhookURL),
+			WebhookSecret: getEnv("STORE_WEBHOOK_SECRET", defaultWebhookSecret),
+
+			MQURL:        getEnv("STORE_MQ_URL", defaultMQURL),
+			MQSubject:    getEnv("STORE_MQ_SUBJECT", defaultMQSubject),
+			MQStream:     getEnv("STORE_MQ_STREAM", defaultMQStream),
+			MQBufferPath: getEnv("STORE_MQ_BUFFER", defaultMQBufferPath),
+			MQRetryEvery: getEnvAsDuration("STORE_MQ_RETRY_EVERY", defaultMQRetryEvery),
+		},
+		ServerConfig: ServerConfig{
+			Addr: getEnv("ADDR", defaultAddr),
+			URL:  getEnv("SERVERURL", defaultServerURL),
+		},
+		WebhookConfig: WebhookConfig{
+			File:        getEnv("WEBHOOKS", defaultWebhooksFile),
+			MaxAttempts: getEnvAsInt("WEBHOOKATTEMPTS", defaultWebhookAttempts),
+		},
+		S3Config: S3Config{
+			Endpoint:     getEnv("S3_ENDPOINT", defaultS3Endpoint),
+			Bucket:       getEnv("S3_BUCKET", defaultS3Bucket),
+			Region:       getEnv("S3_REGION", defaultS3Region),
+			AccessKey:    getEnv("S3_ACCESS_KEY", defaultS3AccessKey),
+			SecretKey:    getEnv("S3_SECRET_KEY", defaultS3SecretKey),
+			Secure:       getEnvAsBool("S3_SECURE", defaultS3Secure),
+			Prefix:       getEnv("S3_PREFIX", defaultS3Prefix),
+			SpoolDir:     getEnv("S3_SPOOL_DIR", defaultS3SpoolDir),
+			PartSizeMB:   getEnvAsInt("S3_PART_SIZE_MB", defaultS3PartSizeMB),
+			Attempts:     getEnvAsInt("S3_ATTEMPTS", defaultS3Attempts),
+			RetryEvery:   getEnvAsDuration("S3_RETRY_EVERY", defaultS3RetryEvery),
+			Pages:        getEnvAsBool("S3_PAGES", defaultS3Pages),
+			ExportEvery:  getEnvAsDuration("S3_EXPORT_EVERY", defaultS3ExportEvery),
+			ExportFormat: getEnv("S3_EXPORT_FORMAT", defaultS3ExportFormat),
 		},
 	}
 }
 
 // looks up environment by name, returns default value if not found
+// messages go to stderr, so they don't mix with records commands write to stdout
 func getEnv(envName string, defaultValue string) string {
 	value, exists := os.LookupEnv(envName)
 	if !exists {
-		fmt.Printf("Didn't find env '%s'. Setting default value '%v'\n", envName, defaultValue)
+		fmt.Fprintf(os.Stderr, "Didn't find env '%s'. Setting default value '%v'\n", envName, defaultValue)
 		return defaultValue
 	}
 	return value
 }
 
+// looks up environment by name without reporting it's missing, used for deprecated names of settings
+func lookupEnv(envName string, defaultValue string) string {
+	if value, exists := os.LookupEnv(envName); exists {
+		return value
+	}
+	return defaultValue
+}
+
 // looks up environment by name and converts it to string, if not found returns default value
 func getEnvAsInt(envName string, defaultValue int) int {
-	value := getEnv(envName, "")
+	value := getEnv(envName, strconv.Itoa(defaultValue))
 	if value == "" {
-		fmt.Printf("Env \"%s\" not found. Setting default value '%v\n'", envName, defaultValue)
 		return defaultValue
 	}
 
 	n, err := strconv.Atoi(value)
 	if err != nil {
-		fmt.Printf("Failed to convert env \"%s\" value '%v' to int. Setting default value '%v'\n", envName, value, defaultValue)
+		fmt.Fprintf(os.Stderr, "Failed to convert env \"%s\" value '%v' to int. Setting default value '%v'\n", envName, value, defaultValue)
+		return defaultValue
+	}
+
+	return n
+}
+
+// looks up environment by name and converts it to float, if not found returns default value
+func getEnvAsFloat(envName string, defaultValue float64) float64 {
+	value := getEnv(envName, strconv.FormatFloat(defaultValue, 'g', -1, 64))
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to convert env \"%s\" value '%v' to float. Setting default value '%v'\n", envName, value, defaultValue)
 		return defaultValue
 	}
 
 	return n
 }
+
+// looks up environment by name and converts it to bool, if not found returns default value
+func getEnvAsBool(envName string, defaultValue bool) bool {
+	value := getEnv(envName, strconv.FormatBool(defaultValue))
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to convert env \"%s\" value '%v' to bool. Setting default value '%v'\n", envName, value, defaultValue)
+		return defaultValue
+	}
+
+	return b
+}
+
+// looks up environment by name and parses it as duration, e.g. 1h30m, if not found returns default value
+func getEnvAsDuration(envName string, defaultValue time.Duration) time.Duration {
+	value := getEnv(envName, defaultValue.String())
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to convert env \"%s\" value '%v' to duration. Setting default value '%v'\n", envName, value, defaultValue)
+		return defaultValue
+	}
+
+	return d
+}
+
+// looks up environment by name and splits it by commas, empty items are dropped
+func getEnvAsList(envName string, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(envName, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
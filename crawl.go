@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/parsers"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// stringList is flag value that can be set multiple times
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// crawlCommand crawls from given seeds without starting HTTP server and returns once all jobs end
+// records are written to stdout unless output file or configured store is chosen,
+// all other messages go to stderr so output can be piped, returns 1 if any job failed
+func crawlCommand(args []string) int {
+	var out io.Writer = os.Stdout
+	conf := config.New()
+	conf.StoreConfig.Out = os.Stderr
+	var seedLinks stringList
+	flags := flag.NewFlagSet("crawl", flag.ExitOnError)
+	flags.Var(&seedLinks, "seed", "link or ID of video to start crawling from, can be repeated")
+	seedFile := flags.String("seeds", conf.CrawlerConfig.SeedFile, "seed file in JSON, CSV or NDJSON format")
+	flags.IntVar(&conf.CrawlerConfig.NumOfCrawls, "iterations", conf.CrawlerConfig.NumOfCrawls, "number of links to crawl from each seed")
+	flags.IntVar(&conf.CrawlerConfig.NumOfGoroutines, "goroutines", conf.CrawlerConfig.NumOfGoroutines, "number of crawling threads")
+	flags.StringVar(&conf.CrawlerConfig.BaseURL, "base-url", conf.CrawlerConfig.BaseURL, "URL of the site to crawl")
+	output := flags.String("output", "-", "file to write records to, '-' for stdout")
+	format := flags.String("format", store.FormatJSONL, "format of written records: jsonl or text")
+	useStore := flags.Bool("store", false, "store records to configured store instead of output")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s crawl [flags] [LINK...]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	seedLinks = append(seedLinks, flags.Args()...)
+
+	if len(seedLinks) == 0 && *seedFile == "" {
+		flags.Usage()
+		return 2
+	}
+
+	var storeManager *store.Manager
+	if *useStore {
+		var err error
+		if storeManager, err = store.New(conf.StoreConfig, log); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open store, reason: %s\n", err)
+			return 1
+		}
+	} else {
+		if *output != "-" {
+			file, err := os.Create(*output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to create output file '%s', reason: %s\n", *output, err)
+				return 1
+			}
+			out = file
+		}
+		destination, err := store.NewWriterStore(out, *format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 2
+		}
+		storeManager = store.NewManager(destination, log)
+		storeManager.Out = os.Stderr
+	}
+
+	monster := crawler.New(storeManager, conf.CrawlerConfig, parsers.YoutubeParser{Log: log}, os.Stderr, log)
+	if jobs := storeManager.TrackJobs(monster.Events); jobs != nil {
+		defer jobs.Close()
+	}
+	// no end of job can be missed, otherwise waitForJobs would wait for it forever
+	ended := monster.Events.SubscribeUnbounded(events.JobEnded...)
+	defer ended.Close()
+	go monster.Run()
+
+	for _, link := range seedLinks {
+		if _, err := monster.Submit(models.Seed{Link: link}); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid seed: %s\n", err)
+		}
+	}
+	if *seedFile != "" {
+		importSeeds(*seedFile, monster, os.Stderr)
+	}
+
+	stop := make(chan os.Signal, 1)
+	go catchSignal(stop)
+	interrupted := !waitForJobs(monster, ended, stop)
+
+	monster.Stop()
+	<-storeManager.Shutdown
+
+	failed := 0
+	for _, job := range monster.Jobs() {
+		if job.Status == models.JobFailed {
+			fmt.Fprintf(os.Stderr, "Job [ID: %v] from '%s' failed after %v videos, reason: %s\n", job.ID, job.Seed.Link, job.Visited, job.Error)
+			failed++
+		}
+	}
+	if interrupted || failed > 0 || len(monster.Jobs()) == 0 {
+		return 1
+	}
+	return 0
+}
+
+// waitForJobs blocks until there is no queued or running job or until stop signal is received
+// returns false if it was stopped by signal
+func waitForJobs(c *crawler.Crawler, ended *events.Subscription, stop chan os.Signal) bool {
+	for c.Pending() > 0 {
+		select {
+		case <-stop:
+			return false
+		case e := <-ended.C:
+			fmt.Fprintf(os.Stderr, "Job [ID: %v] ended with status '%v' after %v videos\n", e.JobID, e.Job.Status, e.Job.Visited)
+			log.WithFields(logrus.Fields{
+				"jobID":   e.JobID,
+				"status":  e.Job.Status,
+				"visited": e.Job.Visited,
+			}).Info("Job ended")
+		}
+	}
+	return true
+}
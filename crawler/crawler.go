@@ -1,9 +1,11 @@
 package crawler
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
@@ -12,6 +14,8 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/frontier"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/parsers"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
@@ -40,12 +44,22 @@ type Crawler struct {
 	parser        parsers.DataParser
 	printTarget   io.Writer //used to set output for message printing (not logging)
 	log           *logrus.Logger
+	jobs          jobRegistry        // jobs submitted by Submit
+	Events        *events.Bus        // job lifecycle and visited video events
+	limiter       rateLimiter        // limits rate of requests, see SetRate
+	Pages         PageArchiver       // keeps raw HTML of fetched pages, nil if pages aren't kept
+	Frontier      *frontier.Frontier // keeps jobs and links they continue with for Restore, nil if jobs aren't kept
+}
+
+// PageArchiver keeps raw HTML of video pages, it's called by crawling threads so it shouldn't block on network
+type PageArchiver interface {
+	ArchivePage(link models.NextLink, fetchedAt time.Time, page []byte)
 }
 
 // New returns *Crawler
 func New(storeManager *store.Manager, config config.CrawlerConfig, parser parsers.DataParser, output io.Writer, log *logrus.Logger) *Crawler {
 
-	return &Crawler{
+	c := &Crawler{
 		data:          make(chan models.NextLink, 500),
 		wg:            sync.WaitGroup{},
 		stopSignal:    make(chan bool, config.NumOfGoroutines),
@@ -54,7 +68,10 @@ func New(storeManager *store.Manager, config config.CrawlerConfig, parser parser
 		parser:        parser,
 		printTarget:   output,
 		log:           log,
+		Events:        events.NewBus(),
 	}
+	c.SetRate(config.RateLimit)
+	return c
 }
 
 // GetHTTPRequest returns *Request to do Do method with
@@ -69,6 +86,7 @@ func (c *Crawler) getHTTPRequest(method, uri string) (*http.Request, error) {
 }
 
 // getResponse does GET request to specified URI
+// if response status isn't 200 OK, response is returned with closed body together with error
 func (c *Crawler) getResponse(httpMethod, baseURL, urlSuffix string, customHTTPClient *http.Client) (res *http.Response, err error) {
 	uri := baseURL + urlSuffix
 	req, err := c.getHTTPRequest(httpMethod, uri)
@@ -113,7 +131,8 @@ func (c *Crawler) getResponse(httpMethod, baseURL, urlSuffix string, customHTTPC
 			"requestURI":     req.URL.String(),
 			"responseStatus": res.Status,
 		}).Warn("ResponseCode <> 200 OK")
-		return nil, errors.New("Failed to get response 200 OK, received " + res.Status)
+		res.Body.Close()
+		return res, errors.New("Failed to get response 200 OK, received " + res.Status)
 	}
 
 	return res, nil
@@ -127,8 +146,6 @@ func (c *Crawler) getResponse(httpMethod, baseURL, urlSuffix string, customHTTPC
 // makes new NextLink struct and sends it to Crawler.Data chan to keep crawling
 // if receives stopSignal, crawling for that given thread stops
 func (c *Crawler) crawl(id int) {
-	var title string
-	var urlSuffix string
 	for {
 		select {
 		case nextLink := <-c.data:
@@ -149,21 +166,55 @@ func (c *Crawler) crawl(id int) {
 					"nextLinkNumber":        nextLink.Number,
 					"nextLinkNofIterations": nextLink.NOfIterations,
 				}).Debug("Finished crawling")
+				c.finishJob(nextLink.JobID, nil)
+				break
+			}
+
+			nextLink.VisitedAt = time.Now()
+			if status := c.visit(nextLink); status != models.JobRunning {
+				fmt.Fprintf(c.printTarget, "Stopped crawling for [ID: %v] of job [jobID: %v] with status '%v' on thread ID-%v\n", nextLink.ID, nextLink.JobID, status, id)
+				c.log.WithFields(logrus.Fields{
+					"threadID":   id,
+					"nextLinkID": nextLink.ID,
+					"jobID":      nextLink.JobID,
+					"status":     status,
+				}).Debug("Dropped link of ended job")
 				break
 			}
 
 			c.StoreManager.StorePipe <- nextLink
 
+			c.limiter.wait()
+			attempt := models.FetchAttempt{JobID: nextLink.JobID, VideoID: nextLink.ID, URL: nextLink.BaseURL + nextLink.Link, Time: time.Now()}
 			res, err := c.getResponse("GET", nextLink.BaseURL, nextLink.Link, myClient)
+			attempt.Duration = time.Since(attempt.Time)
+			if res != nil {
+				attempt.StatusCode = res.StatusCode
+			}
+			if err != nil {
+				attempt.Error = err.Error()
+			}
+			c.StoreManager.StoreAttempt(attempt)
 
 			if err != nil {
+				fmt.Fprintf(c.printTarget, "Failed to get response for [ID: %v], reason: %s\n", nextLink.ID, err)
 				c.log.WithFields(logrus.Fields{
-					"err": err.Error(),
-				}).Fatal("Failed to get correct response")
+					"err":    err.Error(),
+					"linkID": nextLink.ID,
+				}).Error("Failed to get correct response")
+				c.Events.Publish(events.Event{Type: events.Error, JobID: nextLink.JobID, Link: &nextLink, Error: err.Error()})
+				c.finishJob(nextLink.JobID, err)
+				break
 			}
 
-			title, urlSuffix, err = c.parser.ParseData(res)
+			if c.Pages != nil {
+				c.archive(res, nextLink, attempt.Time)
+			}
+			next, video, err := c.parseNext(res)
 			res.Body.Close()
+			if video != nil {
+				c.StoreManager.StoreObservation(observation(nextLink, *video, attempt.Time))
+			}
 
 			if err != nil {
 				fmt.Fprintf(c.printTarget, "Failed parseNextVideoData, reason: %s\n", err)
@@ -173,10 +224,14 @@ func (c *Crawler) crawl(id int) {
 					"err":    err.Error(),
 					"linkID": nextLink.ID,
 				}).Error("Failed to parseData from response")
+				c.Events.Publish(events.Event{Type: events.Error, JobID: nextLink.JobID, Link: &nextLink, Error: err.Error()})
+				c.finishJob(nextLink.JobID, err)
 				break
 			}
 
-			c.data <- models.NextLink{ID: nextLink.ID, NOfIterations: nextLink.NOfIterations, Title: title, Link: urlSuffix, Number: nextLink.Number + 1, BaseURL: nextLink.BaseURL}
+			link := models.NextLink{ID: models.ParseVideoID(next.Link), JobID: nextLink.JobID, ParentID: nextLink.ID, Channel: next.Channel, NOfIterations: nextLink.NOfIterations, Title: next.Title, Link: next.Link, Number: nextLink.Number + 1, BaseURL: nextLink.BaseURL}
+			c.advance(link)
+			c.data <- link
 
 		case <-c.stopSignal:
 			c.wg.Done()
@@ -185,9 +240,55 @@ func (c *Crawler) crawl(id int) {
 				"threadID": id,
 			}).Trace("Thread received stop signal and stopped")
 			return
-		default:
+		}
+	}
+}
 
+// archive reads body of response and passes it to Pages, body is replaced by the read copy so it can be parsed
+// body that fails to be read isn't archived, parser gets the part that was read
+func (c *Crawler) archive(res *http.Response, link models.NextLink, fetchedAt time.Time) {
+	page, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(page))
+	if err != nil {
+		c.log.WithFields(logrus.Fields{
+			"err":    err.Error(),
+			"linkID": link.ID,
+		}).Warn("Failed to read page to archive")
+		return
+	}
+	c.Pages.ArchivePage(link, fetchedAt, page)
+}
+
+// parseNext parses next video from response, channel is set only if parser implements parsers.RelatedParser
+// metadata of fetched video is returned only by parsers.PageParser, it's nil if page has none
+func (c *Crawler) parseNext(res *http.Response) (parsers.RelatedVideo, *parsers.Metadata, error) {
+	if p, ok := c.parser.(parsers.PageParser); ok {
+		page, err := p.ParsePage(res)
+		video := &page.Video
+		if video.Title == "" && video.Channel == "" && video.Views == nil && video.Likes == nil {
+			video = nil
 		}
+		return page.Next, video, err
+	}
+	if p, ok := c.parser.(parsers.RelatedParser); ok {
+		related, err := p.ParseRelated(res)
+		return related, nil, err
+	}
+	title, link, err := c.parser.ParseData(res)
+	return parsers.RelatedVideo{Title: title, Link: link}, nil, err
+}
+
+// observation returns metadata of visited link seen on its page at given time
+func observation(link models.NextLink, video parsers.Metadata, at time.Time) models.Observation {
+	return models.Observation{
+		VideoID:    link.ID,
+		JobID:      link.JobID,
+		ObservedAt: at,
+		Title:      video.Title,
+		Channel:    video.Channel,
+		Views:      video.Views,
+		Likes:      video.Likes,
 	}
 }
 
@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -12,7 +14,10 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/frontier"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/parsers"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
 )
 
@@ -23,6 +28,24 @@ func (cp countParser) ParseData(response *http.Response) (link, title string, er
 	return "", "", nil
 }
 
+// sequenceParser returns new video link on every call
+type sequenceParser struct {
+	counter *int32
+}
+
+func (sp sequenceParser) ParseData(response *http.Response) (title, link string, err error) {
+	n := atomic.AddInt32(sp.counter, 1)
+	return "title", fmt.Sprintf("/watch?v=%011d", n), nil
+}
+
+// loopParser returns always the same video link
+type loopParser struct {
+}
+
+func (lp loopParser) ParseData(response *http.Response) (title, link string, err error) {
+	return "title", "/watch?v=KR-eV7fHNbM", nil
+}
+
 type fakeStore struct {
 	data    []models.NextLink
 	counter *int32
@@ -312,6 +335,214 @@ func TestRun(t *testing.T) {
 	})
 }
 
+func TestJobs(t *testing.T) {
+	tests := []struct {
+		name        string
+		parser      parsers.DataParser
+		status      int
+		wantStatus  models.JobStatus
+		wantEvent   events.Type
+		wantVisited int
+	}{
+		{"Completed", sequenceParser{counter: new(int32)}, http.StatusOK, models.JobCompleted, events.JobCompleted, 6},
+		{"Loop detected", loopParser{}, http.StatusOK, models.JobLoopDetected, events.JobLoopDetected, 2},
+		{"Failed", loopParser{}, http.StatusInternalServerError, models.JobFailed, events.JobFailed, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := makeHTTPServer(tt.status)
+			defer server.Close()
+
+			log := logrus.New()
+			log.Out = ioutil.Discard
+			testStoreManager := store.NewManager(fakeStore{counter: new(int32)}, log)
+			conf := config.CrawlerConfig{
+				NumOfGoroutines: 2,
+				NumOfCrawls:     5,
+				BaseURL:         server.URL,
+			}
+			c := New(testStoreManager, conf, tt.parser, ioutil.Discard, log)
+			ended := c.Events.Subscribe(10, events.JobEnded...)
+			defer ended.Close()
+
+			go c.Run()
+			defer c.Stop()
+			job, err := c.Submit(models.Seed{Link: "DT61L8hbbJ4"})
+			if err != nil {
+				t.Fatalf("Failed to submit seed; reason: %s", err)
+			}
+
+			select {
+			case e := <-ended.C:
+				if e.Type != tt.wantEvent || e.JobID != job.ID {
+					t.Errorf("Got event %v of job %v, want %v of job %v", e.Type, e.JobID, tt.wantEvent, job.ID)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Job didn't end")
+			}
+
+			got, _ := c.Job(job.ID)
+			if got.Status != tt.wantStatus {
+				t.Errorf("Got status '%v', want '%v'", got.Status, tt.wantStatus)
+			}
+			assertCountEquals(t, int32(tt.wantVisited), int32(got.Visited))
+			assertCountEquals(t, 0, int32(c.Pending()))
+		})
+	}
+
+	t.Run("Pause and resume running job", func(t *testing.T) {
+		server := makeHTTPServer(http.StatusOK)
+		defer server.Close()
+
+		log := logrus.New()
+		log.Out = ioutil.Discard
+		conf := config.CrawlerConfig{NumOfGoroutines: 2, NumOfCrawls: 20, BaseURL: server.URL, RateLimit: 100}
+		c := New(store.NewManager(fakeStore{counter: new(int32)}, log), conf, sequenceParser{counter: new(int32)}, ioutil.Discard, log)
+		completed := c.Events.Subscribe(1, events.JobCompleted)
+		defer completed.Close()
+
+		go c.Run()
+		defer c.Stop()
+		job, _ := c.Submit(models.Seed{Link: "DT61L8hbbJ4"})
+		time.Sleep(50 * time.Millisecond)
+		if _, err := c.Pause(job.ID); err != nil {
+			t.Fatalf("Failed to pause job; reason: %s", err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		paused, _ := c.Job(job.ID)
+		time.Sleep(100 * time.Millisecond)
+		stillPaused, _ := c.Job(job.ID)
+		if paused.Visited != stillPaused.Visited || paused.Visited >= 21 {
+			t.Fatalf("Job kept crawling while paused, visited %v then %v", paused.Visited, stillPaused.Visited)
+		}
+
+		if _, err := c.Resume(job.ID); err != nil {
+			t.Fatalf("Failed to resume job; reason: %s", err)
+		}
+		select {
+		case <-completed.C:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Job didn't complete after resume")
+		}
+		got, _ := c.Job(job.ID)
+		assertCountEquals(t, 21, int32(got.Visited))
+	})
+
+	t.Run("Cancel queued job", func(t *testing.T) {
+		c := Crawler{data: make(chan models.NextLink, 1), log: logrus.New(), Events: events.NewBus()}
+		c.log.Out = ioutil.Discard
+		cancelled := c.Events.Subscribe(1, events.JobCancelled)
+		defer cancelled.Close()
+
+		c.Submit(models.Seed{Link: "DT61L8hbbJ4", NOfIterations: 1})
+		queued, _ := c.Submit(models.Seed{Link: "Q3oItpVa9fs", NOfIterations: 1})
+		if queued.Status != models.JobQueued {
+			t.Fatalf("Got status '%v', want '%v'", queued.Status, models.JobQueued)
+		}
+
+		if _, err := c.Cancel(queued.ID); err != nil {
+			t.Fatalf("Failed to cancel job; reason: %s", err)
+		}
+		if _, err := c.Cancel(queued.ID); err != ErrJobEnded {
+			t.Errorf("Got error '%v', want '%v'", err, ErrJobEnded)
+		}
+		assertCountEquals(t, 1, int32(len(cancelled.C)))
+		assertCountEquals(t, 1, int32(c.Pending()))
+	})
+}
+
+func TestRestore(t *testing.T) {
+	server := makeHTTPServer(http.StatusOK)
+	defer server.Close()
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	conf := config.CrawlerConfig{NumOfGoroutines: 2, NumOfCrawls: 1000, BaseURL: server.URL, RateLimit: 100}
+	parser := sequenceParser{counter: new(int32)}
+	path := filepath.Join(t.TempDir(), "frontier.db")
+
+	// run crawler with running, paused and cancelled job and stop it
+	f, err := frontier.Open(path, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(store.NewManager(fakeStore{counter: new(int32)}, log), conf, parser, ioutil.Discard, log)
+	c.Frontier = f
+	done := make(chan struct{})
+	go func() {
+		c.Run()
+		close(done)
+	}()
+	running, _ := c.Submit(models.Seed{Link: "DT61L8hbbJ4"})
+	paused, _ := c.Submit(models.Seed{Link: "KR-eV7fHNbM"})
+	cancelled, _ := c.Submit(models.Seed{Link: "Yywb2E9t1sM"})
+	c.Pause(paused.ID)
+	c.Cancel(cancelled.ID)
+	for job, _ := c.Job(running.ID); job.Visited < 5; job, _ = c.Job(running.ID) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Stop()
+	<-done
+	_, visited, _ := c.JobPath(running.ID)
+	f.Close()
+
+	f, err = frontier.Open(path, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	c = New(store.NewManager(fakeStore{counter: new(int32)}, log), conf, parser, ioutil.Discard, log)
+	c.Frontier = f
+	unfinished, err := c.Restore()
+	if err != nil || unfinished != 2 {
+		t.Fatalf("Got %d unfinished jobs, err %v, want 2", unfinished, err)
+	}
+	// cancelled job was deleted from frontier
+	jobs := c.Jobs()
+	if len(jobs) != 2 || jobs[0].Status != models.JobRunning || jobs[1].Status != models.JobPaused {
+		t.Fatalf("Got restored jobs %+v", jobs)
+	}
+	// link that was being crawled is crawled again
+	_, restored, _ := c.JobPath(running.ID)
+	if len(restored) < len(visited)-1 || len(restored) > len(visited) || jobs[0].Visited != len(restored) {
+		t.Errorf("Got %d restored links of %d visited, job visited %d", len(restored), len(visited), jobs[0].Visited)
+	}
+	if link := <-c.data; link.JobID != running.ID || link.Number != len(restored) {
+		t.Errorf("Got link %+v to resume with, want number %d of job %s", link, len(restored), running.ID)
+	}
+	if _, err := c.Resume(paused.ID); err != nil {
+		t.Errorf("Failed to resume restored job; reason: %s", err)
+	}
+	c.Cancel(paused.ID)
+	if entries, err := f.Load(); err != nil || len(entries) != 1 || entries[0].Job.ID != running.ID {
+		t.Errorf("Got %+v left in frontier, err %v, want only running job", entries, err)
+	}
+}
+
+// pageRecorder keeps archived pages
+type pageRecorder struct {
+	pages map[string]string
+}
+
+func (p pageRecorder) ArchivePage(link models.NextLink, fetchedAt time.Time, page []byte) {
+	p.pages[link.ID] = string(page)
+}
+
+func TestArchive(t *testing.T) {
+	pages := pageRecorder{pages: map[string]string{}}
+	c := Crawler{log: logrus.New(), Pages: pages}
+	res := &http.Response{Body: ioutil.NopCloser(strings.NewReader("<html>page</html>"))}
+
+	c.archive(res, models.NextLink{ID: "aaa"}, time.Now())
+	if pages.pages["aaa"] != "<html>page</html>" {
+		t.Errorf("Got archived %q", pages.pages["aaa"])
+	}
+	if body, _ := ioutil.ReadAll(res.Body); string(body) != "<html>page</html>" {
+		t.Errorf("Got body %q left for parser", body)
+	}
+}
+
 func makeHTTPServer(status int) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(status)
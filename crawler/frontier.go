@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// errNothingToResume ends job saved in frontier without link to continue with
+var errNothingToResume = errors.New("job has no link to resume crawling from")
+
+// checkpoint queues job with link it continues with to be saved to frontier, job that ended is deleted from it
+// must be called with c.jobs locked, it only copies the job and never waits for disk
+func (c *Crawler) checkpoint(state *jobState) {
+	if c.Frontier == nil {
+		return
+	}
+	if state.job.Status.Ended() {
+		c.Frontier.DeleteJob(state.job)
+		return
+	}
+	c.Frontier.SaveJob(state.job, state.pending)
+}
+
+// checkpointVisit queues link visited by job to be saved together with the job to frontier
+// must be called with c.jobs locked
+func (c *Crawler) checkpointVisit(state *jobState, link models.NextLink) {
+	if c.Frontier == nil {
+		return
+	}
+	c.Frontier.SaveVisit(state.job, state.pending, link)
+}
+
+// advance sets link job continues with, it's called by crawling thread before the link is sent to Crawler.data
+func (c *Crawler) advance(link models.NextLink) {
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	state, ok := c.jobs.jobs[link.JobID]
+	if !ok || state.job.Status.Ended() {
+		return
+	}
+	pending := link
+	state.pending = &pending
+	c.checkpoint(state)
+}
+
+// Restore adds jobs saved in frontier by previous run and resumes them, it's no-op without Frontier
+// running and queued jobs are started again or queued if there is no free capacity, paused jobs stay paused.
+// Link that was being crawled when the application stopped is crawled again, so it can be stored twice.
+// Returns number of resumed and paused jobs
+func (c *Crawler) Restore() (int, error) {
+	if c.Frontier == nil {
+		return 0, nil
+	}
+	entries, err := c.Frontier.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	var start []models.NextLink
+	unfinished := 0
+	c.jobs.Lock()
+	if c.jobs.jobs == nil {
+		c.jobs.jobs = make(map[string]*jobState)
+	}
+	for _, e := range entries {
+		if _, ok := c.jobs.jobs[e.Job.ID]; ok {
+			continue
+		}
+		// ended jobs are deleted from frontier as they end, it's left only if application stopped before the delete was written
+		if e.Job.Status.Ended() {
+			c.Frontier.DeleteJob(e.Job)
+			continue
+		}
+		state := &jobState{job: e.Job, visited: make(map[string]bool), pending: e.Pending}
+		for _, l := range e.Path {
+			// pending link was visited, but its next link wasn't saved, so it's visited again
+			if e.Pending != nil && l.Number >= e.Pending.Number {
+				break
+			}
+			state.path = append(state.path, l)
+			state.visited[l.ID] = true
+		}
+		state.job.Visited = len(state.path)
+		c.jobs.jobs[state.job.ID] = state
+		c.jobs.order = append(c.jobs.order, state.job.ID)
+
+		switch {
+		case e.Pending == nil:
+			c.endJob(state, models.JobFailed, errNothingToResume)
+			continue
+		case state.job.Status == models.JobPaused:
+			parked := *e.Pending
+			state.parked = &parked
+		case c.jobs.active < cap(c.data):
+			c.startJob(state)
+			start = append(start, *e.Pending)
+		default:
+			state.job.Status = models.JobQueued
+			c.jobs.queue = append(c.jobs.queue, *e.Pending)
+			job := state.job
+			c.Events.Publish(events.Event{Type: events.JobQueued, JobID: job.ID, Job: &job})
+			c.checkpoint(state)
+		}
+		unfinished++
+	}
+	c.jobs.Unlock()
+
+	c.log.WithFields(logrus.Fields{
+		"jobs":       len(entries),
+		"unfinished": unfinished,
+	}).Info("Restored jobs from frontier")
+	for _, link := range start {
+		c.data <- link
+	}
+	return unfinished, nil
+}
@@ -0,0 +1,390 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// ErrJobNotFound returned when there is no job with requested ID
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobEnded returned when trying to change job that already ended
+var ErrJobEnded = errors.New("job already ended")
+
+// jobRegistry keeps track of submitted jobs, zero value is ready to use
+type jobRegistry struct {
+	sync.Mutex
+	jobs   map[string]*jobState
+	order  []string          // job IDs in order of submission
+	queue  []models.NextLink // first links of jobs waiting for free capacity
+	active int               // number of jobs holding link in Crawler.data or in crawling thread
+}
+
+// jobState holds job together with crawler internal data about it
+type jobState struct {
+	job     models.Job
+	active  bool              // true while job's link is in Crawler.data or in crawling thread
+	visited map[string]bool   // IDs of visited videos used to detect loops
+	parked  *models.NextLink  // link of paused job waiting to be resumed
+	path    []models.NextLink // visited links in order of visiting
+	pending *models.NextLink  // link job continues with, saved to frontier, nil once job ended
+}
+
+// Submit creates new Job from seed and starts crawling it
+// number of running jobs is limited by Crawler.data capacity so crawling threads never block each other,
+// jobs over the limit are queued and started once some running job ends
+func (c *Crawler) Submit(seed models.Seed) (models.Job, error) {
+	link, videoID, err := models.NormalizeLink(seed.Link)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("%s: '%s'", err, seed.Link)
+	}
+	seed.Link = link
+	if seed.NOfIterations <= 0 {
+		seed.NOfIterations = c.Configuration.NumOfCrawls
+	}
+
+	state := &jobState{
+		job: models.Job{
+			ID:      models.NewJobID(),
+			Seed:    seed,
+			VideoID: videoID,
+			Status:  models.JobQueued,
+			Created: time.Now(),
+		},
+		visited: make(map[string]bool),
+	}
+	firstLink := models.NewNextLink(link, seed.NOfIterations)
+	firstLink.JobID = state.job.ID
+	if c.Configuration.BaseURL != "" {
+		firstLink.BaseURL = c.Configuration.BaseURL
+	}
+
+	c.jobs.Lock()
+	if c.jobs.jobs == nil {
+		c.jobs.jobs = make(map[string]*jobState)
+	}
+	c.jobs.jobs[state.job.ID] = state
+	c.jobs.order = append(c.jobs.order, state.job.ID)
+	pending := firstLink
+	state.pending = &pending
+	start := c.jobs.active < cap(c.data)
+	if start {
+		c.startJob(state)
+	} else {
+		c.jobs.queue = append(c.jobs.queue, firstLink)
+		job := state.job
+		c.Events.Publish(events.Event{Type: events.JobQueued, Time: job.Created, JobID: job.ID, Job: &job})
+		c.checkpoint(state)
+	}
+	submitted := state.job
+	c.jobs.Unlock()
+
+	c.log.WithFields(logrus.Fields{
+		"jobID":  submitted.ID,
+		"link":   submitted.Seed.Link,
+		"status": submitted.Status,
+	}).Debug("Job submitted")
+
+	if start {
+		c.data <- firstLink
+	}
+	return submitted, nil
+}
+
+// Job returns job by its ID
+func (c *Crawler) Job(id string) (models.Job, bool) {
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	state, ok := c.jobs.jobs[id]
+	if !ok {
+		return models.Job{}, false
+	}
+	return state.job, true
+}
+
+// Jobs returns all jobs in order of submission
+func (c *Crawler) Jobs() []models.Job {
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	jobs := make([]models.Job, 0, len(c.jobs.order))
+	for _, id := range c.jobs.order {
+		jobs = append(jobs, c.jobs.jobs[id].job)
+	}
+	return jobs
+}
+
+// JobPath returns job together with links it visited in order of visiting
+func (c *Crawler) JobPath(id string) (models.Job, []models.NextLink, bool) {
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	state, ok := c.jobs.jobs[id]
+	if !ok {
+		return models.Job{}, nil, false
+	}
+	path := make([]models.NextLink, len(state.path))
+	copy(path, state.path)
+	return state.job, path, true
+}
+
+// Graph returns graph of videos visited by job, or by all jobs if jobID is empty
+// links deeper than maxDepth are skipped, negative maxDepth means no limit
+func (c *Crawler) Graph(jobID string, maxDepth int) (models.Graph, bool) {
+	c.jobs.Lock()
+	var links []models.NextLink
+	if jobID != "" {
+		state, ok := c.jobs.jobs[jobID]
+		if !ok {
+			c.jobs.Unlock()
+			return models.Graph{}, false
+		}
+		links = append(links, state.path...)
+	} else {
+		for _, id := range c.jobs.order {
+			links = append(links, c.jobs.jobs[id].path...)
+		}
+	}
+	c.jobs.Unlock()
+	return models.BuildGraph(links, maxDepth), true
+}
+
+// Pending returns number of queued and running jobs
+func (c *Crawler) Pending() int {
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	pending := 0
+	for _, state := range c.jobs.jobs {
+		if !state.job.Status.Ended() {
+			pending++
+		}
+	}
+	return pending
+}
+
+// Cancel cancels queued or running job, link of running job is dropped once crawling thread picks it up
+func (c *Crawler) Cancel(id string) (models.Job, error) {
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	state, ok := c.jobs.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	if state.job.Status.Ended() {
+		return state.job, ErrJobEnded
+	}
+
+	for i, link := range c.jobs.queue {
+		if link.JobID == id {
+			c.jobs.queue = append(c.jobs.queue[:i], c.jobs.queue[i+1:]...)
+			break
+		}
+	}
+	c.endJob(state, models.JobCancelled, nil)
+	return state.job, nil
+}
+
+// Pause pauses queued or running job, link of running job is parked once crawling thread picks it up
+// and job's capacity is given to the next queued job
+func (c *Crawler) Pause(id string) (models.Job, error) {
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	state, ok := c.jobs.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	switch state.job.Status {
+	case models.JobPaused:
+		return state.job, nil
+	case models.JobQueued:
+		for i, link := range c.jobs.queue {
+			if link.JobID == id {
+				parked := link
+				state.parked = &parked
+				c.jobs.queue = append(c.jobs.queue[:i], c.jobs.queue[i+1:]...)
+				break
+			}
+		}
+	case models.JobRunning:
+	default:
+		return state.job, ErrJobEnded
+	}
+
+	state.job.Status = models.JobPaused
+	c.checkpoint(state)
+	job := state.job
+	c.Events.Publish(events.Event{Type: events.JobPaused, JobID: job.ID, Job: &job})
+	return job, nil
+}
+
+// Resume resumes paused job, job is queued if there is no free capacity for it
+func (c *Crawler) Resume(id string) (models.Job, error) {
+	c.jobs.Lock()
+	state, ok := c.jobs.jobs[id]
+	if !ok {
+		c.jobs.Unlock()
+		return models.Job{}, ErrJobNotFound
+	}
+	if state.job.Status.Ended() {
+		c.jobs.Unlock()
+		return state.job, ErrJobEnded
+	}
+	if state.job.Status != models.JobPaused {
+		c.jobs.Unlock()
+		return state.job, nil
+	}
+
+	// link is still in Crawler.data or in crawling thread, job continues with it
+	if state.parked == nil {
+		state.job.Status = models.JobRunning
+		c.checkpoint(state)
+		job := state.job
+		c.Events.Publish(events.Event{Type: events.JobResumed, JobID: job.ID, Job: &job})
+		c.jobs.Unlock()
+		return job, nil
+	}
+
+	link := *state.parked
+	state.parked = nil
+	start := c.jobs.active < cap(c.data)
+	if start {
+		c.startJob(state)
+	} else {
+		state.job.Status = models.JobQueued
+		c.jobs.queue = append([]models.NextLink{link}, c.jobs.queue...)
+		c.checkpoint(state)
+		job := state.job
+		c.Events.Publish(events.Event{Type: events.JobQueued, JobID: job.ID, Job: &job})
+	}
+	job := state.job
+	c.jobs.Unlock()
+
+	if start {
+		c.data <- link
+	}
+	return job, nil
+}
+
+// visit marks link as visited by its job and returns status of the job
+// link should be crawled only if returned status is running, links added directly by Add have no job and are always crawled
+// job ends with loop detected status if it already visited the same video
+func (c *Crawler) visit(link models.NextLink) models.JobStatus {
+	c.jobs.Lock()
+	state, ok := c.jobs.jobs[link.JobID]
+	if !ok {
+		c.jobs.Unlock()
+		c.Events.Publish(events.Event{Type: events.VideoVisited, Link: &link})
+		return models.JobRunning
+	}
+
+	if state.job.Status == models.JobRunning && link.ID != "" && state.visited[link.ID] {
+		c.endJob(state, models.JobLoopDetected, nil)
+	}
+	if state.job.Status == models.JobPaused {
+		parked := link
+		state.parked = &parked
+	}
+	if state.job.Status != models.JobRunning {
+		status := state.job.Status
+		next, start := c.release(state)
+		c.jobs.Unlock()
+		if start {
+			c.data <- next
+		}
+		return status
+	}
+
+	state.visited[link.ID] = true
+	state.path = append(state.path, link)
+	state.job.Visited++
+	c.checkpointVisit(state, link)
+	c.Events.Publish(events.Event{Type: events.VideoVisited, JobID: link.JobID, Link: &link})
+	c.jobs.Unlock()
+	return models.JobRunning
+}
+
+// finishJob ends job as completed or as failed if err is not nil and starts first queued job if there is any
+func (c *Crawler) finishJob(jobID string, err error) {
+	c.jobs.Lock()
+	state, ok := c.jobs.jobs[jobID]
+	if !ok {
+		c.jobs.Unlock()
+		return
+	}
+	status := models.JobCompleted
+	if err != nil {
+		status = models.JobFailed
+	}
+	c.endJob(state, status, err)
+	next, start := c.release(state)
+	c.jobs.Unlock()
+
+	if start {
+		c.data <- next
+	}
+}
+
+// startJob marks job as running and publishes JobStarted event, or JobResumed if job was started before
+// must be called with c.jobs locked
+func (c *Crawler) startJob(state *jobState) {
+	now := time.Now()
+	state.active = true
+	state.job.Status = models.JobRunning
+	c.jobs.active++
+
+	eventType := events.JobResumed
+	if state.job.Started == nil {
+		eventType = events.JobStarted
+		state.job.Started = &now
+	}
+	c.checkpoint(state)
+	job := state.job
+	c.Events.Publish(events.Event{Type: eventType, Time: now, JobID: job.ID, Job: &job})
+}
+
+// endJob sets final status of running or queued job and publishes event about it, ended jobs are left as they are
+// must be called with c.jobs locked
+func (c *Crawler) endJob(state *jobState, status models.JobStatus, err error) {
+	if state.job.Status.Ended() {
+		return
+	}
+	now := time.Now()
+	state.job.Status = status
+	state.job.Ended = &now
+	if err != nil {
+		state.job.Error = err.Error()
+	}
+	state.pending = nil
+	c.checkpoint(state)
+
+	c.log.WithFields(logrus.Fields{
+		"jobID":   state.job.ID,
+		"status":  status,
+		"visited": state.job.Visited,
+	}).Debug("Job ended")
+
+	job := state.job
+	c.Events.Publish(events.Event{Type: events.EndEventType(status), Time: now, JobID: job.ID, Job: &job})
+}
+
+// release frees capacity held by job and returns first link of queued job that should be started in its place
+// must be called with c.jobs locked
+func (c *Crawler) release(state *jobState) (next models.NextLink, start bool) {
+	if !state.active {
+		return next, false
+	}
+	state.active = false
+	c.jobs.active--
+
+	if len(c.jobs.queue) == 0 {
+		return next, false
+	}
+	next = c.jobs.queue[0]
+	c.jobs.queue = c.jobs.queue[1:]
+	c.startJob(c.jobs.jobs[next.JobID])
+	return next, true
+}
@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces requests of all crawling threads evenly, zero value doesn't limit anything
+type rateLimiter struct {
+	sync.Mutex
+	interval time.Duration // minimal time between two requests, 0 for no limit
+	next     time.Time     // time the next request is allowed at
+}
+
+// wait blocks until next request is allowed
+func (r *rateLimiter) wait() {
+	r.Lock()
+	if r.interval == 0 {
+		r.Unlock()
+		return
+	}
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	sleep := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.Unlock()
+
+	time.Sleep(sleep)
+}
+
+// SetRate limits number of requests per second done by all crawling threads, 0 removes the limit
+func (c *Crawler) SetRate(perSecond float64) error {
+	if perSecond < 0 {
+		return errors.New("rate can't be negative")
+	}
+	c.limiter.Lock()
+	defer c.limiter.Unlock()
+	c.limiter.interval = 0
+	if perSecond > 0 {
+		c.limiter.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	c.limiter.next = time.Now()
+	return nil
+}
+
+// Rate returns current limit of requests per second, 0 if there is no limit
+func (c *Crawler) Rate() float64 {
+	c.limiter.Lock()
+	defer c.limiter.Unlock()
+	if c.limiter.interval == 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(c.limiter.interval)
+}
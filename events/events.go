@@ -0,0 +1,194 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// Type of event
+type Type string
+
+// Event types published by crawler
+const (
+	JobQueued       Type = "job.queued"        // job was submitted but has to wait for free capacity
+	JobStarted      Type = "job.started"       // job got free capacity and its first link was sent for crawling
+	JobPaused       Type = "job.paused"        // job was paused by user
+	JobResumed      Type = "job.resumed"       // paused job was resumed
+	JobCompleted    Type = "job.completed"     // job crawled all its iterations
+	JobFailed       Type = "job.failed"        // video couldn't be fetched or parsed
+	JobCancelled    Type = "job.cancelled"     // job was cancelled by user
+	JobLoopDetected Type = "job.loop_detected" // job got to the video it already visited
+	VideoVisited    Type = "video.visited"     // link was sent to store
+	Error           Type = "error"             // video couldn't be fetched or parsed
+)
+
+// JobEnded lists types of events published when job ends
+var JobEnded = []Type{JobCompleted, JobFailed, JobCancelled, JobLoopDetected}
+
+// JobLifecycle lists types of events published when job changes its status
+var JobLifecycle = append([]Type{JobQueued, JobStarted, JobPaused, JobResumed}, JobEnded...)
+
+// Event is single change in crawler state
+type Event struct {
+	Type  Type             `json:"type"`
+	Time  time.Time        `json:"time"`
+	JobID string           `json:"job_id,omitempty"`
+	Job   *models.Job      `json:"job,omitempty"`  // snapshot of the job for job events
+	Link  *models.NextLink `json:"link,omitempty"` // visited link for VideoVisited, failed link for Error
+	Error string           `json:"error,omitempty"`
+}
+
+// EndEventType returns type of event published when job ends with given status
+func EndEventType(status models.JobStatus) Type {
+	switch status {
+	case models.JobFailed:
+		return JobFailed
+	case models.JobCancelled:
+		return JobCancelled
+	case models.JobLoopDetected:
+		return JobLoopDetected
+	default:
+		return JobCompleted
+	}
+}
+
+// Bus delivers published events to all subscribers
+// publishing never blocks, events are dropped for subscribers whose buffer is full unless subscription is unbounded
+type Bus struct {
+	sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// Subscription receives events from Bus on channel C until it's closed
+type Subscription struct {
+	C       <-chan Event
+	c       chan Event
+	types   map[Type]bool
+	bus     *Bus
+	dropped uint64
+
+	// unbounded subscription keeps events in queue, they are sent to c by forward
+	unbounded bool
+	mu        sync.Mutex
+	queue     []Event
+	wake      chan struct{}
+	done      chan struct{}
+}
+
+// NewBus returns new *Bus
+func NewBus() *Bus {
+	return &Bus{subscriptions: make(map[*Subscription]struct{})}
+}
+
+// Subscribe returns subscription receiving events of given types, all events if no type is given
+// buffer is capacity of subscription channel
+func (b *Bus) Subscribe(buffer int, types ...Type) *Subscription {
+	c := make(chan Event, buffer)
+	s := &Subscription{C: c, c: c, bus: b}
+	if len(types) > 0 {
+		s.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+
+	b.Lock()
+	b.subscriptions[s] = struct{}{}
+	b.Unlock()
+	return s
+}
+
+// SubscribeUnbounded returns subscription receiving events of given types that never drops them and never blocks publishing,
+// events wait in queue of unlimited size until they are received, so it's meant for low volume events like JobLifecycle
+func (b *Bus) SubscribeUnbounded(types ...Type) *Subscription {
+	s := b.Subscribe(0, types...)
+	s.unbounded = true
+	s.wake = make(chan struct{}, 1)
+	s.done = make(chan struct{})
+	go s.forward()
+	return s
+}
+
+// push adds event to queue of unbounded subscription
+func (s *Subscription) push(e Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, e)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// forward sends queued events to channel of unbounded subscription until it's closed, the channel is closed then
+func (s *Subscription) forward() {
+	defer close(s.c)
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		for _, e := range queue {
+			select {
+			case s.c <- e:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// Publish sends event to all subscribers interested in its type, does nothing on nil *Bus
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.RLock()
+	defer b.RUnlock()
+	for s := range b.subscriptions {
+		if s.types != nil && !s.types[e.Type] {
+			continue
+		}
+		if s.unbounded {
+			s.push(e)
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Close unsubscribes and closes subscription channel
+// channel of unbounded subscription is closed by its forwarder shortly after, events still queued are dropped
+func (s *Subscription) Close() {
+	s.bus.Lock()
+	defer s.bus.Unlock()
+	if _, ok := s.bus.subscriptions[s]; ok {
+		delete(s.bus.subscriptions, s)
+		if s.unbounded {
+			close(s.done)
+		} else {
+			close(s.c)
+		}
+	}
+}
+
+// Dropped returns number of events dropped because subscription buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
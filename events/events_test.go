@@ -0,0 +1,95 @@
+package events
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+func TestBus(t *testing.T) {
+	t.Run("Filters by type", func(t *testing.T) {
+		bus := NewBus()
+		all := bus.Subscribe(10)
+		ended := bus.Subscribe(10, JobEnded...)
+		defer all.Close()
+		defer ended.Close()
+
+		bus.Publish(Event{Type: JobStarted, JobID: "a"})
+		bus.Publish(Event{Type: VideoVisited, JobID: "a"})
+		bus.Publish(Event{Type: EndEventType(models.JobLoopDetected), JobID: "a"})
+
+		assertCountEquals(t, 3, len(all.C))
+		assertCountEquals(t, 1, len(ended.C))
+		if e := <-ended.C; e.Type != JobLoopDetected || e.Time.IsZero() {
+			t.Errorf("Got %+v, want loop detected event with time", e)
+		}
+	})
+
+	t.Run("Drops events when buffer is full", func(t *testing.T) {
+		bus := NewBus()
+		s := bus.Subscribe(1)
+		bus.Publish(Event{Type: JobStarted})
+		bus.Publish(Event{Type: JobStarted})
+
+		assertCountEquals(t, 1, len(s.C))
+		assertCountEquals(t, 1, int(s.Dropped()))
+	})
+
+	t.Run("Closed subscription receives nothing", func(t *testing.T) {
+		bus := NewBus()
+		s := bus.Subscribe(1)
+		s.Close()
+		s.Close()
+		bus.Publish(Event{Type: JobStarted})
+
+		if _, ok := <-s.C; ok {
+			t.Errorf("Expected closed channel")
+		}
+	})
+
+	t.Run("Unbounded subscription keeps all events", func(t *testing.T) {
+		bus := NewBus()
+		s := bus.SubscribeUnbounded(JobEnded...)
+		for i := 0; i < 1000; i++ {
+			bus.Publish(Event{Type: JobCompleted, JobID: strconv.Itoa(i)})
+			bus.Publish(Event{Type: VideoVisited})
+		}
+		for i := 0; i < 1000; i++ {
+			select {
+			case e := <-s.C:
+				if e.JobID != strconv.Itoa(i) {
+					t.Fatalf("Got %+v, want event of job %d", e, i)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Got only %d events", i)
+			}
+		}
+		assertCountEquals(t, 0, int(s.Dropped()))
+
+		s.Close()
+		s.Close()
+		bus.Publish(Event{Type: JobCompleted})
+		select {
+		case e, ok := <-s.C:
+			if ok {
+				t.Errorf("Got %+v from closed subscription", e)
+			}
+		case <-time.After(time.Second):
+			t.Error("Channel of closed subscription isn't closed")
+		}
+	})
+
+	t.Run("Nil bus", func(t *testing.T) {
+		var bus *Bus
+		bus.Publish(Event{Type: JobStarted})
+	})
+}
+
+func assertCountEquals(t *testing.T, want, got int) {
+	t.Helper()
+	if want != got {
+		t.Errorf("Got '%v', want: '%v'", got, want)
+	}
+}
@@ -0,0 +1,197 @@
+// Package export writes datasets and recommendation graphs of crawled jobs as CSV, Parquet, GraphML, GEXF or DOT files
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// Formats of exported datasets
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// Datasets that can be exported
+const (
+	DatasetEdges  = "edges"  // every visit of job with video it was recommended by
+	DatasetVideos = "videos" // videos visited by job
+)
+
+// rowGroupSize is number of rows buffered before they are written as single row group of Parquet file
+const rowGroupSize = 10000
+
+// Edge is row of edges dataset
+type Edge struct {
+	JobID     string    `parquet:"job_id"`
+	Number    int64     `parquet:"number"`
+	ParentID  string    `parquet:"parent_id,optional"`
+	VideoID   string    `parquet:"video_id"`
+	Title     string    `parquet:"title"`
+	Channel   string    `parquet:"channel"`
+	Link      string    `parquet:"link"`
+	VisitedAt time.Time `parquet:"visited_at,optional,timestamp(millisecond)"`
+}
+
+// Video is row of videos dataset
+type Video struct {
+	ID      string `parquet:"id"`
+	Title   string `parquet:"title"`
+	Channel string `parquet:"channel"`
+	Visits  int64  `parquet:"visits"`
+	Jobs    int64  `parquet:"jobs"`
+}
+
+var edgeHeader = []string{"job_id", "number", "parent_id", "video_id", "title", "channel", "link", "visited_at"}
+
+func (e Edge) record() []string {
+	visitedAt := ""
+	if !e.VisitedAt.IsZero() {
+		visitedAt = e.VisitedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return []string{e.JobID, strconv.FormatInt(e.Number, 10), e.ParentID, e.VideoID, e.Title, e.Channel, e.Link, visitedAt}
+}
+
+var videoHeader = []string{"id", "title", "channel", "visits", "jobs"}
+
+func (v Video) record() []string {
+	return []string{v.ID, v.Title, v.Channel, strconv.FormatInt(v.Visits, 10), strconv.FormatInt(v.Jobs, 10)}
+}
+
+// ContentType returns MIME type of format
+func ContentType(format string) string {
+	if format == FormatParquet {
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Check returns error if dataset or format isn't supported
+func Check(dataset, format string) error {
+	if dataset != DatasetEdges && dataset != DatasetVideos {
+		return fmt.Errorf("unsupported dataset '%s', use edges or videos", dataset)
+	}
+	if format != FormatCSV && format != FormatParquet {
+		return fmt.Errorf("unsupported format '%s', use csv or parquet", format)
+	}
+	return nil
+}
+
+// Job writes dataset of job read from r to w in given format
+// rows are streamed, edges are read row by row if r is store.Scanner and videos are read page by page
+func Job(w io.Writer, r store.Reader, jobID, dataset, format string) error {
+	if err := Check(dataset, format); err != nil {
+		return err
+	}
+	switch dataset {
+	case DatasetEdges:
+		rw := newRowWriter(w, format, edgeHeader, Edge{})
+		err := store.ScanLinks(r, store.LinkQuery{JobID: jobID}, func(l models.NextLink) error {
+			return rw.write(Edge{
+				JobID:     l.JobID,
+				Number:    int64(l.Number),
+				ParentID:  l.ParentID,
+				VideoID:   l.ID,
+				Title:     l.Title,
+				Channel:   l.Channel,
+				Link:      l.Link,
+				VisitedAt: l.VisitedAt,
+			})
+		})
+		if err != nil {
+			return err
+		}
+		return rw.close()
+	default:
+		rw := newRowWriter(w, format, videoHeader, Video{})
+		q := store.VideoQuery{JobID: jobID, Limit: store.MaxLimit}
+		for {
+			page, err := r.Videos(q)
+			if err != nil {
+				return err
+			}
+			for _, v := range page.Videos {
+				if err := rw.write(Video{ID: v.ID, Title: v.Title, Channel: v.Channel, Visits: int64(v.Visits), Jobs: int64(v.Jobs)}); err != nil {
+					return err
+				}
+			}
+			if page.NextCursor == "" {
+				return rw.close()
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+}
+
+// row is single row of dataset
+type row interface {
+	record() []string
+}
+
+// rowWriter writes rows in single format, close has to be called to finish the file
+type rowWriter interface {
+	write(r row) error
+	close() error
+}
+
+func newRowWriter(w io.Writer, format string, header []string, model row) rowWriter {
+	if format == FormatParquet {
+		return &parquetWriter{w: parquet.NewWriter(w, parquet.SchemaOf(model), parquet.MaxRowsPerRowGroup(rowGroupSize))}
+	}
+	return &csvWriter{w: csv.NewWriter(w), header: header}
+}
+
+// csvWriter writes header before the first row so even empty dataset has it
+type csvWriter struct {
+	w      *csv.Writer
+	header []string
+	n      int
+}
+
+func (c *csvWriter) write(r row) error {
+	if c.n == 0 {
+		if err := c.w.Write(c.header); err != nil {
+			return err
+		}
+	}
+	c.n++
+	if err := c.w.Write(r.record()); err != nil {
+		return err
+	}
+	// flush regularly so rows are streamed to the writer
+	if c.n%100 == 0 {
+		c.w.Flush()
+		return c.w.Error()
+	}
+	return nil
+}
+
+func (c *csvWriter) close() error {
+	if c.n == 0 {
+		if err := c.w.Write(c.header); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// parquetWriter writes row groups of at most rowGroupSize rows, footer with schema is written on close
+type parquetWriter struct {
+	w *parquet.Writer
+}
+
+func (p *parquetWriter) write(r row) error {
+	return p.w.Write(r)
+}
+
+func (p *parquetWriter) close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,177 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// memoryReader serves videos in pages of two to exercise pagination
+// other methods of store.Reader aren't used by exports
+type memoryReader struct {
+	store.Reader
+	path   []models.NextLink
+	videos []models.Video
+}
+
+func (m memoryReader) Videos(q store.VideoQuery) (store.VideoPage, error) {
+	start := 0
+	if q.Cursor != "" {
+		start, _ = strconv.Atoi(q.Cursor)
+	}
+	page := store.VideoPage{Videos: m.videos[start:]}
+	if len(page.Videos) > 2 {
+		page.Videos = page.Videos[:2]
+		page.NextCursor = strconv.Itoa(start + 2)
+	}
+	return page, nil
+}
+
+func (m memoryReader) Path(jobID string) ([]models.NextLink, error) {
+	return m.path, nil
+}
+
+var visited = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+var testReader = memoryReader{
+	path: []models.NextLink{
+		{ID: "aaa", JobID: "j1", Title: "Alpha, \"quoted\"", Channel: "ch1", Link: "/watch?v=aaa", VisitedAt: visited},
+		{ID: "bbb", JobID: "j1", ParentID: "aaa", Title: "Beta", Channel: "ch2", Link: "/watch?v=bbb", Number: 1},
+	},
+	videos: []models.Video{
+		{ID: "aaa", Title: "Alpha", Channel: "ch1", Visits: 2, Jobs: 1},
+		{ID: "bbb", Title: "Beta", Channel: "ch2", Visits: 1, Jobs: 1},
+		{ID: "ccc", Title: "Gamma", Channel: "ch1", Visits: 1, Jobs: 1},
+	},
+}
+
+func TestJobCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Job(&buf, testReader, "j1", DatasetEdges, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][0] != "job_id" || records[1][4] != "Alpha, \"quoted\"" ||
+		records[1][7] != "2020-01-02T03:04:05Z" || records[2][2] != "aaa" || records[2][7] != "" {
+		t.Errorf("Got %q", records)
+	}
+
+	buf.Reset()
+	if err := Job(&buf, testReader, "j1", DatasetVideos, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	records, _ = csv.NewReader(&buf).ReadAll()
+	if len(records) != 4 || records[0][3] != "visits" || records[3][0] != "ccc" {
+		t.Errorf("Got %q", records)
+	}
+
+	t.Run("empty dataset has header", func(t *testing.T) {
+		buf.Reset()
+		if err := Job(&buf, memoryReader{}, "j1", DatasetEdges, FormatCSV); err != nil {
+			t.Fatal(err)
+		}
+		if records, _ := csv.NewReader(&buf).ReadAll(); len(records) != 1 {
+			t.Errorf("Got %q", records)
+		}
+	})
+}
+
+func readParquet(t *testing.T, b []byte, model interface{}) *parquet.Reader {
+	t.Helper()
+	f, err := parquet.OpenFile(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parquet.NewReader(f, parquet.SchemaOf(model))
+}
+
+func TestJobParquet(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Job(&buf, testReader, "j1", DatasetEdges, FormatParquet); err != nil {
+		t.Fatal(err)
+	}
+	r := readParquet(t, buf.Bytes(), Edge{})
+	var edges []Edge
+	for {
+		var e Edge
+		if err := r.Read(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		edges = append(edges, e)
+	}
+	if len(edges) != 2 || edges[0].Title != testReader.path[0].Title || !edges[0].VisitedAt.Equal(visited) ||
+		edges[1].ParentID != "aaa" || edges[1].Number != 1 || !edges[1].VisitedAt.IsZero() {
+		t.Errorf("Got %+v", edges)
+	}
+
+	buf.Reset()
+	if err := Job(&buf, testReader, "j1", DatasetVideos, FormatParquet); err != nil {
+		t.Fatal(err)
+	}
+	if n := readParquet(t, buf.Bytes(), Video{}).NumRows(); n != 3 {
+		t.Errorf("Got %d videos, want 3", n)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check("links", FormatCSV); err == nil {
+		t.Error("Got no error for unknown dataset")
+	}
+	if err := Check(DatasetEdges, "xlsx"); err == nil {
+		t.Error("Got no error for unknown format")
+	}
+	if err := Job(io.Discard, testReader, "j1", DatasetEdges, "xlsx"); err == nil {
+		t.Error("Got no error for unknown format")
+	}
+}
+
+func TestJobFromJSONL(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	conf := config.StoreConfig{Backend: store.BackendJSONL, JSONLPath: filepath.Join(t.TempDir(), "links.jsonl"), JSONLCompression: store.CompressionZstd}
+	s, err := store.NewJSONLStoreFromConfig(conf, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range testReader.path {
+		s.Store(l)
+	}
+	s.Close()
+
+	r, err := store.OpenReader(conf, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var buf bytes.Buffer
+	if err := Job(&buf, r, "j1", DatasetEdges, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	records, _ := csv.NewReader(&buf).ReadAll()
+	if len(records) != len(testReader.path)+1 || records[1][4] != "Alpha, \"quoted\"" {
+		t.Errorf("Got %q", records)
+	}
+	buf.Reset()
+	if err := Job(&buf, r, "j1", DatasetVideos, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := csv.NewReader(&buf).ReadAll(); len(records) != 3 || records[0][3] != "visits" {
+		t.Errorf("Got %q", records)
+	}
+}
@@ -0,0 +1,281 @@
+package export
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// Formats of exported graphs
+const (
+	FormatGraphML = "graphml"
+	FormatGEXF    = "gexf"
+	FormatDOT     = "dot"
+)
+
+// GraphContentType returns MIME type of graph format
+func GraphContentType(format string) string {
+	switch format {
+	case FormatGraphML:
+		return "application/graphml+xml"
+	case FormatGEXF:
+		return "application/gexf+xml"
+	default:
+		return "text/vnd.graphviz; charset=utf-8"
+	}
+}
+
+// CheckGraph returns error if graph format isn't supported
+func CheckGraph(format string) error {
+	switch format {
+	case FormatGraphML, FormatGEXF, FormatDOT:
+		return nil
+	}
+	return fmt.Errorf("unsupported graph format '%s', use graphml, gexf or dot", format)
+}
+
+// Graph writes videos and recommendations of links matching query to w as graph in given format
+// nodes are videos with title, channel, visits and depth they were first seen at,
+// every visit of video recommended by another one is single edge with its position in path, job and timestamp
+// links are scanned twice, nodes are collected by the first scan and edges are streamed by the second one
+func Graph(w io.Writer, r store.Reader, q store.LinkQuery, format string) error {
+	if err := CheckGraph(format); err != nil {
+		return err
+	}
+	var nodes []models.Node
+	index := make(map[string]int)
+	err := store.ScanLinks(r, q, func(l models.NextLink) error {
+		i, ok := index[l.ID]
+		if !ok {
+			i = len(nodes)
+			index[l.ID] = i
+			nodes = append(nodes, models.Node{ID: l.ID, Depth: l.Number})
+		}
+		n := &nodes[i]
+		n.Visits++
+		if l.Title != "" {
+			n.Title = l.Title
+		}
+		if l.Channel != "" {
+			n.Channel = l.Channel
+		}
+		if l.Number < n.Depth {
+			n.Depth = l.Number
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	gw := newGraphWriter(w, format)
+	gw.begin(graphName(q))
+	for _, n := range nodes {
+		gw.node(n)
+	}
+	gw.edges()
+	id := 0
+	err = store.ScanLinks(r, q, func(l models.NextLink) error {
+		// parent outside of time range isn't a node of the graph
+		if _, ok := index[l.ParentID]; !ok {
+			return nil
+		}
+		gw.edge(id, l)
+		id++
+		return gw.err()
+	})
+	if err != nil {
+		return err
+	}
+	gw.end()
+	return gw.flush()
+}
+
+// graphName describes query, it's used as ID of the graph
+func graphName(q store.LinkQuery) string {
+	name := "crawl"
+	if q.JobID != "" {
+		name = "job " + q.JobID
+	}
+	if !q.From.IsZero() {
+		name += " from " + q.From.UTC().Format(time.RFC3339)
+	}
+	if !q.To.IsZero() {
+		name += " to " + q.To.UTC().Format(time.RFC3339)
+	}
+	return name
+}
+
+// graphWriter writes graph element by element, the first write error is kept and returned by err and flush
+type graphWriter interface {
+	begin(name string)
+	node(n models.Node)
+	edges()
+	edge(id int, l models.NextLink)
+	end()
+	err() error
+	flush() error
+}
+
+func newGraphWriter(w io.Writer, format string) graphWriter {
+	out := &output{w: bufio.NewWriter(w)}
+	switch format {
+	case FormatGraphML:
+		return graphMLWriter{out}
+	case FormatGEXF:
+		return gexfWriter{out}
+	default:
+		return dotWriter{out}
+	}
+}
+
+// output is buffered writer with sticky error
+type output struct {
+	w *bufio.Writer
+	e error
+}
+
+func (o *output) printf(format string, args ...interface{}) {
+	if o.e == nil {
+		_, o.e = fmt.Fprintf(o.w, format, args...)
+	}
+}
+
+func (o *output) err() error {
+	return o.e
+}
+
+func (o *output) flush() error {
+	if o.e != nil {
+		return o.e
+	}
+	return o.w.Flush()
+}
+
+// timestamp formats time of visit, it's empty for unknown time
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// xmlText escapes s for XML attribute or text
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// graphMLWriter writes GraphML, it can be read by networkx.read_graphml, Gephi or yEd
+type graphMLWriter struct {
+	*output
+}
+
+func (g graphMLWriter) begin(name string) {
+	g.printf(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	g.printf(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, key := range [][3]string{
+		{"node", "title", "string"}, {"node", "channel", "string"}, {"node", "visits", "int"}, {"node", "depth", "int"},
+		{"edge", "position", "int"}, {"edge", "job", "string"}, {"edge", "timestamp", "string"},
+	} {
+		g.printf(`  <key id="%s" for="%s" attr.name="%s" attr.type="%s"/>`+"\n", key[1], key[0], key[1], key[2])
+	}
+	g.printf(`  <graph id="%s" edgedefault="directed">`+"\n", xmlText(name))
+}
+
+func (g graphMLWriter) node(n models.Node) {
+	g.printf(`    <node id="%s"><data key="title">%s</data><data key="channel">%s</data><data key="visits">%d</data><data key="depth">%d</data></node>`+"\n",
+		xmlText(n.ID), xmlText(n.Title), xmlText(n.Channel), n.Visits, n.Depth)
+}
+
+func (g graphMLWriter) edges() {}
+
+func (g graphMLWriter) edge(id int, l models.NextLink) {
+	g.printf(`    <edge id="e%d" source="%s" target="%s"><data key="position">%d</data><data key="job">%s</data><data key="timestamp">%s</data></edge>`+"\n",
+		id, xmlText(l.ParentID), xmlText(l.ID), l.Number, xmlText(l.JobID), timestamp(l.VisitedAt))
+}
+
+func (g graphMLWriter) end() {
+	g.printf("  </graph>\n</graphml>\n")
+}
+
+// gexfWriter writes GEXF 1.3, native format of Gephi
+type gexfWriter struct {
+	*output
+}
+
+func (g gexfWriter) begin(name string) {
+	g.printf(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	g.printf(`<gexf xmlns="http://gexf.net/1.3" version="1.3">` + "\n")
+	g.printf(`  <meta><description>%s</description></meta>`+"\n", xmlText(name))
+	g.printf(`  <graph defaultedgetype="directed" mode="static">` + "\n")
+	g.printf(`    <attributes class="node"><attribute id="title" title="title" type="string"/><attribute id="channel" title="channel" type="string"/>` +
+		`<attribute id="visits" title="visits" type="integer"/><attribute id="depth" title="depth" type="integer"/></attributes>` + "\n")
+	g.printf(`    <attributes class="edge"><attribute id="position" title="position" type="integer"/><attribute id="job" title="job" type="string"/>` +
+		`<attribute id="timestamp" title="timestamp" type="string"/></attributes>` + "\n")
+	g.printf("    <nodes>\n")
+}
+
+func (g gexfWriter) node(n models.Node) {
+	label := n.Title
+	if label == "" {
+		label = n.ID
+	}
+	g.printf(`      <node id="%s" label="%s"><attvalues><attvalue for="title" value="%s"/><attvalue for="channel" value="%s"/><attvalue for="visits" value="%d"/><attvalue for="depth" value="%d"/></attvalues></node>`+"\n",
+		xmlText(n.ID), xmlText(label), xmlText(n.Title), xmlText(n.Channel), n.Visits, n.Depth)
+}
+
+func (g gexfWriter) edges() {
+	g.printf("    </nodes>\n    <edges>\n")
+}
+
+func (g gexfWriter) edge(id int, l models.NextLink) {
+	g.printf(`      <edge id="%d" source="%s" target="%s"><attvalues><attvalue for="position" value="%d"/><attvalue for="job" value="%s"/><attvalue for="timestamp" value="%s"/></attvalues></edge>`+"\n",
+		id, xmlText(l.ParentID), xmlText(l.ID), l.Number, xmlText(l.JobID), timestamp(l.VisitedAt))
+}
+
+func (g gexfWriter) end() {
+	g.printf("    </edges>\n  </graph>\n</gexf>\n")
+}
+
+// dotWriter writes Graphviz DOT, attributes are kept as quoted strings so networkx and Gephi read them too
+type dotWriter struct {
+	*output
+}
+
+// dotQuote returns s as DOT string
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "").Replace(s) + `"`
+}
+
+func (g dotWriter) begin(name string) {
+	g.printf("digraph %s {\n", dotQuote(name))
+}
+
+func (g dotWriter) node(n models.Node) {
+	label := n.Title
+	if label == "" {
+		label = n.ID
+	}
+	g.printf("  %s [label=%s, title=%s, channel=%s, visits=%s, depth=%s];\n",
+		dotQuote(n.ID), dotQuote(label), dotQuote(n.Title), dotQuote(n.Channel), dotQuote(strconv.Itoa(n.Visits)), dotQuote(strconv.Itoa(n.Depth)))
+}
+
+func (g dotWriter) edges() {}
+
+func (g dotWriter) edge(id int, l models.NextLink) {
+	g.printf("  %s -> %s [position=%s, job=%s, timestamp=%s];\n",
+		dotQuote(l.ParentID), dotQuote(l.ID), dotQuote(strconv.Itoa(l.Number)), dotQuote(l.JobID), dotQuote(timestamp(l.VisitedAt)))
+}
+
+func (g dotWriter) end() {
+	g.printf("}\n")
+}
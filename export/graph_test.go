@@ -0,0 +1,116 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+var graphReader = memoryReader{path: []models.NextLink{
+	{ID: "aaa", JobID: "j1", Title: `Alpha <"&">`, Channel: "ch1", VisitedAt: visited},
+	{ID: "bbb", JobID: "j1", ParentID: "aaa", Title: "Beta", Channel: "ch2", Number: 1, VisitedAt: visited.Add(time.Minute)},
+	{ID: "aaa", JobID: "j1", ParentID: "bbb", Title: `Alpha <"&">`, Channel: "ch1", Number: 2, VisitedAt: visited.Add(2 * time.Minute)},
+}}
+
+// xmlElement is any XML element with its attributes and children
+type xmlElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr   `xml:",any,attr"`
+	Children []xmlElement `xml:",any"`
+	Text     string       `xml:",chardata"`
+}
+
+// find returns all descendants of e with given local name
+func (e xmlElement) find(name string) []xmlElement {
+	var found []xmlElement
+	for _, c := range e.Children {
+		if c.XMLName.Local == name {
+			found = append(found, c)
+		}
+		found = append(found, c.find(name)...)
+	}
+	return found
+}
+
+func (e xmlElement) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func exportGraph(t *testing.T, q store.LinkQuery, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Graph(&buf, graphReader, q, format); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGraphML(t *testing.T) {
+	var doc xmlElement
+	if err := xml.Unmarshal(exportGraph(t, store.LinkQuery{JobID: "j1"}, FormatGraphML), &doc); err != nil {
+		t.Fatal(err)
+	}
+	nodes, edges := doc.find("node"), doc.find("edge")
+	if len(nodes) != 2 || len(edges) != 2 {
+		t.Fatalf("Got %d nodes and %d edges, want 2 and 2", len(nodes), len(edges))
+	}
+	if data := nodes[0].Children; data[0].Text != `Alpha <"&">` || data[2].Text != "2" || data[3].Text != "0" {
+		t.Errorf("Got node %+v", nodes[0])
+	}
+	if e := edges[1]; e.attr("source") != "bbb" || e.attr("target") != "aaa" || e.Children[0].Text != "2" || e.Children[2].Text != "2020-01-02T03:06:05Z" {
+		t.Errorf("Got edge %+v", e)
+	}
+}
+
+func TestGEXF(t *testing.T) {
+	var doc xmlElement
+	if err := xml.Unmarshal(exportGraph(t, store.LinkQuery{JobID: "j1"}, FormatGEXF), &doc); err != nil {
+		t.Fatal(err)
+	}
+	nodes, edges := doc.find("node"), doc.find("edge")
+	if len(nodes) != 2 || len(edges) != 2 || nodes[0].attr("label") != `Alpha <"&">` || edges[0].attr("source") != "aaa" {
+		t.Errorf("Got nodes %+v and edges %+v", nodes, edges)
+	}
+}
+
+func TestDOT(t *testing.T) {
+	dot := string(exportGraph(t, store.LinkQuery{JobID: "j1"}, FormatDOT))
+	for _, want := range []string{
+		`digraph "job j1" {`,
+		`"aaa" [label="Alpha <\"&\">", title="Alpha <\"&\">", channel="ch1", visits="2", depth="0"];`,
+		`"aaa" -> "bbb" [position="1", job="j1", timestamp="2020-01-02T03:05:05Z"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Got\n%s\nwant line %s", dot, want)
+		}
+	}
+}
+
+func TestGraphTimeRange(t *testing.T) {
+	// only the visit of bbb is in range, edge from aaa visited before is dropped
+	q := store.LinkQuery{JobID: "j1", From: visited.Add(time.Second), To: visited.Add(90 * time.Second)}
+	var doc xmlElement
+	if err := xml.Unmarshal(exportGraph(t, q, FormatGraphML), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if nodes, edges := doc.find("node"), doc.find("edge"); len(nodes) != 1 || len(edges) != 0 {
+		t.Errorf("Got %d nodes and %d edges, want 1 and 0", len(nodes), len(edges))
+	}
+
+	if err := Graph(&bytes.Buffer{}, graphReader, store.LinkQuery{From: visited}, FormatDOT); err != store.ErrJobRequired {
+		t.Errorf("Got %v, want %v", err, store.ErrJobRequired)
+	}
+	if err := CheckGraph("svg"); err == nil {
+		t.Error("Got no error for unknown graph format")
+	}
+}
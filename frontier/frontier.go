@@ -0,0 +1,277 @@
+// Package frontier keeps jobs together with links they continue with in bbolt file,
+// so crawling of unfinished jobs is resumed after restart of the application
+package frontier
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	jobsBucket  = []byte("jobs")  // job ID -> record
+	pathsBucket = []byte("paths") // job ID -> bucket of visited links by their number
+)
+
+// Entry is saved job with link it continues with and links it visited
+type Entry struct {
+	Job     models.Job
+	Pending *models.NextLink  // link job continues with
+	Path    []models.NextLink // visited links in order of visiting
+}
+
+// record is value of job in jobs bucket
+type record struct {
+	Seq     uint64           `json:"seq"` // order of submission
+	Job     models.Job       `json:"job"`
+	Pending *models.NextLink `json:"pending,omitempty"`
+}
+
+// op is single queued change of frontier
+type op struct {
+	job     models.Job
+	pending *models.NextLink
+	visit   *models.NextLink // link added to path of job
+	remove  bool             // job is deleted with its path
+	flushed chan struct{}    // closed once all changes queued before it are written
+}
+
+// Frontier is bbolt file with jobs and their links
+// changes are queued and written by single background writer, all changes queued meanwhile are written
+// in one transaction, so callers never wait for disk
+type Frontier struct {
+	db  *bolt.DB
+	log *logrus.Logger
+
+	mu    sync.Mutex
+	queue []op
+	wake  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Open opens frontier file at path and starts its writer, file is created if it doesn't exist
+// file can be opened by single process only, Open fails if it's locked by another one
+func Open(path string, log *logrus.Logger) (*Frontier, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open frontier '%s': %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(jobsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(pathsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	f := &Frontier{db: db, log: log, wake: make(chan struct{}, 1), stop: make(chan struct{}), done: make(chan struct{})}
+	go f.run()
+	return f, nil
+}
+
+// SaveJob queues job with link it continues with to be saved
+func (f *Frontier) SaveJob(job models.Job, pending *models.NextLink) {
+	f.enqueue(op{job: job, pending: copyLink(pending)})
+}
+
+// SaveVisit queues link visited by job to be added to its path and job to be saved
+// link replaces visited link with the same number, so link visited again after restart isn't kept twice
+func (f *Frontier) SaveVisit(job models.Job, pending *models.NextLink, link models.NextLink) {
+	f.enqueue(op{job: job, pending: copyLink(pending), visit: &link})
+}
+
+// DeleteJob queues ended job to be deleted together with its path
+func (f *Frontier) DeleteJob(job models.Job) {
+	f.enqueue(op{job: job, remove: true})
+}
+
+// Flush waits until all queued changes are written
+func (f *Frontier) Flush() {
+	flushed := make(chan struct{})
+	f.enqueue(op{flushed: flushed})
+	<-flushed
+}
+
+func copyLink(link *models.NextLink) *models.NextLink {
+	if link == nil {
+		return nil
+	}
+	l := *link
+	return &l
+}
+
+func (f *Frontier) enqueue(o op) {
+	f.mu.Lock()
+	f.queue = append(f.queue, o)
+	f.mu.Unlock()
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run writes queued changes until frontier is closed
+func (f *Frontier) run() {
+	defer close(f.done)
+	for {
+		select {
+		case <-f.wake:
+			f.write()
+		case <-f.stop:
+			f.write()
+			return
+		}
+	}
+}
+
+// write writes all queued changes in single transaction, changes that fail to write are dropped
+func (f *Frontier) write() {
+	f.mu.Lock()
+	ops := f.queue
+	f.queue = nil
+	f.mu.Unlock()
+	if len(ops) == 0 {
+		return
+	}
+
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		for _, o := range ops {
+			var err error
+			switch {
+			case o.flushed != nil:
+				continue
+			case o.remove:
+				err = deleteJob(tx, o.job.ID)
+			case o.visit != nil:
+				err = putVisit(tx, o.job.ID, *o.visit)
+				if err == nil {
+					err = putJob(tx, o.job, o.pending)
+				}
+			default:
+				err = putJob(tx, o.job, o.pending)
+			}
+			if err != nil {
+				return fmt.Errorf("job '%s': %w", o.job.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		f.log.WithFields(logrus.Fields{
+			"err":     err.Error(),
+			"changes": len(ops),
+		}).Warn("Failed to write jobs to frontier")
+	}
+	for _, o := range ops {
+		if o.flushed != nil {
+			close(o.flushed)
+		}
+	}
+}
+
+// putVisit adds link to path of job
+func putVisit(tx *bolt.Tx, jobID string, link models.NextLink) error {
+	path, err := tx.Bucket(pathsBucket).CreateBucketIfNotExists([]byte(jobID))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(link.Number))
+	return path.Put(key, data)
+}
+
+// putJob saves job keeping its order of submission
+func putJob(tx *bolt.Tx, job models.Job, pending *models.NextLink) error {
+	jobs := tx.Bucket(jobsBucket)
+	r := record{Job: job, Pending: pending}
+	if data := jobs.Get([]byte(job.ID)); data != nil {
+		var saved record
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return err
+		}
+		r.Seq = saved.Seq
+	} else {
+		r.Seq, _ = jobs.NextSequence()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return jobs.Put([]byte(job.ID), data)
+}
+
+// deleteJob deletes job and its path, free pages are reused by later writes so file doesn't grow with ended jobs
+func deleteJob(tx *bolt.Tx, jobID string) error {
+	if err := tx.Bucket(jobsBucket).Delete([]byte(jobID)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(pathsBucket).DeleteBucket([]byte(jobID)); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	return nil
+}
+
+// Load returns all saved jobs in order of submission, queued changes are written first
+func (f *Frontier) Load() ([]Entry, error) {
+	f.Flush()
+	var records []record
+	var entries []Entry
+	err := f.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(jobsBucket).ForEach(func(id, data []byte) error {
+			var r record
+			if err := json.Unmarshal(data, &r); err != nil {
+				return fmt.Errorf("invalid job '%s': %w", id, err)
+			}
+			records = append(records, r)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].Seq < records[j].Seq })
+
+		paths := tx.Bucket(pathsBucket)
+		for _, r := range records {
+			e := Entry{Job: r.Job, Pending: r.Pending}
+			if path := paths.Bucket([]byte(r.Job.ID)); path != nil {
+				// keys are big endian numbers, so links are iterated in order of visiting
+				err := path.ForEach(func(_, data []byte) error {
+					var l models.NextLink
+					if err := json.Unmarshal(data, &l); err != nil {
+						return fmt.Errorf("invalid link of job '%s': %w", r.Job.ID, err)
+					}
+					e.Path = append(e.Path, l)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Close writes queued changes, stops the writer and closes frontier file
+func (f *Frontier) Close() error {
+	close(f.stop)
+	<-f.done
+	return f.db.Close()
+}
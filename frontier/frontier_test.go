@@ -0,0 +1,68 @@
+package frontier
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+func TestFrontier(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	path := filepath.Join(t.TempDir(), "frontier.db")
+	f, err := Open(path, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := models.Job{ID: "j1", Status: models.JobRunning}
+	second := models.Job{ID: "j0", Status: models.JobQueued}
+	ended := models.Job{ID: "j2", Status: models.JobRunning}
+	link := models.NextLink{ID: "aaa", JobID: "j1"}
+	f.SaveJob(first, &link)
+	f.SaveJob(second, &models.NextLink{ID: "zzz", JobID: "j0"})
+	f.SaveVisit(ended, &models.NextLink{ID: "yyy", JobID: "j2", Number: 1}, models.NextLink{ID: "xxx", JobID: "j2"})
+	next := models.NextLink{ID: "bbb", JobID: "j1", ParentID: "aaa", Number: 1}
+	first.Visited = 1
+	f.SaveVisit(first, &next, link)
+	// link visited again after restart replaces the saved one
+	link.Title = "Alpha"
+	f.SaveVisit(first, &next, link)
+	first.Status = models.JobPaused
+	f.SaveJob(first, &next)
+	ended.Status = models.JobCompleted
+	f.DeleteJob(ended)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = Open(path, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := Open(path, log); err == nil {
+		t.Error("Got no error opening locked frontier")
+	}
+	entries, err := f.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Job.ID != "j1" || entries[1].Job.ID != "j0" {
+		t.Fatalf("Got entries %+v, want j1 and j0 in order of submission", entries)
+	}
+	if e := entries[0]; e.Job.Status != models.JobPaused || e.Pending == nil || e.Pending.ID != "bbb" || len(e.Path) != 1 || e.Path[0].Title != "Alpha" {
+		t.Errorf("Got %+v", e)
+	}
+	if e := entries[1]; e.Pending == nil || e.Pending.ID != "zzz" || len(e.Path) != 0 {
+		t.Errorf("Got %+v", e)
+	}
+	// path of deleted job is deleted too, so the job saved again starts with empty path
+	f.SaveJob(models.Job{ID: "j2", Status: models.JobRunning}, nil)
+	if entries, _ := f.Load(); len(entries) != 3 || len(entries[2].Path) != 0 {
+		t.Errorf("Got %+v", entries)
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"golang.org/x/net/websocket"
+)
+
+// Commands accepted over control channel
+const (
+	cmdAddSeed = "add_seed"
+	cmdPause   = "pause"
+	cmdResume  = "resume"
+	cmdCancel  = "cancel"
+	cmdSetRate = "set_rate"
+	cmdJobs    = "jobs"
+)
+
+// Types of messages sent over control channel
+const (
+	msgResponse = "response"
+	msgEvent    = "event"
+)
+
+// controlCommand is command sent by client over control channel
+type controlCommand struct {
+	ID      string       `json:"id"` // correlation ID copied to the response
+	Command string       `json:"command"`
+	JobID   string       `json:"job_id,omitempty"` // job to pause, resume or cancel
+	Seed    *models.Seed `json:"seed,omitempty"`   // seed to add
+	Rate    *float64     `json:"rate,omitempty"`   // requests per second, 0 removes the limit
+}
+
+// controlMessage is response to command or crawler event sent to client over control channel
+type controlMessage struct {
+	Type  string        `json:"type"`
+	ID    string        `json:"id,omitempty"`
+	OK    bool          `json:"ok,omitempty"`
+	Error string        `json:"error,omitempty"`
+	Job   *models.Job   `json:"job,omitempty"`
+	Jobs  []models.Job  `json:"jobs,omitempty"`
+	Rate  *float64      `json:"rate,omitempty"`
+	Event *events.Event `json:"event,omitempty"`
+}
+
+// controlHandler serves WebSocket control channel
+// streams crawler events, optionally only of job given by 'job' query parameter,
+// and executes commands add_seed, pause, resume, cancel, set_rate and jobs sent as JSON messages
+// every command gets response with the same 'id' so client can pair them
+func controlHandler(c *crawler.Crawler) http.Handler {
+	return websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			serveControl(c, ws)
+		},
+	}
+}
+
+// checkSameOrigin rejects browser connections from other sites, clients not sending Origin are accepted
+func checkSameOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return errors.New("cross origin WebSocket connection is not allowed")
+	}
+	config.Origin = u
+	return nil
+}
+
+func serveControl(c *crawler.Crawler, ws *websocket.Conn) {
+	defer ws.Close()
+	// server read and write timeouts must not close the channel
+	ws.SetDeadline(time.Time{})
+
+	jobID := ws.Request().URL.Query().Get("job")
+	subscription := c.Events.Subscribe(500)
+	defer subscription.Close()
+
+	responses := make(chan controlMessage, 10)
+	writerDone := make(chan struct{})
+	readerDone := make(chan struct{})
+	defer close(readerDone)
+
+	go func() {
+		defer close(writerDone)
+		for {
+			var msg controlMessage
+			select {
+			case <-readerDone:
+				return
+			case msg = <-responses:
+			case e, ok := <-subscription.C:
+				if !ok {
+					return
+				}
+				if jobID != "" && e.JobID != jobID {
+					continue
+				}
+				msg = controlMessage{Type: msgEvent, Event: &e}
+			}
+			if err := websocket.JSON.Send(ws, msg); err != nil {
+				ws.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		var cmd controlCommand
+		var response controlMessage
+		err := websocket.JSON.Receive(ws, &cmd)
+		switch err.(type) {
+		case nil:
+			response = executeCommand(c, cmd)
+		case *json.SyntaxError, *json.UnmarshalTypeError:
+			response = controlMessage{Type: msgResponse, Error: "invalid command: " + err.Error()}
+		default:
+			return
+		}
+
+		select {
+		case responses <- response:
+		case <-writerDone:
+			return
+		}
+	}
+}
+
+// executeCommand runs command on crawler and returns response to it
+func executeCommand(c *crawler.Crawler, cmd controlCommand) controlMessage {
+	response := controlMessage{Type: msgResponse, ID: cmd.ID}
+	var job models.Job
+	var err error
+
+	switch cmd.Command {
+	case cmdAddSeed:
+		if cmd.Seed == nil {
+			err = errors.New("missing seed")
+			break
+		}
+		job, err = c.Submit(*cmd.Seed)
+	case cmdPause:
+		job, err = c.Pause(cmd.JobID)
+	case cmdResume:
+		job, err = c.Resume(cmd.JobID)
+	case cmdCancel:
+		job, err = c.Cancel(cmd.JobID)
+	case cmdSetRate:
+		if cmd.Rate == nil {
+			err = errors.New("missing rate")
+			break
+		}
+		if err = c.SetRate(*cmd.Rate); err == nil {
+			rate := c.Rate()
+			response.Rate = &rate
+		}
+	case cmdJobs:
+		response.Jobs = c.Jobs()
+	default:
+		err = errors.New("unknown command '" + cmd.Command + "'")
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+		return response
+	}
+	if job.ID != "" {
+		response.Job = &job
+	}
+	response.OK = true
+	return response
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"golang.org/x/net/websocket"
+)
+
+func TestControl(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	c := crawler.New(nil, config.CrawlerConfig{NumOfGoroutines: 1, NumOfCrawls: 5}, nil, ioutil.Discard, log)
+	m := http.NewServeMux()
+	SetHandlers(m, c, log)
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/control", "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect; reason: %s", err)
+	}
+	defer ws.Close()
+
+	var seenEvents []events.Type
+	send := func(t *testing.T, cmd controlCommand) controlMessage {
+		t.Helper()
+		if err := websocket.JSON.Send(ws, cmd); err != nil {
+			t.Fatalf("Failed to send command; reason: %s", err)
+		}
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var msg controlMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				t.Fatalf("Failed to receive response; reason: %s", err)
+			}
+			if msg.Type == msgEvent {
+				seenEvents = append(seenEvents, msg.Event.Type)
+				continue
+			}
+			if msg.ID != cmd.ID {
+				t.Fatalf("Got response to '%s', want '%s'", msg.ID, cmd.ID)
+			}
+			return msg
+		}
+	}
+
+	res := send(t, controlCommand{ID: "1", Command: cmdAddSeed, Seed: &models.Seed{Link: "DT61L8hbbJ4"}})
+	if !res.OK || res.Job == nil || res.Job.Status != models.JobRunning {
+		t.Fatalf("Got %+v, want running job", res)
+	}
+	jobID := res.Job.ID
+
+	for _, tt := range []struct {
+		cmd        string
+		wantStatus models.JobStatus
+	}{
+		{cmdPause, models.JobPaused},
+		{cmdResume, models.JobRunning},
+		{cmdCancel, models.JobCancelled},
+	} {
+		res = send(t, controlCommand{ID: tt.cmd, Command: tt.cmd, JobID: jobID})
+		if !res.OK || res.Job.Status != tt.wantStatus {
+			t.Errorf("Got %+v for '%s', want job with status '%s'", res, tt.cmd, tt.wantStatus)
+		}
+	}
+
+	rate := 2.5
+	res = send(t, controlCommand{ID: "rate", Command: cmdSetRate, Rate: &rate})
+	if !res.OK || *res.Rate != rate || c.Rate() != rate {
+		t.Errorf("Got %+v, want rate %v", res, rate)
+	}
+
+	res = send(t, controlCommand{ID: "unknown", Command: "explode"})
+	if res.OK || res.Error == "" {
+		t.Errorf("Got %+v, want error", res)
+	}
+
+	res = send(t, controlCommand{ID: "missing", Command: cmdPause, JobID: "missing"})
+	if res.Error != crawler.ErrJobNotFound.Error() {
+		t.Errorf("Got %+v, want '%s'", res, crawler.ErrJobNotFound)
+	}
+
+	wantEvents := []events.Type{events.JobStarted, events.JobPaused, events.JobResumed, events.JobCancelled}
+	if strings.Join(typeNames(seenEvents), ",") != strings.Join(typeNames(wantEvents), ",") {
+		t.Errorf("Got events %v, want %v", seenEvents, wantEvents)
+	}
+}
+
+func typeNames(types []events.Type) []string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return names
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/static"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/views"
+)
+
+// templateFuncs are helpers available in dashboard templates
+var templateFuncs = template.FuncMap{
+	"total":     total,
+	"progress":  progress,
+	"thumbnail": thumbnail,
+}
+
+// pages holds parsed dashboard pages, each page is layout combined with its content template
+var pages = map[string]*template.Template{
+	"index": parsePage("index.gohtml"),
+	"job":   parsePage("job.gohtml"),
+	"graph": parsePage("graph.gohtml"),
+}
+
+func parsePage(name string) *template.Template {
+	return template.Must(template.New(name).Funcs(templateFuncs).ParseFS(views.FS, "layout.gohtml", name))
+}
+
+// indexData is passed to index page
+type indexData struct {
+	Jobs       []models.Job
+	Iterations int
+	Error      string
+}
+
+// jobData is passed to job detail page
+type jobData struct {
+	Job  models.Job
+	Path []models.NextLink
+}
+
+// graphData is passed to graph page
+type graphData struct {
+	Jobs  []models.Job
+	Job   string // selected job
+	Depth string // selected max depth
+}
+
+// setDashboardHandlers registers web dashboard pages and their static assets
+func setDashboardHandlers(m *http.ServeMux, c *crawler.Crawler) {
+	m.HandleFunc("/", dashboardHandler(c))
+	m.HandleFunc("/jobs", seedFormHandler(c))
+	m.HandleFunc("/jobs/", jobPageHandler(c))
+	m.HandleFunc("/graph", graphPageHandler(c))
+
+	m.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(static.FS))))
+}
+
+// renders list of jobs with seed form, any other path than root returns StatusNotFound - 404
+func dashboardHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			renderIndex(w, c, http.StatusOK, "")
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// accepts POST from seed form on dashboard, on success redirects to job detail page
+// invalid seed renders dashboard again with error and StatusBadRequest - 400
+func seedFormHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		case "POST":
+			if err := r.ParseForm(); err != nil {
+				renderIndex(w, c, http.StatusBadRequest, "Invalid form: "+err.Error())
+				return
+			}
+			seed := models.Seed{
+				Link:  strings.TrimSpace(r.PostForm.Get("link")),
+				Label: strings.TrimSpace(r.PostForm.Get("label")),
+			}
+			if n := r.PostForm.Get("n_of_iterations"); n != "" {
+				iterations, err := strconv.Atoi(n)
+				if err != nil || iterations < 0 {
+					renderIndex(w, c, http.StatusBadRequest, "Invalid number of iterations: "+n)
+					return
+				}
+				seed.NOfIterations = iterations
+			}
+			job, err := c.Submit(seed)
+			if err != nil {
+				renderIndex(w, c, http.StatusBadRequest, "Invalid seed: "+err.Error())
+				return
+			}
+			http.Redirect(w, r, "/jobs/"+job.ID, http.StatusSeeOther)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// renders job detail with chain of visited videos, unknown job returns StatusNotFound - 404
+func jobPageHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+			job, path, ok := c.JobPath(id)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			render(w, "job", http.StatusOK, jobData{Job: job, Path: path})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// renders graph of visited videos, graph data are loaded by script from /api/v1/graph
+func graphPageHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			render(w, "graph", http.StatusOK, graphData{
+				Jobs:  c.Jobs(),
+				Job:   r.URL.Query().Get("job"),
+				Depth: r.URL.Query().Get("depth"),
+			})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func renderIndex(w http.ResponseWriter, c *crawler.Crawler, status int, errMsg string) {
+	jobs := c.Jobs()
+	// newest jobs first
+	for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+		jobs[i], jobs[j] = jobs[j], jobs[i]
+	}
+	render(w, "index", status, indexData{Jobs: jobs, Iterations: c.Configuration.NumOfCrawls, Error: errMsg})
+}
+
+func render(w http.ResponseWriter, page string, status int, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := pages[page].ExecuteTemplate(w, "layout", data); err != nil {
+		w.Write([]byte(err.Error()))
+	}
+}
+
+// total returns number of videos job visits when it runs to the end
+func total(job models.Job) int {
+	return job.Seed.NOfIterations + 1
+}
+
+// progress returns percentage of visited videos
+func progress(job models.Job) int {
+	p := job.Visited * 100 / total(job)
+	if p > 100 || job.Status == models.JobCompleted {
+		return 100
+	}
+	return p
+}
+
+// thumbnail returns URL of video thumbnail
+func thumbnail(videoID string) string {
+	return "https://i.ytimg.com/vi/" + videoID + "/mqdefault.jpg"
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// deadLettersHandler GET method returns links that failed to store, oldest first
+// returns StatusNotImplemented - 501 if dead-letter file isn't configured
+func deadLettersHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		deadLetters := c.StoreManager.DeadLetters
+		if deadLetters == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte(store.ErrNoDeadLetters.Error()))
+			return
+		}
+		letters, err := deadLetters.List()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Failed to read dead letters: " + err.Error()))
+			return
+		}
+		if letters == nil {
+			letters = []store.DeadLetter{}
+		}
+		writeJSON(w, http.StatusOK, letters)
+	}
+}
+
+// replayHandler POST method stores links from dead-letter file to the store again and returns number of replayed and failed links,
+// links that fail again are kept in the file. Returns StatusServiceUnavailable - 503 if store isn't healthy
+// and StatusConflict - 409 if another replay is running
+func replayHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		result, err := c.StoreManager.ReplayDeadLetters()
+		switch {
+		case err == nil:
+			fmt.Printf("Replayed %d dead letters, %d failed again\n", result.Replayed, result.Failed)
+			writeJSON(w, http.StatusOK, result)
+		case errors.Is(err, store.ErrNoDeadLetters):
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte(err.Error()))
+		case errors.Is(err, store.ErrReplaying):
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(err.Error()))
+		case errors.Is(err, store.ErrUnhealthy):
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Failed to replay dead letters: " + err.Error()))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Failed to replay dead letters: " + err.Error()))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+)
+
+// heartbeatInterval is how often comment is sent to keep idle event stream open
+const heartbeatInterval = 15 * time.Second
+
+// eventsHandler streams crawler events as Server-Sent Events
+// optional 'job' query parameter limits stream to events of single job, repeated 'type' parameter to given event types
+// event name is event type and data is event in JSON format
+func eventsHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Streaming not supported"))
+			return
+		}
+
+		jobID := r.URL.Query().Get("job")
+		var types []events.Type
+		for _, t := range r.URL.Query()["type"] {
+			types = append(types, events.Type(t))
+		}
+		subscription := c.Events.Subscribe(500, types...)
+		defer subscription.Close()
+
+		// stream is open for as long as client wants, server write timeout must not close it
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		id := 0
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case e, ok := <-subscription.C:
+				if !ok {
+					return
+				}
+				if jobID != "" && e.JobID != jobID {
+					continue
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				id++
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, e.Type, data)
+			}
+			flusher.Flush()
+		}
+	}
+}
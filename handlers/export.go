@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/export"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// GET /api/v1/jobs/{id}/export streams dataset of job as file
+// query parameter format is csv (default) or parquet, dataset is edges (default) or videos,
+// graph formats graphml, gexf and dot export recommendation graph of job instead
+// returns StatusBadRequest - 400 for unsupported format or dataset, StatusNotFound - 404 if job is neither known to crawler nor stored,
+// StatusNotImplemented - 501 if store can't be read
+func jobExport(w http.ResponseWriter, r *http.Request, c *crawler.Crawler, id string, log *logrus.Logger) {
+	format, dataset := r.URL.Query().Get("format"), r.URL.Query().Get("dataset")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if dataset == "" {
+		dataset = export.DatasetEdges
+	}
+	graph := export.CheckGraph(format) == nil
+	if err := export.Check(dataset, format); err != nil && !graph {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	reader, ok := c.StoreManager.Reader()
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("Store can't be read"))
+		return
+	}
+	if _, known := c.Job(id); !known {
+		page, err := reader.Videos(store.VideoQuery{JobID: id, Limit: 1})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Failed to read store: " + err.Error()))
+			return
+		}
+		if len(page.Videos) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	if graph {
+		exportGraph(w, reader, store.LinkQuery{JobID: id}, "job-"+id, format, log)
+		return
+	}
+
+	// export of big job can take longer than write timeout of the server
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="job-`+id+`-`+dataset+`.`+format+`"`)
+	if err := export.Job(w, reader, id, dataset, format); err != nil {
+		// rows may be streamed already so status can't be changed, the client gets truncated file
+		log.WithFields(logrus.Fields{
+			"jobID":   id,
+			"dataset": dataset,
+			"format":  format,
+			"err":     err.Error(),
+		}).Warn("Failed to export job")
+	}
+}
+
+// graphExport streams recommendation graph read from store in format given by query parameter
+// query parameters job, from and to (RFC 3339 time) select links, at least job is required unless store is DB
+func graphExport(w http.ResponseWriter, r *http.Request, c *crawler.Crawler, format string, log *logrus.Logger) {
+	if err := export.CheckGraph(format); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	query := r.URL.Query()
+	q := store.LinkQuery{JobID: query.Get("job")}
+	var err error
+	if q.From, q.To, err = timeRange(query); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	reader, ok := c.StoreManager.Reader()
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("Store can't be read"))
+		return
+	}
+	if _, isScanner := reader.(store.Scanner); !isScanner && q.JobID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(store.ErrJobRequired.Error()))
+		return
+	}
+	name := "graph"
+	if q.JobID != "" {
+		name = "job-" + q.JobID
+	}
+	exportGraph(w, reader, q, name, format, log)
+}
+
+// timeRange returns times of `from` and `to` query parameters in RFC 3339 format, missing ones are zero
+func timeRange(query url.Values) (from, to time.Time, err error) {
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := query.Get(bound.name); v != "" {
+			if *bound.t, err = time.Parse(time.RFC3339, v); err != nil {
+				return from, to, errors.New("Invalid " + bound.name + ", use RFC 3339 time: " + v)
+			}
+		}
+	}
+	return from, to, nil
+}
+
+// exportGraph streams graph of links matching query as attachment named by name
+// graph may be streamed partly already, so failure is only logged
+func exportGraph(w http.ResponseWriter, reader store.Reader, q store.LinkQuery, name, format string, log *logrus.Logger) {
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", export.GraphContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.`+format+`"`)
+	if err := export.Graph(w, reader, q, format); err != nil {
+		log.WithFields(logrus.Fields{
+			"jobID":  q.JobID,
+			"from":   q.From,
+			"to":     q.To,
+			"format": format,
+			"err":    err.Error(),
+		}).Warn("Failed to export graph")
+	}
+}
@@ -1,20 +1,39 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
-	"html/template"
 	"io/ioutil"
 	"net/http"
 	"net/http/pprof"
+	"strconv"
+	"strings"
 
+	"github.com/sirupsen/logrus"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/seeds"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/webhooks"
 )
 
-// SetHandlers registers all handlers with ServeMux
-func SetHandlers(m *http.ServeMux, c *crawler.Crawler) {
-	m.HandleFunc("/", index)
+// maxBatchSize limits size of seed list accepted by batchHandler
+const maxBatchSize = 10 << 20
+
+// SetHandlers registers all handlers with ServeMux, log gets failures that can't be reported to the client
+func SetHandlers(m *http.ServeMux, c *crawler.Crawler, log *logrus.Logger) {
+	setDashboardHandlers(m, c)
 	m.HandleFunc("/api/v1/link", linkHandler(c))
+	m.HandleFunc("/api/v1/jobs", jobsHandler(c))
+	m.HandleFunc("/api/v1/jobs/", jobHandler(c, log))
+	m.HandleFunc("/api/v1/jobs:batch", batchHandler(c))
+	m.HandleFunc("/api/v1/videos", videosHandler(c))
+	m.HandleFunc("/api/v1/videos/", videoHandler(c))
+	m.HandleFunc("/api/v1/graph", graphHandler(c, log))
+	m.HandleFunc("/api/v1/events", eventsHandler(c))
+	m.HandleFunc("/api/v1/store", storeHandler(c))
+	m.HandleFunc("/api/v1/store/dead-letters", deadLettersHandler(c))
+	m.HandleFunc("/api/v1/store/dead-letters/replay", replayHandler(c))
+	m.Handle("/api/v1/control", controlHandler(c))
 	m.HandleFunc("/api/v1/stop", stopAll(c))
 
 	m.HandleFunc("/debug/pprof/", pprof.Index)
@@ -25,13 +44,13 @@ func SetHandlers(m *http.ServeMux, c *crawler.Crawler) {
 
 }
 
-//TODO should be used for landing page, so far used for testing tamplates
-func index(w http.ResponseWriter, r *http.Request) {
-	tpl := template.Must(template.ParseFiles("./views/index.gohtml"))
-	tpl.Execute(w, "Vilda")
+// SetWebhookHandlers registers handlers listing webhooks and their deliveries
+func SetWebhookHandlers(m *http.ServeMux, n *webhooks.Notifier) {
+	m.HandleFunc("/api/v1/webhooks", webhooksHandler(n))
+	m.HandleFunc("/api/v1/webhooks/deliveries", deliveriesHandler(n))
 }
 
-// accepts POST method to add new link for crawling if successful returns StatusCreated - 201 else StatusBadRequest 400
+// accepts POST method to add new link for crawling if successful returns StatusCreated - 201 with created job else StatusBadRequest 400
 // GET method returns http.StatusMethodNotAllowed - 405
 // default response set to http.StatusInternalServerError - 500
 func linkHandler(crawler *crawler.Crawler) http.HandlerFunc {
@@ -46,17 +65,225 @@ func linkHandler(crawler *crawler.Crawler) http.HandlerFunc {
 			if err != nil || len(body) < 1 {
 				w.WriteHeader(http.StatusBadRequest)
 				w.Write([]byte("Invalid payload"))
-			} else {
-				link := models.NewNextLink(string(body), crawler.Configuration.NumOfCrawls)
-				crawler.Add(link)
-				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			job, err := crawler.Submit(models.Seed{Link: string(body)})
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Invalid payload: " + err.Error()))
+				return
 			}
+			writeJSON(w, http.StatusCreated, job)
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 	}
 }
 
+// GET /api/v1/jobs/{id}/path returns links stored by job ordered by iteration
+// returns StatusNotFound - 404 if job is neither known to crawler nor stored, StatusNotImplemented - 501 if store can't be read
+func jobPath(w http.ResponseWriter, r *http.Request, c *crawler.Crawler, id string) {
+	reader, ok := c.StoreManager.Reader()
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("Store can't be read"))
+		return
+	}
+	path, err := reader.Path(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Failed to read store: " + err.Error()))
+		return
+	}
+	if _, known := c.Job(id); len(path) == 0 && !known {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, path)
+}
+
+// jobsHandler GET method returns all jobs
+// POST method accepts seed in JSON format and returns StatusCreated - 201 with created job, StatusBadRequest - 400 if seed is invalid
+func jobsHandler(crawler *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, crawler.Jobs())
+		case "POST":
+			var seed models.Seed
+			if err := json.NewDecoder(r.Body).Decode(&seed); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Invalid payload: " + err.Error()))
+				return
+			}
+			job, err := crawler.Submit(seed)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Invalid payload: " + err.Error()))
+				return
+			}
+			writeJSON(w, http.StatusCreated, job)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// jobActions are actions on single job available at `/api/v1/jobs/{id}/{action}`
+var jobActions = map[string]func(*crawler.Crawler, string) (models.Job, error){
+	"cancel": (*crawler.Crawler).Cancel,
+	"pause":  (*crawler.Crawler).Pause,
+	"resume": (*crawler.Crawler).Resume,
+}
+
+// jobHandler serves single job at `/api/v1/jobs/{id}`
+// GET `/api/v1/jobs/{id}` returns job, POST `/api/v1/jobs/{id}/cancel`, `/pause` or `/resume` changes it
+// returns StatusNotFound - 404 if there is no such job, StatusConflict - 409 if changed job already ended
+func jobHandler(c *crawler.Crawler, log *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/"), "/")
+		id := parts[0]
+
+		switch {
+		case len(parts) == 1 && r.Method == "GET":
+			job, ok := c.Job(id)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			writeJSON(w, http.StatusOK, job)
+		case len(parts) == 2 && parts[1] == "path" && r.Method == "GET":
+			jobPath(w, r, c, id)
+		case len(parts) == 2 && parts[1] == "export" && r.Method == "GET":
+			jobExport(w, r, c, id, log)
+		case len(parts) == 2 && jobActions[parts[1]] != nil && r.Method == "POST":
+			job, err := jobActions[parts[1]](c, id)
+			switch err {
+			case nil:
+				writeJSON(w, http.StatusOK, job)
+			case crawler.ErrJobNotFound:
+				http.NotFound(w, r)
+			default:
+				writeJSON(w, http.StatusConflict, job)
+			}
+		case len(parts) == 1 || (len(parts) == 2 && (jobActions[parts[1]] != nil || parts[1] == "path" || parts[1] == "export")):
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// batchHandler accepts POST method with list of seeds in JSON, CSV or NDJSON format
+// format is taken from 'format' query parameter or Content-Type header, if neither is set it's detected from payload
+// returns StatusOK - 200 with result for each row, StatusBadRequest - 400 if the list can't be read at all
+func batchHandler(crawler *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Only POST method supported"))
+			return
+		}
+
+		format := seeds.Format(r.URL.Query().Get("format"))
+		if format == "" {
+			format = seeds.FormatFor(r.Header.Get("Content-Type"))
+		}
+
+		rows, err := seeds.Parse(http.MaxBytesReader(w, r.Body, maxBatchSize), format)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid payload: " + err.Error()))
+			return
+		}
+		writeJSON(w, http.StatusOK, seeds.Submit(rows, crawler))
+	}
+}
+
+// webhooksHandler GET method returns configured webhooks without their secrets
+func webhooksHandler(n *webhooks.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, n.Webhooks())
+	}
+}
+
+// deliveriesHandler GET method returns webhook delivery log, newest first
+// can be filtered by 'job' and 'status' (pending, delivered, failed) query parameters
+func deliveriesHandler(n *webhooks.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		writeJSON(w, http.StatusOK, n.Deliveries(query.Get("job"), query.Get("status")))
+	}
+}
+
+// graphHandler GET method returns graph of visited videos, optional `job` query parameter limits graph to single job
+// and `depth` to videos visited at most at that iteration, unknown job returns StatusNotFound - 404
+// `format` graphml, gexf or dot streams graph of stored links selected by `job`, `from` and `to` instead
+func graphHandler(c *crawler.Crawler, log *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			query := r.URL.Query()
+			if format := query.Get("format"); format != "" && format != "json" {
+				graphExport(w, r, c, format, log)
+				return
+			}
+			depth := -1
+			if d := query.Get("depth"); d != "" {
+				var err error
+				depth, err = strconv.Atoi(d)
+				if err != nil || depth < 0 {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte("Invalid depth: " + d))
+					return
+				}
+			}
+			graph, ok := c.Graph(query.Get("job"), depth)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Job not found"))
+				return
+			}
+			writeJSON(w, http.StatusOK, graph)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// storeHandler GET method returns stored links and error counters of every store destination,
+// destinations are empty if data are stored to single backend
+func storeHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"destinations": c.StoreManager.Destinations()})
+	}
+}
+
+// writeJSON writes v as JSON response with given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
 // stopAll calls Crawler.Stop which stops all crawling threads
 func stopAll(crawler *crawler.Crawler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// videoDetail is response of videoHandler
+type videoDetail struct {
+	Video  models.Video      `json:"video"`
+	Visits []models.NextLink `json:"visits"`
+}
+
+// videosHandler GET method returns page of stored videos
+// query parameters job, channel, q (part of title) and min_visits filter videos,
+// sort is one of id, title, channel or visits, prefixed with '-' for descending order,
+// limit sets page size and cursor takes next_cursor of previous page
+// returns StatusBadRequest - 400 for invalid parameters, StatusNotImplemented - 501 if store can't be read
+func videosHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		reader, ok := c.StoreManager.Reader()
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte("Store can't be read"))
+			return
+		}
+
+		query, err := videoQuery(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		page, err := reader.Videos(query)
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, page)
+		case errors.Is(err, store.ErrInvalidCursor), errors.Is(err, store.ErrInvalidSort):
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Failed to read store: " + err.Error()))
+		}
+	}
+}
+
+// videoHandler GET method returns stored video with all its visits, StatusNotFound - 404 if video isn't stored
+// `/api/v1/videos/{id}/history` returns metadata observations of video instead
+func videoHandler(c *crawler.Crawler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		reader, ok := c.StoreManager.Reader()
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte("Store can't be read"))
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/v1/videos/")
+		if id, ok := strings.CutSuffix(id, "/history"); ok {
+			videoHistory(w, r, reader, id)
+			return
+		}
+		video, visits, err := reader.Video(id)
+		switch err {
+		case nil:
+			writeJSON(w, http.StatusOK, videoDetail{Video: video, Visits: visits})
+		case store.ErrNotFound:
+			http.NotFound(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Failed to read store: " + err.Error()))
+		}
+	}
+}
+
+// videoQuery makes store.VideoQuery from request query parameters
+func videoQuery(r *http.Request) (store.VideoQuery, error) {
+	params := r.URL.Query()
+	q := store.VideoQuery{
+		JobID:   params.Get("job"),
+		Channel: params.Get("channel"),
+		Title:   params.Get("q"),
+		Cursor:  params.Get("cursor"),
+	}
+	q.Sort = strings.TrimPrefix(params.Get("sort"), "-")
+	q.Desc = strings.HasPrefix(params.Get("sort"), "-")
+
+	var err error
+	if v := params.Get("min_visits"); v != "" {
+		if q.MinVisits, err = strconv.Atoi(v); err != nil {
+			return q, errors.New("Invalid min_visits: " + v)
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 {
+			return q, errors.New("Invalid limit: " + v)
+		}
+	}
+	return q, nil
+}
+
+// videoHistory returns title, channel, views and likes of video seen on its page by every fetch, oldest first,
+// each observation lists fields changed since the previous one. Query parameters from and to (RFC 3339 time) limit time range,
+// field (title, channel, views or likes) returns only observations that changed it
+// returns StatusBadRequest - 400 for invalid parameters, StatusNotImplemented - 501 if store doesn't keep observations
+func videoHistory(w http.ResponseWriter, r *http.Request, reader store.Reader, id string) {
+	history, ok := reader.(store.HistoryReader)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("Store doesn't keep history of videos"))
+		return
+	}
+	query := r.URL.Query()
+	q := store.HistoryQuery{VideoID: id, Field: query.Get("field")}
+	var err error
+	if q.From, q.To, err = timeRange(query); err == nil {
+		err = store.CheckField(q.Field)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	observations, err := history.History(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Failed to read store: " + err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, observations)
+}
@@ -0,0 +1,17 @@
+// Package testutil contains helpers shared by tests of several packages
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+// WaitFor polls cond until it's true or timeout elapses
+func WaitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); !cond(); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+	}
+}
@@ -1,30 +1,37 @@
 package main
 
 import (
-	"context"
 	"fmt"
-	"net/http"
 	"os"
-	"os/signal"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/sirupsen/logrus"
-	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
-	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
-	"github.com/vildapavlicek/GoLang/youtubeCrawler/handlers"
-	"github.com/vildapavlicek/GoLang/youtubeCrawler/parsers"
-	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
-
-	_ "net/http/pprof"
 
 	"github.com/joho/godotenv"
 )
 
-var firstLink = "/watch?v=DT61L8hbbJ4"
-var secondLink = "/watch?v=Q3oItpVa9fs"
-
 var log = logrus.New()
 
+// command is single subcommand of the application, run returns exit code
+type command struct {
+	run   func(args []string) int
+	usage string
+}
+
+var commands = map[string]command{
+	"serve":      {serveCommand, "start HTTP server and crawl links submitted over the API (default)"},
+	"crawl":      {crawlCommand, "crawl from given seeds without starting the server and exit once all of them finish"},
+	"submit":     {submitCommand, "submit links to running server"},
+	"batch":      {batchCommand, "submit seed files in JSON, CSV or NDJSON format to running server"},
+	"status":     {statusCommand, "print status of jobs on running server"},
+	"cancel":     {cancelCommand, "cancel jobs on running server"},
+	"export":     {exportCommand, "export jobs from running server as JSON, dataset of job from store as CSV or Parquet or graph as GraphML, GEXF or DOT"},
+	"parse":      {parseCommand, "run youTube parser on local HTML file and print parsed next video"},
+	"migrate":    {migrateCommand, "apply pending DB migrations, -status prints applied and pending ones"},
+	"replay-dlq": {replayCommand, "store links from dead-letter file again, by running server or directly with -local"},
+}
+
 func init() {
 	file, err := os.OpenFile("logs", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 
@@ -35,7 +42,7 @@ func init() {
 
 	err = godotenv.Load()
 	if err != nil {
-		fmt.Println("Failed to load '.env' config file. All values will be set to default if not set as system environment variable")
+		fmt.Fprintln(os.Stderr, "Failed to load '.env' config file. All values will be set to default if not set as system environment variable")
 		log.WithFields(logrus.Fields{
 			"err": err.Error(),
 		}).Info(".env couldn't be open")
@@ -43,52 +50,34 @@ func init() {
 }
 
 func main() {
-
-	stop := make(chan os.Signal, 1)
-	go catchSignal(stop)
-
-	conf := config.New()
-	m := http.NewServeMux()
-	server := &http.Server{
-		Addr:         ":8080",
-		Handler:      m,
-		ReadTimeout:  60 * time.Second,
-		WriteTimeout: 60 * time.Second,
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	storeManager := store.New(conf.StoreConfig, log)
-	defer storeManager.StoreDestination.Close()
-
-	monster := crawler.New(storeManager, conf.CrawlerConfig, parsers.YoutubeParser{Log: log}, os.Stdout, log)
-	go monster.Run()
-
-	handlers.SetHandlers(m, monster)
-	go startServer(server)
-
-	for {
-		select {
-		case <-storeManager.Shutdown:
-			fmt.Println("Server shutting down")
-			server.Shutdown(context.TODO())
-			os.Exit(1)
-		case <-stop:
-			monster.Stop()
-		default:
-		}
+	if name == "help" {
+		printUsage()
+		return
 	}
-}
 
-func startServer(s *http.Server) {
-	fmt.Printf("Starting server at addr: %s\n", s.Addr)
-	log.WithFields(logrus.Fields{
-		"Addr": s.Addr,
-	}).Debug("Server listening")
-	err := s.ListenAndServe()
-	if err != nil {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'\n", name)
+		printUsage()
+		os.Exit(2)
 	}
-
+	os.Exit(cmd.run(args))
 }
 
-func catchSignal(stopChan chan os.Signal) {
-	signal.Notify(stopChan, os.Interrupt)
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s COMMAND -h' for flags of the command\n", os.Args[0])
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// migrateCommand applies pending DB migrations or prints their status
+func migrateCommand(args []string) int {
+	conf := config.New()
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	status := flags.Bool("status", false, "print applied and pending migrations without applying them")
+	flags.StringVar(&conf.StoreConfig.TablePrefix, "prefix", conf.StoreConfig.TablePrefix, "prefix of table names")
+	flags.Parse(args)
+
+	db, dialect, err := store.OpenDB(conf.StoreConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to DB, reason: %s\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	if *status {
+		migrations, err := store.MigrationsStatus(db, dialect, conf.StoreConfig.TablePrefix)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migrations, reason: %s\n", err)
+			return 1
+		}
+		for _, m := range migrations {
+			applied := "pending"
+			if m.Applied != "" {
+				applied = "applied at " + m.Applied
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, applied)
+		}
+		return 0
+	}
+
+	applied, err := store.Migrate(db, dialect, conf.StoreConfig.TablePrefix)
+	for _, m := range applied {
+		fmt.Printf("Applied migration %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed, reason: %s\n", err)
+		log.WithFields(logrus.Fields{
+			"err": err.Error(),
+		}).Error("Migration failed")
+		return 1
+	}
+	if len(applied) == 0 {
+		fmt.Println("DB is up to date")
+	}
+	return 0
+}
@@ -1,35 +1,276 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
+	"time"
 )
 
+const watchPrefix = "/watch?v="
+
+var videoIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// ErrInvalidLink returned when link to video can't be recognized
+var ErrInvalidLink = errors.New("invalid video link")
+
 // NextLink struct to hold data about video link
 type NextLink struct {
-	Title         string `json:"title"` // Title of the video
-	BaseURL       string `json:"baseUrl"`
-	Link          string `json:"link"`            // Link URL suffix `/watch?v=P-Xz-IeijSw`
-	Number        int    `json:"number"`          // Number of iteration that data were received
-	ID            string `json:"id"`              // ID string taken from Link in format `P-Xz-IeijSw`
-	NOfIterations int    `json:"n_of_iterations"` // Number of link to crawl from origin (first link)
-	Stop          bool   // Deceprated
+	Title         string    `json:"title"` // Title of the video
+	BaseURL       string    `json:"baseUrl"`
+	Link          string    `json:"link"`            // Link URL suffix `/watch?v=P-Xz-IeijSw`
+	Number        int       `json:"number"`          // Number of iteration that data were received
+	ID            string    `json:"id"`              // ID string taken from Link in format `P-Xz-IeijSw`
+	JobID         string    `json:"job_id"`          // ID of the Job this link was crawled by
+	ParentID      string    `json:"parent_id"`       // ID of the video this link was recommended by, empty for first link
+	Channel       string    `json:"channel"`         // Name of the channel that uploaded the video
+	VisitedAt     time.Time `json:"visited_at"`      // Time the link was visited by crawler
+	NOfIterations int       `json:"n_of_iterations"` // Number of link to crawl from origin (first link)
+	Stop          bool      // Deceprated
 }
 
 // NewNextLink used to create first link to start crawling from
 func NewNextLink(firstLink string, numberOfIterations int) NextLink {
-	fmt.Printf("Num of iterations is %v\n", numberOfIterations)
 	if numberOfIterations == 0 {
 		numberOfIterations = 100
 	}
-	title := strings.Split(firstLink, "=")
+	link, id, err := NormalizeLink(firstLink)
+	if err != nil {
+		link = firstLink
+	}
 	return NextLink{
 		Title:         "",
-		Link:          firstLink,
+		Link:          link,
 		BaseURL:       "https://www.youtube.com",
 		Number:        0,
-		ID:            title[1],
+		ID:            id,
 		NOfIterations: numberOfIterations,
 		Stop:          false,
 	}
 }
+
+// NormalizeLink accepts full youTube URL, short youtu.be URL, link suffix `/watch?v=P-Xz-IeijSw` or bare video ID
+// and returns link suffix together with video ID
+func NormalizeLink(s string) (link, id string, err error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case videoIDRegexp.MatchString(s):
+		id = s
+	case strings.HasPrefix(s, watchPrefix):
+		id = ParseVideoID(s)
+	default:
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", "", ErrInvalidLink
+		}
+		if strings.HasSuffix(u.Host, "youtu.be") {
+			id = strings.TrimPrefix(u.Path, "/")
+		} else {
+			id = u.Query().Get("v")
+		}
+	}
+
+	if !videoIDRegexp.MatchString(id) {
+		return "", "", ErrInvalidLink
+	}
+	return watchPrefix + id, id, nil
+}
+
+// ParseVideoID returns video ID from link suffix `/watch?v=P-Xz-IeijSw`, empty string if link has no ID
+func ParseVideoID(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("v")
+}
+
+// Seed is link to start crawling from with its per-seed options
+type Seed struct {
+	Link          string `json:"link"`                      // Link to the first video, see NormalizeLink for accepted formats
+	NOfIterations int    `json:"n_of_iterations,omitempty"` // Number of links to crawl, crawler default if 0
+	Label         string `json:"label,omitempty"`           // Optional label to recognize job by
+}
+
+// JobStatus describes state of the Job
+type JobStatus string
+
+// Job statuses
+const (
+	JobQueued       JobStatus = "queued"        // waiting for free capacity
+	JobRunning      JobStatus = "running"       // being crawled
+	JobPaused       JobStatus = "paused"        // paused by user, can be resumed
+	JobCompleted    JobStatus = "completed"     // crawled all iterations
+	JobFailed       JobStatus = "failed"        // chain ended because video couldn't be fetched or parsed
+	JobCancelled    JobStatus = "cancelled"     // cancelled by user
+	JobLoopDetected JobStatus = "loop_detected" // chain got to the video it already visited
+)
+
+// Ended returns true if job with this status won't be crawled anymore
+func (s JobStatus) Ended() bool {
+	return s != JobQueued && s != JobRunning && s != JobPaused
+}
+
+// Job is single crawling chain started from Seed
+type Job struct {
+	ID      string     `json:"id"`
+	Seed    Seed       `json:"seed"`
+	VideoID string     `json:"video_id"` // ID of the first video
+	Status  JobStatus  `json:"status"`
+	Visited int        `json:"visited"` // number of visited videos
+	Created time.Time  `json:"created"`
+	Started *time.Time `json:"started,omitempty"`
+	Ended   *time.Time `json:"ended,omitempty"`
+	Error   string     `json:"error,omitempty"` // reason why job failed
+}
+
+// NewJobID returns new random job ID
+func NewJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// FetchAttempt is single request for video page
+type FetchAttempt struct {
+	JobID      string        `json:"job_id"`
+	VideoID    string        `json:"video_id"`
+	URL        string        `json:"url"`
+	StatusCode int           `json:"status_code"` // 0 if no response was received
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Time       time.Time     `json:"time"` // time request was sent
+}
+
+// Metadata fields of Observation
+const (
+	FieldTitle   = "title"
+	FieldChannel = "channel"
+	FieldViews   = "views"
+	FieldLikes   = "likes"
+)
+
+// Observation is metadata of video seen on its page by single fetch
+type Observation struct {
+	VideoID    string    `json:"video_id"`
+	JobID      string    `json:"job_id"`
+	ObservedAt time.Time `json:"observed_at"`
+	Title      string    `json:"title"`
+	Channel    string    `json:"channel"`
+	Views      *int64    `json:"views"` // nil if it wasn't on the page
+	Likes      *int64    `json:"likes"`
+	Changed    []string  `json:"changed"` // fields that differ from the previous observation of the video
+}
+
+// Diff returns fields of o that differ from previous observation prev, fields that weren't on the page are skipped
+// all known fields differ if there is no previous observation
+func (o Observation) Diff(prev *Observation) []string {
+	changed := []string{}
+	if o.Title != "" && (prev == nil || prev.Title != o.Title) {
+		changed = append(changed, FieldTitle)
+	}
+	if o.Channel != "" && (prev == nil || prev.Channel != o.Channel) {
+		changed = append(changed, FieldChannel)
+	}
+	if o.Views != nil && (prev == nil || prev.Views == nil || *prev.Views != *o.Views) {
+		changed = append(changed, FieldViews)
+	}
+	if o.Likes != nil && (prev == nil || prev.Likes == nil || *prev.Likes != *o.Likes) {
+		changed = append(changed, FieldLikes)
+	}
+	return changed
+}
+
+// Video is stored video aggregated from all its visits
+type Video struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"` // title and channel of the latest visit, older visits only fill missing ones
+	Channel   string     `json:"channel"`
+	Visits    int        `json:"visits"` // number of stored visits
+	Jobs      int        `json:"jobs"`   // number of jobs that visited video
+	FirstSeen *time.Time `json:"first_seen,omitempty"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+}
+
+// Graph holds visited videos and recommendations between them
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Node is single video in Graph
+type Node struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Channel string   `json:"channel"`
+	Visits  int      `json:"visits"` // how many times video was visited
+	Depth   int      `json:"depth"`  // lowest number of iteration video was visited at
+	Jobs    []string `json:"jobs"`   // IDs of jobs that visited video
+}
+
+// Edge is recommendation from Source video to Target video
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Weight int    `json:"weight"` // how many times the recommendation was followed
+}
+
+// BuildGraph makes Graph from visited links, links deeper than maxDepth are skipped, negative maxDepth means no limit
+func BuildGraph(links []NextLink, maxDepth int) Graph {
+	g := Graph{Nodes: []Node{}, Edges: []Edge{}}
+	nodes := make(map[string]int)
+	edges := make(map[[2]string]int)
+	for _, link := range links {
+		if link.ID == "" || (maxDepth >= 0 && link.Number > maxDepth) {
+			continue
+		}
+		i, ok := nodes[link.ID]
+		if !ok {
+			i = len(g.Nodes)
+			nodes[link.ID] = i
+			g.Nodes = append(g.Nodes, Node{ID: link.ID, Depth: link.Number})
+		}
+		node := &g.Nodes[i]
+		node.Visits++
+		if link.Title != "" {
+			node.Title = link.Title
+		}
+		if link.Channel != "" {
+			node.Channel = link.Channel
+		}
+		if link.Number < node.Depth {
+			node.Depth = link.Number
+		}
+		if link.JobID != "" && !contains(node.Jobs, link.JobID) {
+			node.Jobs = append(node.Jobs, link.JobID)
+		}
+
+		if link.ParentID == "" {
+			continue
+		}
+		key := [2]string{link.ParentID, link.ID}
+		e, ok := edges[key]
+		if !ok {
+			e = len(g.Edges)
+			edges[key] = e
+			g.Edges = append(g.Edges, Edge{Source: link.ParentID, Target: link.ID})
+		}
+		g.Edges[e].Weight++
+	}
+	return g
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package models
+
+import "testing"
+
+func TestBuildGraph(t *testing.T) {
+	links := []NextLink{
+		{ID: "a", Number: 0, JobID: "j1", Title: "A"},
+		{ID: "b", Number: 1, JobID: "j1", ParentID: "a", Channel: "ch1"},
+		{ID: "c", Number: 2, JobID: "j1", ParentID: "b"},
+		{ID: "a", Number: 0, JobID: "j2"},
+		{ID: "b", Number: 1, JobID: "j2", ParentID: "a", Title: "B"},
+	}
+
+	t.Run("all links", func(t *testing.T) {
+		g := BuildGraph(links, -1)
+		if len(g.Nodes) != 3 || len(g.Edges) != 2 {
+			t.Fatalf("Got %d nodes and %d edges, want 3 and 2", len(g.Nodes), len(g.Edges))
+		}
+		b := g.Nodes[1]
+		if b.ID != "b" || b.Visits != 2 || b.Title != "B" || b.Channel != "ch1" || len(b.Jobs) != 2 {
+			t.Errorf("Got node %+v", b)
+		}
+		if e := g.Edges[0]; e.Source != "a" || e.Target != "b" || e.Weight != 2 {
+			t.Errorf("Got edge %+v, want a -> b with weight 2", e)
+		}
+	})
+
+	t.Run("max depth", func(t *testing.T) {
+		g := BuildGraph(links, 1)
+		if len(g.Nodes) != 2 || len(g.Edges) != 1 {
+			t.Errorf("Got %d nodes and %d edges, want 2 and 1", len(g.Nodes), len(g.Edges))
+		}
+	})
+}
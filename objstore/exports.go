@@ -0,0 +1,109 @@
+package objstore
+
+import (
+	"io"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/export"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// exportSettle is how long job has to be ended before it's exported, so its last links are stored
+const exportSettle = 30 * time.Second
+
+// Exporter uploads datasets and graph of every job that ended since the previous run
+// files of job are uploaded as exports/<job ID>/<date job ended>/edges.<format>, videos.<format> and graph.graphml
+type Exporter struct {
+	sink   *Sink
+	reader store.Reader
+	jobs   func() []models.Job
+	format string // format of datasets, csv or parquet
+	settle time.Duration
+	last   time.Time       // jobs that ended before this time were exported, except failed ones
+	failed map[string]bool // IDs of jobs that failed to export, they're tried again by the next export
+}
+
+// NewExporter returns Exporter of jobs listed by jobs and read from reader, jobs that ended before now aren't exported
+func NewExporter(sink *Sink, reader store.Reader, jobs func() []models.Job, format string) (*Exporter, error) {
+	if err := export.Check(export.DatasetEdges, format); err != nil {
+		return nil, err
+	}
+	return &Exporter{sink: sink, reader: reader, jobs: jobs, format: format, settle: exportSettle, last: time.Now(), failed: make(map[string]bool)}, nil
+}
+
+// Run exports ended jobs every interval until the sink is closed
+func (e *Exporter) Run(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.sink.stop:
+			return
+		case <-ticker.C:
+			e.Export(time.Now())
+		}
+	}
+}
+
+// Export uploads files of jobs that ended since the previous export and at least settle before now,
+// jobs that failed to export before are tried again. Returns number of exported jobs
+func (e *Exporter) Export(now time.Time) int {
+	until := now.Add(-e.settle)
+	if !until.After(e.last) && len(e.failed) == 0 {
+		return 0
+	}
+	exported := 0
+	for _, job := range e.jobs() {
+		if job.Ended == nil {
+			continue
+		}
+		inWindow := !job.Ended.Before(e.last) && job.Ended.Before(until)
+		if !inWindow && !e.failed[job.ID] {
+			continue
+		}
+		if err := e.exportJob(job); err != nil {
+			e.failed[job.ID] = true
+			e.sink.log.WithFields(logrus.Fields{
+				"jobID": job.ID,
+				"err":   err.Error(),
+			}).Warn("Failed to export job")
+			continue
+		}
+		delete(e.failed, job.ID)
+		exported++
+	}
+	if until.After(e.last) {
+		e.last = until
+	}
+	return exported
+}
+
+// exportJob writes all files of job to spool directory
+func (e *Exporter) exportJob(job models.Job) error {
+	for _, dataset := range []string{export.DatasetEdges, export.DatasetVideos} {
+		err := e.put(ExportKey(job.ID, *job.Ended, dataset+"."+e.format), func(w io.Writer) error {
+			return export.Job(w, e.reader, job.ID, dataset, e.format)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return e.put(ExportKey(job.ID, *job.Ended, "graph."+export.FormatGraphML), func(w io.Writer) error {
+		return export.Graph(w, e.reader, store.LinkQuery{JobID: job.ID}, export.FormatGraphML)
+	})
+}
+
+// put writes object with key by write and queues it for upload
+func (e *Exporter) put(key string, write func(w io.Writer) error) error {
+	o, err := e.sink.Create(key)
+	if err != nil {
+		return err
+	}
+	if err := write(o); err != nil {
+		o.Abort()
+		return err
+	}
+	return o.Commit()
+}
@@ -0,0 +1,420 @@
+// Package objstore uploads raw pages and export files to S3 compatible bucket like MinIO
+// every object is written to local spool directory first and removed once it's uploaded,
+// so objects survive unavailable endpoint and restart of the application
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/export"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// tmpPrefix marks spool files that are still being written
+const tmpPrefix = ".tmp-"
+
+// uploaders is number of objects uploaded at once
+const uploaders = 2
+
+// uploadTimeout is max time of single upload attempt
+const uploadTimeout = 10 * time.Minute
+
+// backoff is wait after the first failed upload attempt, it doubles with every next attempt
+var backoff = time.Second
+
+// minPartSizeMB is the smallest part of multipart upload S3 accepts
+const minPartSizeMB = 5
+
+// Options configures Sink
+type Options struct {
+	Endpoint    string // host:port of S3 API, e.g. 127.0.0.1:9000 for local MinIO
+	Bucket      string // bucket is created if it doesn't exist
+	Region      string
+	AccessKey   string
+	SecretKey   string
+	Secure      bool          // use HTTPS
+	Prefix      string        // prepended to key of every object
+	SpoolDir    string        // objects are kept here until they are uploaded
+	PartSizeMB  int           // objects bigger than this are uploaded by multipart upload in parts of this size
+	MaxAttempts int           // number of attempts to upload object before it's left for the next retry
+	RetryEvery  time.Duration // how often objects left in spool directory are uploaded again
+}
+
+// Stats are counters of Sink since it was started
+type Stats struct {
+	Uploaded int64 `json:"uploaded"` // objects uploaded
+	Failed   int64 `json:"failed"`   // failed upload attempts
+	Spooled  int64 `json:"spooled"`  // objects written to spool directory
+}
+
+// Sink uploads objects from spool directory to bucket
+// objects are uploaded by background workers with exponential backoff between attempts,
+// objects that run out of attempts stay in spool directory and are tried again every RetryEvery
+type Sink struct {
+	opts   Options
+	client *minio.Client
+
+	queue  chan string // spool paths of objects waiting for upload
+	mu     sync.Mutex
+	queued map[string]bool // spool paths in queue or being uploaded
+
+	bucketMu sync.Mutex // guards bucket check, it's separate from mu so enqueue never waits for endpoint
+	bucket   bool       // bucket was checked to exist
+
+	stats Stats
+	stop  chan struct{}
+	wg    sync.WaitGroup
+	log   *logrus.Logger
+}
+
+// New returns Sink uploading to bucket, objects left in spool directory by previous run are uploaded first
+// endpoint that is down isn't error, objects wait in spool directory until it's reachable
+func New(opts Options, log *logrus.Logger) (*Sink, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" || opts.SpoolDir == "" {
+		return nil, fmt.Errorf("missing S3 endpoint, bucket or spool directory")
+	}
+	if opts.PartSizeMB < minPartSizeMB {
+		opts.PartSizeMB = minPartSizeMB
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.RetryEvery <= 0 {
+		opts.RetryEvery = 30 * time.Second
+	}
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure:       opts.Secure,
+		Region:       opts.Region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.SpoolDir, 0755); err != nil {
+		return nil, err
+	}
+	// objects that were being written when the application stopped are incomplete
+	if tmp, err := filepath.Glob(filepath.Join(opts.SpoolDir, tmpPrefix+"*")); err == nil {
+		for _, f := range tmp {
+			os.Remove(f)
+		}
+	}
+
+	s := &Sink{
+		opts:   opts,
+		client: client,
+		queue:  make(chan string, 1000),
+		queued: make(map[string]bool),
+		stop:   make(chan struct{}),
+		log:    log,
+	}
+	for i := 0; i < uploaders; i++ {
+		s.wg.Add(1)
+		go s.upload()
+	}
+	s.wg.Add(1)
+	go s.retryLoop()
+	fmt.Printf("Uploading objects to bucket '%s' at '%s'\n", opts.Bucket, opts.Endpoint)
+	return s, nil
+}
+
+// Object is object being written to spool directory, it's queued for upload by Commit
+type Object struct {
+	*os.File
+	sink *Sink
+	key  string
+}
+
+// Create returns Object that is uploaded with key once it's written and committed
+func (s *Sink) Create(key string) (*Object, error) {
+	file, err := ioutil.TempFile(s.opts.SpoolDir, tmpPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{File: file, sink: s, key: key}, nil
+}
+
+// Commit closes object and queues it for upload
+func (o *Object) Commit() error {
+	if err := o.File.Close(); err != nil {
+		os.Remove(o.Name())
+		return err
+	}
+	spooled := o.sink.spoolPath(o.key)
+	var err error
+	// directory can be removed by upload of the last object in it meanwhile, so it's created again
+	for i := 0; i < 2; i++ {
+		if err = os.MkdirAll(filepath.Dir(spooled), 0755); err == nil {
+			if err = os.Rename(o.Name(), spooled); !os.IsNotExist(err) {
+				break
+			}
+		}
+	}
+	if err != nil {
+		os.Remove(o.Name())
+		return err
+	}
+	atomic.AddInt64(&o.sink.stats.Spooled, 1)
+	o.sink.enqueue(spooled)
+	return nil
+}
+
+// Abort closes and removes object that won't be uploaded
+func (o *Object) Abort() {
+	o.File.Close()
+	os.Remove(o.Name())
+}
+
+// Put queues data for upload with key
+func (s *Sink) Put(key string, data []byte) error {
+	o, err := s.Create(key)
+	if err != nil {
+		return err
+	}
+	if _, err := o.Write(data); err != nil {
+		o.Abort()
+		return err
+	}
+	return o.Commit()
+}
+
+// ArchivePage queues raw HTML of link fetched at given time for upload, see PageKey
+func (s *Sink) ArchivePage(link models.NextLink, fetchedAt time.Time, page []byte) {
+	key := PageKey(link, fetchedAt)
+	if err := s.Put(key, page); err != nil {
+		s.log.WithFields(logrus.Fields{
+			"key": key,
+			"err": err.Error(),
+		}).Warn("Failed to spool page")
+	}
+}
+
+// Stats returns counters of the sink
+func (s *Sink) Stats() Stats {
+	return Stats{
+		Uploaded: atomic.LoadInt64(&s.stats.Uploaded),
+		Failed:   atomic.LoadInt64(&s.stats.Failed),
+		Spooled:  atomic.LoadInt64(&s.stats.Spooled),
+	}
+}
+
+// Close stops uploads, objects that weren't uploaded yet are kept in spool directory for the next run
+func (s *Sink) Close() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// PageKey returns key of raw HTML of link, pages are grouped by job and date they were fetched at:
+// pages/<job ID>/<yyyy-mm-dd>/<number>-<video ID>-<hhmmss>.html
+func PageKey(link models.NextLink, fetchedAt time.Time) string {
+	fetchedAt = fetchedAt.UTC()
+	name := fmt.Sprintf("%04d-%s-%s.html", link.Number, link.ID, fetchedAt.Format("150405"))
+	return path.Join("pages", jobDir(link.JobID), fetchedAt.Format("2006-01-02"), name)
+}
+
+// ExportKey returns key of export file of job ended at given time: exports/<job ID>/<yyyy-mm-dd>/<name>
+func ExportKey(jobID string, ended time.Time, name string) string {
+	return path.Join("exports", jobDir(jobID), ended.UTC().Format("2006-01-02"), name)
+}
+
+// jobDir is directory of job in keys, links without job are kept together
+func jobDir(jobID string) string {
+	if jobID == "" {
+		return "no-job"
+	}
+	return jobID
+}
+
+// spoolPath returns path object with key is kept at in spool directory
+func (s *Sink) spoolPath(key string) string {
+	return filepath.Join(s.opts.SpoolDir, filepath.FromSlash(key))
+}
+
+// enqueue queues spooled object for upload unless it's already queued,
+// object isn't queued if queue is full, the next retry picks it up
+func (s *Sink) enqueue(spooled string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queued[spooled] {
+		return
+	}
+	select {
+	case s.queue <- spooled:
+		s.queued[spooled] = true
+	default:
+	}
+}
+
+func (s *Sink) dequeue(spooled string) {
+	s.mu.Lock()
+	delete(s.queued, spooled)
+	s.mu.Unlock()
+}
+
+// upload uploads queued objects until the sink is closed
+func (s *Sink) upload() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case spooled := <-s.queue:
+			s.uploadSpooled(spooled)
+			s.dequeue(spooled)
+		}
+	}
+}
+
+// uploadSpooled uploads single object, retries with exponential backoff until it succeeds or runs out of attempts
+func (s *Sink) uploadSpooled(spooled string) {
+	rel, err := filepath.Rel(s.opts.SpoolDir, spooled)
+	if err != nil {
+		return
+	}
+	key := path.Join(s.opts.Prefix, filepath.ToSlash(rel))
+
+	wait := backoff
+	for attempt := 1; attempt <= s.opts.MaxAttempts; attempt++ {
+		err := s.put(key, spooled)
+		if err == nil {
+			atomic.AddInt64(&s.stats.Uploaded, 1)
+			s.removeSpooled(spooled)
+			s.log.WithField("key", key).Trace("Uploaded object")
+			return
+		}
+		if os.IsNotExist(err) {
+			return
+		}
+		atomic.AddInt64(&s.stats.Failed, 1)
+		s.log.WithFields(logrus.Fields{
+			"key":     key,
+			"attempt": attempt,
+			"err":     err.Error(),
+		}).Warn("Failed to upload object")
+
+		if attempt < s.opts.MaxAttempts {
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+	}
+}
+
+// put uploads file with key, files bigger than part size are uploaded by multipart upload
+func (s *Sink) put(key, file string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	if err := s.ensureBucket(ctx); err != nil {
+		return err
+	}
+	_, err := s.client.FPutObject(ctx, s.opts.Bucket, key, file, minio.PutObjectOptions{
+		ContentType: contentType(key),
+		PartSize:    uint64(s.opts.PartSizeMB) << 20,
+	})
+	return err
+}
+
+// ensureBucket creates bucket the first time it's needed
+func (s *Sink) ensureBucket(ctx context.Context) error {
+	s.bucketMu.Lock()
+	defer s.bucketMu.Unlock()
+	if s.bucket {
+		return nil
+	}
+	exists, err := s.client.BucketExists(ctx, s.opts.Bucket)
+	if err == nil && !exists {
+		err = s.client.MakeBucket(ctx, s.opts.Bucket, minio.MakeBucketOptions{Region: s.opts.Region})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set up bucket '%s': %w", s.opts.Bucket, err)
+	}
+	s.bucket = true
+	return nil
+}
+
+// removeSpooled removes uploaded object and directories of spool that are left empty
+func (s *Sink) removeSpooled(spooled string) {
+	if err := os.Remove(spooled); err != nil {
+		s.log.WithFields(logrus.Fields{
+			"path": spooled,
+			"err":  err.Error(),
+		}).Warn("Failed to remove uploaded object from spool")
+		return
+	}
+	root := filepath.Clean(s.opts.SpoolDir)
+	for dir := filepath.Dir(spooled); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// retryLoop queues objects left in spool directory right away and then every RetryEvery
+func (s *Sink) retryLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.RetryEvery)
+	defer ticker.Stop()
+	for {
+		if err := s.requeue(); err != nil {
+			s.log.WithFields(logrus.Fields{
+				"path": s.opts.SpoolDir,
+				"err":  err.Error(),
+			}).Warn("Failed to read spool directory")
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// requeue queues all objects in spool directory
+func (s *Sink) requeue() error {
+	return filepath.Walk(s.opts.SpoolDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// object was uploaded and removed meanwhile
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), tmpPrefix) {
+			return nil
+		}
+		s.enqueue(p)
+		return nil
+	})
+}
+
+// contentType returns MIME type by extension of key
+func contentType(key string) string {
+	ext := path.Ext(key)
+	switch format := strings.TrimPrefix(ext, "."); format {
+	case export.FormatCSV, export.FormatParquet:
+		return export.ContentType(format)
+	case export.FormatGraphML, export.FormatGEXF, export.FormatDOT:
+		return export.GraphContentType(format)
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,318 @@
+package objstore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/internal/testutil"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+func init() {
+	// failures are retried by Sink, not by client
+	minio.MaxRetry = 1
+	backoff = 10 * time.Millisecond
+}
+
+// fakeS3 is S3 API with path-style buckets that keeps objects in memory, it fails the next `failures` requests
+type fakeS3 struct {
+	mu        sync.Mutex
+	buckets   map[string]bool
+	objects   map[string][]byte
+	uploads   map[string]map[int][]byte // parts of multipart uploads by upload ID
+	multipart int                       // number of completed multipart uploads
+	failures  int
+	hang      chan struct{} // bucket checks wait until it's closed if it's set
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: map[string]bool{}, objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.hang != nil && r.Method == "HEAD" {
+		<-f.hang
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `<Error><Code>ServiceUnavailable</Code><Message>down</Message></Error>`)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket, key := parts[0], ""
+	if len(parts) > 1 && parts[1] != "" {
+		key = bucket + "/" + parts[1]
+	}
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == "HEAD":
+		if !f.buckets[bucket] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case key == "" && r.Method == "PUT":
+		f.buckets[bucket] = true
+	case r.Method == "POST" && query.Has("uploads"):
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, bucket, parts[1], id)
+	case r.Method == "PUT" && query.Has("uploadId"):
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		f.uploads[query.Get("uploadId")][n] = readPayload(r)
+		w.Header().Set("ETag", fmt.Sprintf(`"part%d"`, n))
+	case r.Method == "POST" && query.Has("uploadId"):
+		upload := f.uploads[query.Get("uploadId")]
+		numbers := make([]int, 0, len(upload))
+		for n := range upload {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var data []byte
+		for _, n := range numbers {
+			data = append(data, upload[n]...)
+		}
+		f.objects[key] = data
+		f.multipart++
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`, bucket, parts[1])
+	case r.Method == "PUT":
+		f.objects[key] = readPayload(r)
+		w.Header().Set("ETag", `"object"`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// readPayload reads request body, body sent in signed chunks over plain HTTP is decoded
+func readPayload(r *http.Request) []byte {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		b, _ := ioutil.ReadAll(r.Body)
+		return b
+	}
+	var data []byte
+	body := bufio.NewReader(r.Body)
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			return data
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(strings.SplitN(line, ";", 2)[0]), 16, 64)
+		if err != nil || size == 0 {
+			return data
+		}
+		chunk := make([]byte, size)
+		io.ReadFull(body, chunk)
+		data = append(data, chunk...)
+		body.ReadString('\n')
+	}
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.objects[key]
+	return b, ok
+}
+
+func (f *fakeS3) fail(n int) {
+	f.mu.Lock()
+	f.failures = n
+	f.mu.Unlock()
+}
+
+func newTestSink(t *testing.T, s3 *fakeS3, spool string) *Sink {
+	srv := httptest.NewServer(s3)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	sink, err := New(Options{Endpoint: u.Host, Bucket: "crawler", Region: "us-east-1", AccessKey: "key", SecretKey: "secret",
+		Prefix: "test", SpoolDir: spool, PartSizeMB: 5, MaxAttempts: 2, RetryEvery: 50 * time.Millisecond}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sink.Close)
+	return sink
+}
+
+// spooled returns files left in spool directory
+func spooled(t *testing.T, dir string) []string {
+	var files []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files
+}
+
+func TestSink(t *testing.T) {
+	s3, spool := newFakeS3(), t.TempDir()
+	sink := newTestSink(t, s3, spool)
+	fetched := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	sink.ArchivePage(models.NextLink{ID: "KR-eV7fHNbM", JobID: "j1", Number: 3}, fetched, []byte("<html></html>"))
+	key := "crawler/test/pages/j1/2020-01-02/0003-KR-eV7fHNbM-030405.html"
+	testutil.WaitFor(t, "page upload", func() bool { _, ok := s3.object(key); return ok })
+	if b, _ := s3.object(key); string(b) != "<html></html>" {
+		t.Errorf("Got %q", b)
+	}
+	testutil.WaitFor(t, "spool cleanup", func() bool { return len(spooled(t, spool)) == 0 })
+
+	t.Run("big object is uploaded in parts", func(t *testing.T) {
+		data := bytes.Repeat([]byte("0123456789"), 600*1024)
+		if err := sink.Put("exports/j1/2020-01-02/edges.csv", data); err != nil {
+			t.Fatal(err)
+		}
+		key := "crawler/test/exports/j1/2020-01-02/edges.csv"
+		testutil.WaitFor(t, "multipart upload", func() bool { _, ok := s3.object(key); return ok })
+		if b, _ := s3.object(key); !bytes.Equal(b, data) || s3.multipart != 1 {
+			t.Errorf("Got %d bytes by %d multipart uploads, want %d bytes by 1", len(b), s3.multipart, len(data))
+		}
+	})
+
+	t.Run("object is kept in spool until endpoint is back", func(t *testing.T) {
+		s3.fail(1000)
+		sink.Put("a.html", []byte("a"))
+		testutil.WaitFor(t, "failed attempts", func() bool { return sink.Stats().Failed >= 2 })
+		if files := spooled(t, spool); len(files) != 1 {
+			t.Fatalf("Got %v in spool", files)
+		}
+		s3.fail(0)
+		testutil.WaitFor(t, "retried upload", func() bool { _, ok := s3.object("crawler/test/a.html"); return ok })
+		// object is in bucket before the upload is counted
+		testutil.WaitFor(t, "counted upload", func() bool { return sink.Stats().Uploaded == 3 })
+		if stats := sink.Stats(); stats.Spooled != 3 {
+			t.Errorf("Got %+v", stats)
+		}
+	})
+}
+
+func TestSinkDoesNotBlockOnSlowEndpoint(t *testing.T) {
+	s3 := newFakeS3()
+	s3.hang = make(chan struct{})
+	sink := newTestSink(t, s3, t.TempDir())
+	defer close(s3.hang)
+
+	sink.Put("a.html", []byte("a"))
+	done := make(chan struct{})
+	go func() {
+		// first object waits for bucket check, the next ones must be queued without waiting for it
+		for i := 0; i < 3; i++ {
+			sink.Put(fmt.Sprintf("b%d.html", i), []byte("b"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Put blocked by bucket check of hanging endpoint")
+	}
+}
+
+func TestSinkRecoversSpool(t *testing.T) {
+	spool := t.TempDir()
+	os.MkdirAll(filepath.Join(spool, "pages", "j1"), 0755)
+	ioutil.WriteFile(filepath.Join(spool, "pages", "j1", "left.html"), []byte("left"), 0644)
+	ioutil.WriteFile(filepath.Join(spool, tmpPrefix+"123"), []byte("partial"), 0644)
+
+	s3 := newFakeS3()
+	newTestSink(t, s3, spool)
+	testutil.WaitFor(t, "upload of left object", func() bool { _, ok := s3.object("crawler/test/pages/j1/left.html"); return ok })
+	testutil.WaitFor(t, "spool cleanup", func() bool { return len(spooled(t, spool)) == 0 })
+}
+
+// pathReader serves links of single job and no videos, reading path fails while fail is positive
+// other methods of store.Reader aren't used by exporter
+type pathReader struct {
+	store.Reader
+	path []models.NextLink
+	fail *int32
+}
+
+func (m pathReader) Videos(q store.VideoQuery) (store.VideoPage, error) {
+	return store.VideoPage{}, nil
+}
+
+func (m pathReader) Path(jobID string) ([]models.NextLink, error) {
+	if m.fail != nil && atomic.AddInt32(m.fail, -1) >= 0 {
+		return nil, errors.New("database is locked")
+	}
+	return m.path, nil
+}
+
+func TestExporter(t *testing.T) {
+	s3 := newFakeS3()
+	sink := newTestSink(t, s3, t.TempDir())
+	start := time.Now()
+	ended := start.Add(time.Minute)
+	jobs := []models.Job{
+		{ID: "j1", Status: models.JobCompleted, Ended: &ended},
+		{ID: "j2", Status: models.JobRunning},
+	}
+	reader := pathReader{path: []models.NextLink{{ID: "aaa", JobID: "j1"}, {ID: "bbb", JobID: "j1", ParentID: "aaa", Number: 1}}}
+	e, err := NewExporter(sink, reader, func() []models.Job { return jobs }, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.last = start
+
+	if n := e.Export(ended.Add(e.settle / 2)); n != 0 {
+		t.Errorf("Got %d jobs exported before they settled", n)
+	}
+	if n := e.Export(ended.Add(e.settle + time.Second)); n != 1 {
+		t.Fatalf("Got %d exported jobs, want 1", n)
+	}
+	if n := e.Export(ended.Add(2 * e.settle)); n != 0 {
+		t.Errorf("Got job exported again")
+	}
+
+	prefix := "crawler/test/exports/j1/" + ended.UTC().Format("2006-01-02") + "/"
+	for _, name := range []string{"edges.csv", "videos.csv", "graph.graphml"} {
+		testutil.WaitFor(t, name, func() bool { _, ok := s3.object(prefix + name); return ok })
+	}
+	if b, _ := s3.object(prefix + "edges.csv"); !strings.Contains(string(b), "j1,1,aaa,bbb") {
+		t.Errorf("Got edges %s", b)
+	}
+
+	t.Run("failed job is exported again", func(t *testing.T) {
+		failures := int32(1)
+		ended := e.last.Add(time.Second)
+		jobs = []models.Job{{ID: "j3", Status: models.JobCompleted, Ended: &ended}}
+		e.reader = pathReader{path: reader.path, fail: &failures}
+		if n := e.Export(ended.Add(e.settle + time.Second)); n != 0 {
+			t.Fatalf("Got %d exported jobs, want export to fail", n)
+		}
+		if n := e.Export(ended.Add(2*e.settle + time.Minute)); n != 1 {
+			t.Fatalf("Got %d exported jobs, want failed job exported again", n)
+		}
+		if n := e.Export(ended.Add(3*e.settle + time.Minute)); n != 0 {
+			t.Errorf("Got job exported again after it succeeded")
+		}
+	})
+
+	if _, err := NewExporter(sink, reader, nil, "xlsx"); err == nil {
+		t.Error("Got no error for unsupported format")
+	}
+}
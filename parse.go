@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/parsers"
+)
+
+// parsedPage is output of parseCommand
+type parsedPage struct {
+	File  string `json:"file"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
+	Error string `json:"error,omitempty"`
+}
+
+// parseCommand runs youTube parser on local HTML files and prints parsed next video for each of them
+func parseCommand(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s parse FILE...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	parser := parsers.YoutubeParser{Log: log}
+	exitCode := 0
+	for _, name := range flags.Args() {
+		page := parsedPage{File: name}
+		file, err := os.Open(name)
+		if err == nil {
+			// parser takes body of the response, file is closed by it
+			page.Title, page.Link, err = parser.ParseData(&http.Response{Body: file})
+		}
+		if err != nil {
+			page.Error = err.Error()
+			exitCode = 1
+		}
+		printJSON(os.Stdout, page)
+	}
+	return exitCode
+}
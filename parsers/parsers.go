@@ -2,9 +2,10 @@ package parsers
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
+	"unicode"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/html"
@@ -20,6 +21,37 @@ type DataParser interface {
 	ParseData(response *http.Response) (link, title string, err error)
 }
 
+// RelatedVideo is next video to crawl taken from related videos of parsed page
+type RelatedVideo struct {
+	Title   string
+	Link    string
+	Channel string // name of channel that uploaded video
+}
+
+// RelatedParser is optional interface of DataParser, parsers implementing it return also channel of next video
+type RelatedParser interface {
+	ParseRelated(response *http.Response) (RelatedVideo, error)
+}
+
+// Metadata is metadata of watched video found on its page, counts are nil if they aren't on the page
+type Metadata struct {
+	Title   string
+	Channel string
+	Views   *int64
+	Likes   *int64
+}
+
+// Page is parsed page of watched video
+type Page struct {
+	Video Metadata     // metadata of the watched video
+	Next  RelatedVideo // next video to crawl
+}
+
+// PageParser is optional interface of DataParser, parsers implementing it return also metadata of watched video
+type PageParser interface {
+	ParsePage(response *http.Response) (Page, error)
+}
+
 // ParseData parses youTube html for next video sufix and title
 func (y YoutubeParser) ParseData(res *http.Response) (title, link string, err error) {
 	defer res.Body.Close()
@@ -39,12 +71,246 @@ func (y YoutubeParser) ParseData(res *http.Response) (title, link string, err er
 	}).Trace("Parsed values at ParseData from parseNode(doc)")
 
 	if link == "" {
-		fmt.Println("!!! FAILED LINK !!!")
+		y.Log.WithFields(logrus.Fields{
+			"method": "ParseData",
+			"title":  title,
+		}).Warn("Failed to parse link")
 		return title, link, errors.New("From [ParseData] Failed to parse link")
 	}
 	return title, link, nil
 }
 
+// ParseRelated parses youTube html for next video sufix, title and channel
+func (y YoutubeParser) ParseRelated(res *http.Response) (RelatedVideo, error) {
+	defer res.Body.Close()
+	doc, err := html.Parse(res.Body)
+	if err != nil {
+		y.Log.WithFields(logrus.Fields{
+			"method": "html.Parse",
+			"err":    err.Error(),
+		}).Error("Failed to parse req.Body")
+		return RelatedVideo{}, err
+	}
+
+	video := parseRelated(doc)
+	y.Log.WithFields(logrus.Fields{
+		"method":        "ParseRelated",
+		"parsedTitle":   video.Title,
+		"parsedLink":    video.Link,
+		"parsedChannel": video.Channel,
+	}).Trace("Parsed values at ParseRelated")
+
+	if video.Link == "" {
+		return video, errors.New("From [ParseRelated] Failed to parse link")
+	}
+	return video, nil
+}
+
+// ParsePage parses youTube html for metadata of watched video and next video sufix, title and channel
+func (y YoutubeParser) ParsePage(res *http.Response) (Page, error) {
+	defer res.Body.Close()
+	doc, err := html.Parse(res.Body)
+	if err != nil {
+		y.Log.WithFields(logrus.Fields{
+			"method": "html.Parse",
+			"err":    err.Error(),
+		}).Error("Failed to parse req.Body")
+		return Page{}, err
+	}
+
+	page := Page{Video: parseMetadata(doc), Next: parseRelated(doc)}
+	y.Log.WithFields(logrus.Fields{
+		"method":        "ParsePage",
+		"parsedTitle":   page.Next.Title,
+		"parsedLink":    page.Next.Link,
+		"parsedChannel": page.Next.Channel,
+		"videoTitle":    page.Video.Title,
+	}).Trace("Parsed values at ParsePage")
+
+	if page.Next.Link == "" {
+		return page, errors.New("From [ParsePage] Failed to parse link")
+	}
+	return page, nil
+}
+
+// parseRelated returns the first video of related videos list
+func parseRelated(doc *html.Node) RelatedVideo {
+	var video RelatedVideo
+	if list := findVideoList(doc); list != nil {
+		video.Title, video.Link = parseNextLink(list)
+		video.Channel = parseChannel(list)
+	}
+	return video
+}
+
+// parseMetadata returns metadata of watched video, title is `eow-title` element, channel is link in `yt-user-info`,
+// views are in `watch-view-count` and likes in unclicked like button
+func parseMetadata(doc *html.Node) Metadata {
+	var m Metadata
+	if n := findNode(doc, func(n *html.Node) bool { return attr(n, "id") == "eow-title" }); n != nil {
+		if m.Title = attr(n, "title"); m.Title == "" {
+			m.Title = strings.TrimSpace(text(n))
+		}
+	}
+	if n := findNode(doc, func(n *html.Node) bool { return n.Data == "div" && hasClass(n, "yt-user-info") }); n != nil {
+		if a := findNode(n, func(n *html.Node) bool { return n.Data == "a" }); a != nil {
+			m.Channel = strings.TrimSpace(text(a))
+		}
+	}
+	if n := findNode(doc, func(n *html.Node) bool { return hasClass(n, "watch-view-count") }); n != nil {
+		m.Views = parseCount(text(n))
+	}
+	if n := findNode(doc, func(n *html.Node) bool {
+		return n.Data == "button" && hasClass(n, "like-button-renderer-like-button-unclicked")
+	}); n != nil {
+		m.Likes = parseCount(text(n))
+	}
+	return m
+}
+
+// findNode returns the first element node matching match in depth first order
+func findNode(n *html.Node, match func(n *html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findNode(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// attr returns value of attribute key of n
+func attr(n *html.Node, key string) string {
+	for _, v := range n.Attr {
+		if v.Key == key {
+			return v.Val
+		}
+	}
+	return ""
+}
+
+// parseCount returns the first number of s, e.g. `15 368 613 views`, `1,234 views • 3 years ago` or `1.2M views`
+// thousands separators are skipped and K, M and B suffixes scale the number, nil if s has no digits
+// or the number has decimal part without suffix
+func parseCount(s string) *int64 {
+	r := []rune(s)
+	i := 0
+	for i < len(r) && !isDigit(r[i]) {
+		i++
+	}
+	if i == len(r) {
+		return nil
+	}
+	count, i := digits(r, i)
+	// separator is part of the number only if it's followed by group of exactly three digits
+	for i+3 < len(r) && isThousandsSeparator(r[i]) && isDigit(r[i+1]) && isDigit(r[i+2]) && isDigit(r[i+3]) &&
+		(i+4 == len(r) || !isDigit(r[i+4])) {
+		group, next := digits(r, i+1)
+		count, i = count*1000+group, next
+	}
+
+	var fraction, fractionScale int64 = 0, 1
+	if i+1 < len(r) && (r[i] == '.' || r[i] == ',') && isDigit(r[i+1]) {
+		for i++; i < len(r) && isDigit(r[i]); i++ {
+			fraction = fraction*10 + int64(r[i]-'0')
+			fractionScale *= 10
+		}
+	}
+	for i < len(r) && unicode.IsSpace(r[i]) {
+		i++
+	}
+	var unit int64
+	if i < len(r) && (i+1 == len(r) || !unicode.IsLetter(r[i+1])) {
+		unit = countUnits[unicode.ToUpper(r[i])]
+	}
+	if unit == 0 {
+		if fractionScale > 1 {
+			return nil
+		}
+		unit = 1
+	}
+	count = count*unit + fraction*unit/fractionScale
+	return &count
+}
+
+// countUnits are multipliers of abbreviated counts
+var countUnits = map[rune]int64{'K': 1e3, 'M': 1e6, 'B': 1e9}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// isThousandsSeparator reports whether r separates groups of digits in some locale
+func isThousandsSeparator(r rune) bool {
+	switch r {
+	case ',', '.', '\'', ' ', '\u00a0', '\u202f':
+		return true
+	}
+	return false
+}
+
+// digits returns number of digits starting at i and index behind them
+func digits(r []rune, i int) (int64, int) {
+	var n int64
+	for ; i < len(r) && isDigit(r[i]); i++ {
+		n = n*10 + int64(r[i]-'0')
+	}
+	return n, i
+}
+
+// findVideoList returns first list of related videos
+func findVideoList(n *html.Node) *html.Node {
+	if n.Type == html.ElementNode && n.Data == "ul" && hasClass(n, "video-list") {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if list := findVideoList(c); list != nil {
+			return list
+		}
+	}
+	return nil
+}
+
+// parseChannel returns channel name of first video in the list, channel is text of `stat attribution` span
+func parseChannel(n *html.Node) string {
+	if n.Type == html.ElementNode && n.Data == "span" && hasClass(n, "attribution") {
+		return strings.TrimSpace(text(n))
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if channel := parseChannel(c); channel != "" {
+			return channel
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, v := range n.Attr {
+		if v.Key == "class" {
+			for _, c := range strings.Fields(v.Val) {
+				if c == class {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// text returns concatenated text of all child nodes
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(text(c))
+	}
+	return b.String()
+}
+
 func parseNode(n *html.Node) (title, link string) {
 	if n.Type == html.ElementNode && n.Data == "ul" {
 		for _, v := range n.Attr {
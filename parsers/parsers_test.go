@@ -102,6 +102,45 @@ func TestNewParseYoutubeData(t *testing.T) {
 	})
 }
 
+func TestParseRelated(t *testing.T) {
+	y := YoutubeParser{
+		Log: logrus.New(),
+	}
+	y.Log.Out = ioutil.Discard
+
+	tests := []struct {
+		file        string
+		wantLink    string
+		wantChannel string
+	}{
+		{"response_test.dat", "/watch?v=KR-eV7fHNbM", "TheFatRat"},
+		{"response2_test.dat", "/watch?v=TsTFVdcpLrE", "MrLINO83"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := ioutil.ReadFile(tt.file)
+			if err != nil {
+				t.Fatalf("Failed to read test data from file; reason: %s", err)
+			}
+			server := makeFakeYoutubeServer(body)
+			defer server.Close()
+
+			res, err := http.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := y.ParseRelated(res)
+			if err != nil {
+				t.Errorf("Failed to parse response body; reason: %s", err)
+			}
+			assertLinkEquals(t, tt.wantLink, got.Link)
+			if got.Channel != tt.wantChannel {
+				t.Errorf("Got channel %s, want %s", got.Channel, tt.wantChannel)
+			}
+		})
+	}
+}
+
 func makeFakeYoutubeServer(body []byte) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -123,3 +162,65 @@ func assertTitleEquals(t *testing.T, wantTitle, gotTitle string) {
 		t.Errorf("Got %s, want %s", gotTitle, wantTitle)
 	}
 }
+
+func TestParsePage(t *testing.T) {
+	y := YoutubeParser{
+		Log: logrus.New(),
+	}
+	y.Log.Out = ioutil.Discard
+
+	body, err := ioutil.ReadFile("response_test.dat")
+	if err != nil {
+		t.Fatalf("Failed to read test data from file; reason: %s", err)
+	}
+	server := makeFakeYoutubeServer(body)
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := y.ParsePage(res)
+	if err != nil {
+		t.Fatalf("Failed to parse response body; reason: %s", err)
+	}
+	assertLinkEquals(t, "/watch?v=KR-eV7fHNbM", page.Next.Link)
+	v := page.Video
+	if v.Title != "TheFatRat - MAYDAY feat. Laura Brehm" || v.Channel != "TheFatRat" || v.Views == nil || *v.Views != 15368613 || v.Likes == nil || *v.Likes != 226021 {
+		t.Errorf("Got %+v", v)
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64 // -1 for nil
+	}{
+		{"15 368 613 views", 15368613},
+		{"15\u00a0368\u00a0613 zhlédnutí", 15368613},
+		{"1,234 views • 3 years ago", 1234},
+		{"1.234.567 Aufrufe", 1234567},
+		{"226,021", 226021},
+		{"1.2M views", 1200000},
+		{"12K views", 12000},
+		{"3.4 K", 3400},
+		{"1,5B", 1500000000},
+		{"987 views", 987},
+		{"12 345 678", 12345678},
+		{"1 234 views 5 months ago", 1234},
+		{"1.5 views", -1},
+		{"žádná zhlédnutí", -1},
+	}
+	for _, tt := range tests {
+		got := parseCount(tt.in)
+		if tt.want < 0 {
+			if got != nil {
+				t.Errorf("Got %d for %q, want nil", *got, tt.in)
+			}
+			continue
+		}
+		if got == nil || *got != tt.want {
+			t.Errorf("Got %v for %q, want %d", got, tt.in, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/client"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/export"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// remoteFlags returns flag set with 'server' flag shared by commands calling running server
+func remoteFlags(name, usage string) (*flag.FlagSet, *string) {
+	conf := config.New()
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	server := flags.String("server", conf.ServerConfig.URL, "address of the server")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags] %s\n", os.Args[0], name, usage)
+		flags.PrintDefaults()
+	}
+	return flags, server
+}
+
+// submitCommand submits links to running server and prints created jobs
+func submitCommand(args []string) int {
+	flags, server := remoteFlags("submit", "LINK...")
+	iterations := flags.Int("iterations", 0, "number of links to crawl from each seed, server default if 0")
+	label := flags.String("label", "", "label of created jobs")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	c := client.New(*server)
+	exitCode := 0
+	for _, link := range flags.Args() {
+		job, err := c.Submit(models.Seed{Link: link, NOfIterations: *iterations, Label: *label})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to submit '%s', reason: %s\n", link, err)
+			exitCode = 1
+			continue
+		}
+		printJSON(os.Stdout, job)
+	}
+	return exitCode
+}
+
+// statusCommand prints given jobs or all jobs if no job ID is given
+func statusCommand(args []string) int {
+	flags, server := remoteFlags("status", "[JOBID...]")
+	flags.Parse(args)
+
+	jobs, err := fetchJobs(client.New(*server), flags.Args())
+	for _, job := range jobs {
+		printJSON(os.Stdout, job)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get job status, reason: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// cancelCommand cancels given jobs
+func cancelCommand(args []string) int {
+	flags, server := remoteFlags("cancel", "JOBID...")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	c := client.New(*server)
+	exitCode := 0
+	for _, id := range flags.Args() {
+		job, err := c.Cancel(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to cancel job '%s', reason: %s\n", id, err)
+			exitCode = 1
+			continue
+		}
+		printJSON(os.Stdout, job)
+	}
+	return exitCode
+}
+
+// exportCommand writes given jobs or all jobs as JSON array to stdout or file
+func exportCommand(args []string) int {
+	var out io.Writer = os.Stdout
+	flags, server := remoteFlags("export", "[JOBID...]")
+	output := flags.String("output", "", "file to write to, stdout if not set")
+	format := flags.String("format", "json", "json exports jobs from the server, csv or parquet export dataset of single job from configured store,\n"+
+		"graphml, gexf or dot export recommendation graph of job or time range from configured store")
+	dataset := flags.String("dataset", export.DatasetEdges, "dataset exported as csv or parquet: edges or videos")
+	from := flags.String("from", "", "graph contains links visited at or after this RFC 3339 time")
+	to := flags.String("to", "", "graph contains links visited before this RFC 3339 time")
+	flags.Parse(args)
+
+	var q store.LinkQuery
+	graph := export.CheckGraph(*format) == nil
+	if graph {
+		if flags.NArg() > 1 {
+			fmt.Fprintf(os.Stderr, "At most one JOBID is allowed for %s export\n", *format)
+			return 2
+		}
+		q.JobID = flags.Arg(0)
+		var err error
+		if q.From, err = parseTime(*from); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -from: %s\n", err)
+			return 2
+		}
+		if q.To, err = parseTime(*to); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -to: %s\n", err)
+			return 2
+		}
+	} else if *format != "json" {
+		if err := export.Check(*dataset, *format); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 2
+		}
+		if flags.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "Exactly one JOBID is required for %s export\n", *format)
+			return 2
+		}
+	}
+
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create file '%s', reason: %s\n", *output, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if graph || *format != "json" {
+		c := config.New().StoreConfig
+		c.Out = os.Stderr
+		if graph {
+			return exportGraph(out, c, q, *format)
+		}
+		return exportDataset(out, c, flags.Arg(0), *dataset, *format)
+	}
+
+	jobs, err := fetchJobs(client.New(*server), flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get jobs, reason: %s\n", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(jobs); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write jobs, reason: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// exportDataset writes dataset of job read from store to out
+func exportDataset(out io.Writer, c config.StoreConfig, jobID, dataset, format string) int {
+	reader, err := store.OpenReader(c, log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open store, reason: %s\n", err)
+		return 1
+	}
+	defer reader.Close()
+
+	if err := export.Job(out, reader, jobID, dataset, format); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export job '%s', reason: %s\n", jobID, err)
+		return 1
+	}
+	return 0
+}
+
+// exportGraph writes graph of links matching query read from store to out
+func exportGraph(out io.Writer, c config.StoreConfig, q store.LinkQuery, format string) int {
+	reader, err := store.OpenReader(c, log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open store, reason: %s\n", err)
+		return 1
+	}
+	defer reader.Close()
+
+	if err := export.Graph(out, reader, q, format); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export graph, reason: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseTime parses RFC 3339 time, empty string is zero time
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// fetchJobs returns jobs by their IDs or all jobs if ids is empty
+func fetchJobs(c *client.Client, ids []string) ([]models.Job, error) {
+	if len(ids) == 0 {
+		return c.Jobs()
+	}
+	jobs := make([]models.Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := c.Job(id)
+		if err != nil {
+			return jobs, fmt.Errorf("job '%s': %s", id, err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func printJSON(w io.Writer, v interface{}) {
+	b, _ := json.Marshal(v)
+	fmt.Fprintln(w, string(b))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/export"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// captureStdout returns what fn writes to stdout, stderr is discarded meanwhile
+func captureStdout(t *testing.T, fn func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+
+	read := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		read <- b
+	}()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, devNull
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	fn()
+	w.Close()
+	return <-read
+}
+
+func TestExportToStdout(t *testing.T) {
+	log.Out = ioutil.Discard
+	path := filepath.Join(t.TempDir(), "links.csv")
+	t.Setenv("STORE_BACKEND", store.BackendCSV)
+	t.Setenv("CSV_PATH", path)
+
+	s, err := store.NewCSVStore(path, ioutil.Discard, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []models.NextLink{
+		{ID: "aaa", JobID: "j1", Title: "Alpha", Channel: "ch1", Link: "/watch?v=aaa", Number: 0},
+		{ID: "bbb", JobID: "j1", ParentID: "aaa", Title: "Beta", Channel: "ch2", Link: "/watch?v=bbb", Number: 1},
+	} {
+		if err := s.Store(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	reader, err := store.NewCSVReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format string
+		write  func(w io.Writer) error
+	}{
+		{export.FormatCSV, func(w io.Writer) error { return export.Job(w, reader, "j1", export.DatasetEdges, export.FormatCSV) }},
+		{export.FormatParquet, func(w io.Writer) error { return export.Job(w, reader, "j1", export.DatasetEdges, export.FormatParquet) }},
+		{export.FormatDOT, func(w io.Writer) error { return export.Graph(w, reader, store.LinkQuery{JobID: "j1"}, export.FormatDOT) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var want bytes.Buffer
+			if err := tt.write(&want); err != nil {
+				t.Fatal(err)
+			}
+			code := -1
+			got := captureStdout(t, func() {
+				code = exportCommand([]string{"-format", tt.format, "j1"})
+			})
+			if code != 0 {
+				t.Fatalf("Got exit code %v", code)
+			}
+			if !bytes.Equal(got, want.Bytes()) {
+				t.Errorf("Got stdout\n%q\nwant only the dataset\n%q", got, want.Bytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/client"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+)
+
+// replayCommand stores links from dead-letter file again, by running server or directly to configured store with -local
+func replayCommand(args []string) int {
+	conf := config.New()
+	flags := flag.NewFlagSet("replay-dlq", flag.ExitOnError)
+	server := flags.String("server", conf.ServerConfig.URL, "address of the server")
+	local := flags.Bool("local", false, "replay to configured store directly instead of running server, the server must not run")
+	flags.StringVar(&conf.StoreConfig.DeadLetterPath, "file", conf.StoreConfig.DeadLetterPath, "dead-letter file replayed with -local")
+	flags.Parse(args)
+
+	var result store.ReplayResult
+	var err error
+	if *local {
+		result, err = replayLocal(conf.StoreConfig)
+	} else {
+		result, err = client.New(*server).ReplayDeadLetters()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to replay dead letters, reason: %s\n", err)
+		return 1
+	}
+	fmt.Printf("Replayed %d links, %d failed again and are kept in dead-letter file\n", result.Replayed, result.Failed)
+	if result.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// replayLocal opens configured store and replays dead-letter file to it
+func replayLocal(c config.StoreConfig) (store.ReplayResult, error) {
+	if c.DeadLetterPath == "" {
+		return store.ReplayResult{}, store.ErrNoDeadLetters
+	}
+	s, err := store.Open(c, log)
+	if err != nil {
+		return store.ReplayResult{}, err
+	}
+	defer s.Close()
+	return store.NewDeadLetters(c.DeadLetterPath).Replay(s)
+}
@@ -0,0 +1,271 @@
+package seeds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// Format of seed list
+type Format string
+
+// Supported seed list formats
+const (
+	JSON   Format = "json"   // JSON array of seed objects or link strings
+	CSV    Format = "csv"    // CSV with optional header `link,n_of_iterations,label`
+	NDJSON Format = "ndjson" // one seed object or link string per line
+)
+
+// Result statuses
+const (
+	Accepted = "accepted"
+	Rejected = "rejected"
+)
+
+// Row is single seed parsed from seed list, Err is set if row is invalid
+type Row struct {
+	Row  int // number of row in seed list starting from 1
+	Seed models.Seed
+	Err  error
+}
+
+// Result of submitting single row
+type Result struct {
+	Row    int         `json:"row"`
+	Status string      `json:"status"`
+	Seed   models.Seed `json:"seed"`
+	JobID  string      `json:"job_id,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Report of submitting whole seed list
+type Report struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Results  []Result `json:"results"`
+}
+
+// Submitter creates jobs from seeds, implemented by crawler.Crawler
+type Submitter interface {
+	Submit(seed models.Seed) (models.Job, error)
+}
+
+// FormatFor returns format for given content type or file name, empty Format if it can't be decided
+func FormatFor(name string) Format {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if i := strings.Index(name, ";"); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	switch name {
+	case "application/json", "text/json":
+		return JSON
+	case "text/csv", "application/csv":
+		return CSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return NDJSON
+	}
+	switch filepath.Ext(name) {
+	case ".json":
+		return JSON
+	case ".csv":
+		return CSV
+	case ".ndjson", ".jsonl":
+		return NDJSON
+	}
+	return ""
+}
+
+// Parse reads seed list from r, if format is empty it's detected from content
+// error is returned only if whole list can't be read, invalid rows are returned with Row.Err set
+func Parse(r io.Reader, format Format) ([]Row, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = detect(data)
+	}
+
+	var rows []Row
+	switch format {
+	case JSON:
+		rows, err = parseJSON(data)
+	case CSV:
+		rows, err = parseCSV(data)
+	case NDJSON:
+		rows, err = parseNDJSON(data)
+	default:
+		return nil, fmt.Errorf("unsupported seed list format '%s'", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rows {
+		if rows[i].Err == nil {
+			_, _, rows[i].Err = models.NormalizeLink(rows[i].Seed.Link)
+		}
+		if rows[i].Err == nil && rows[i].Seed.NOfIterations < 0 {
+			rows[i].Err = errors.New("n_of_iterations can't be negative")
+		}
+	}
+	return rows, nil
+}
+
+// Submit submits all valid rows and reports result for each of them
+func Submit(rows []Row, s Submitter) Report {
+	report := Report{Results: make([]Result, 0, len(rows))}
+	for _, row := range rows {
+		result := Result{Row: row.Row, Seed: row.Seed}
+		err := row.Err
+		if err == nil {
+			var job models.Job
+			job, err = s.Submit(row.Seed)
+			result.JobID = job.ID
+		}
+
+		if err != nil {
+			result.Status = Rejected
+			result.Error = err.Error()
+			report.Rejected++
+		} else {
+			result.Status = Accepted
+			report.Accepted++
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// detect guesses format from first non-blank character
+func detect(data []byte) Format {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return JSON
+	case bytes.HasPrefix(trimmed, []byte("{")), bytes.HasPrefix(trimmed, []byte(`"`)):
+		return NDJSON
+	default:
+		return CSV
+	}
+}
+
+func parseJSON(data []byte) ([]Row, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON seed list: %s", err)
+	}
+
+	rows := make([]Row, 0, len(raw))
+	for i, r := range raw {
+		seed, err := decodeSeed(r)
+		rows = append(rows, Row{Row: i + 1, Seed: seed, Err: err})
+	}
+	return rows, nil
+}
+
+func parseNDJSON(data []byte) ([]Row, error) {
+	var rows []Row
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		seed, err := decodeSeed(line)
+		rows = append(rows, Row{Row: n, Seed: seed, Err: err})
+	}
+	return rows, scanner.Err()
+}
+
+// decodeSeed decodes seed from JSON object or from JSON string holding only link
+func decodeSeed(data []byte) (models.Seed, error) {
+	var seed models.Seed
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		err := json.Unmarshal(data, &seed.Link)
+		return seed, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&seed)
+	return seed, err
+}
+
+func parseCSV(data []byte) ([]Row, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV seed list: %s", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	// columns without header are link, n_of_iterations, label
+	columns := map[string]int{"link": 0, "n_of_iterations": 1, "label": 2}
+	first := 0
+	if isHeader(records[0]) {
+		columns = make(map[string]int)
+		for i, name := range records[0] {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "iterations" {
+				name = "n_of_iterations"
+			}
+			columns[name] = i
+		}
+		if _, ok := columns["link"]; !ok {
+			return nil, errors.New("invalid CSV seed list: header is missing 'link' column")
+		}
+		first = 1
+	}
+
+	rows := make([]Row, 0, len(records)-first)
+	for i, record := range records[first:] {
+		row := Row{Row: i + first + 1}
+		row.Seed.Link = field(record, columns["link"])
+		if c, ok := columns["label"]; ok {
+			row.Seed.Label = field(record, c)
+		}
+		if c, ok := columns["n_of_iterations"]; ok {
+			if v := field(record, c); v != "" {
+				row.Seed.NOfIterations, row.Err = strconv.Atoi(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func isHeader(record []string) bool {
+	for _, name := range record {
+		if strings.EqualFold(strings.TrimSpace(name), "link") {
+			return true
+		}
+	}
+	return false
+}
+
+func field(record []string, i int) string {
+	if i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
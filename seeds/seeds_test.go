@@ -0,0 +1,127 @@
+package seeds
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+type fakeSubmitter struct {
+	seeds []models.Seed
+}
+
+func (fs *fakeSubmitter) Submit(seed models.Seed) (models.Job, error) {
+	if seed.Label == "fail" {
+		return models.Job{}, errors.New("submit failed")
+	}
+	fs.seeds = append(fs.seeds, seed)
+	return models.Job{ID: "job", Seed: seed}, nil
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		format       Format
+		input        string
+		wantRows     int
+		wantInvalid  int
+		wantFirstRow models.Seed
+	}{
+		{
+			name:         "JSON array of objects and strings",
+			format:       JSON,
+			input:        `[{"link": "/watch?v=DT61L8hbbJ4", "n_of_iterations": 5, "label": "a"}, "https://www.youtube.com/watch?v=Q3oItpVa9fs", {"link": "nope"}]`,
+			wantRows:     3,
+			wantInvalid:  1,
+			wantFirstRow: models.Seed{Link: "/watch?v=DT61L8hbbJ4", NOfIterations: 5, Label: "a"},
+		},
+		{
+			name:         "CSV with header",
+			format:       CSV,
+			input:        "label,link,iterations\nfirst,DT61L8hbbJ4,10\nsecond,/watch?v=Q3oItpVa9fs,x\n",
+			wantRows:     2,
+			wantInvalid:  1,
+			wantFirstRow: models.Seed{Link: "DT61L8hbbJ4", NOfIterations: 10, Label: "first"},
+		},
+		{
+			name:         "CSV without header",
+			format:       CSV,
+			input:        "https://youtu.be/DT61L8hbbJ4,20\n# comment\n/watch?v=Q3oItpVa9fs\n",
+			wantRows:     2,
+			wantFirstRow: models.Seed{Link: "https://youtu.be/DT61L8hbbJ4", NOfIterations: 20},
+		},
+		{
+			name:         "NDJSON detected from content",
+			input:        "{\"link\": \"/watch?v=DT61L8hbbJ4\"}\n\n\"Q3oItpVa9fs\"\n{\"link\": \"/watch?v=Q3oItpVa9fs\", \"unknown\": 1}\n",
+			wantRows:     3,
+			wantInvalid:  1,
+			wantFirstRow: models.Seed{Link: "/watch?v=DT61L8hbbJ4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := Parse(strings.NewReader(tt.input), tt.format)
+			if err != nil {
+				t.Fatalf("Failed to parse seed list; reason: %s", err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Fatalf("Got %v rows, want %v", len(rows), tt.wantRows)
+			}
+			invalid := 0
+			for _, row := range rows {
+				if row.Err != nil {
+					invalid++
+				}
+			}
+			if invalid != tt.wantInvalid {
+				t.Errorf("Got %v invalid rows, want %v", invalid, tt.wantInvalid)
+			}
+			if rows[0].Seed != tt.wantFirstRow {
+				t.Errorf("Got first row %+v, want %+v", rows[0].Seed, tt.wantFirstRow)
+			}
+		})
+	}
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		if _, err := Parse(strings.NewReader(`[{"link": `), JSON); err == nil {
+			t.Errorf("Expected error for malformed JSON")
+		}
+	})
+}
+
+func TestSubmit(t *testing.T) {
+	rows, err := Parse(strings.NewReader("link,label\nDT61L8hbbJ4,ok\nQ3oItpVa9fs,fail\nbad,ok\n"), "")
+	if err != nil {
+		t.Fatalf("Failed to parse seed list; reason: %s", err)
+	}
+
+	fs := &fakeSubmitter{}
+	report := Submit(rows, fs)
+
+	if report.Accepted != 1 || report.Rejected != 2 {
+		t.Errorf("Got %v accepted and %v rejected, want 1 and 2", report.Accepted, report.Rejected)
+	}
+	if report.Results[0].Status != Accepted || report.Results[0].JobID != "job" {
+		t.Errorf("Got first result %+v, want accepted with job ID", report.Results[0])
+	}
+	if len(fs.seeds) != 1 {
+		t.Errorf("Got %v submitted seeds, want 1", len(fs.seeds))
+	}
+}
+
+func TestFormatFor(t *testing.T) {
+	for name, want := range map[string]Format{
+		"application/json; charset=utf-8": JSON,
+		"text/csv":                        CSV,
+		"seeds.jsonl":                     NDJSON,
+		"Seeds.CSV":                       CSV,
+		"text/plain":                      "",
+	} {
+		if got := FormatFor(name); got != want {
+			t.Errorf("Got '%v' for '%s', want '%v'", got, name, want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	_ "net/http/pprof"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/crawler"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/frontier"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/handlers"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/objstore"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/parsers"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/store"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/webhooks"
+)
+
+// serveCommand starts HTTP server and crawls links submitted over the API until stopped
+func serveCommand(args []string) int {
+	conf := config.New()
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.StringVar(&conf.ServerConfig.Addr, "addr", conf.ServerConfig.Addr, "address to listen on")
+	flags.StringVar(&conf.CrawlerConfig.SeedFile, "seeds", conf.CrawlerConfig.SeedFile, "seed file to submit at startup")
+	flags.StringVar(&conf.CrawlerConfig.FrontierPath, "frontier", conf.CrawlerConfig.FrontierPath, "file to keep jobs in to resume them after restart, empty disables it")
+	flags.Parse(args)
+
+	stop := make(chan os.Signal, 1)
+	go catchSignal(stop)
+
+	m := http.NewServeMux()
+	server := &http.Server{
+		Addr:         conf.ServerConfig.Addr,
+		Handler:      m,
+		ReadTimeout:  60 * time.Second,
+		WriteTimeout: 60 * time.Second,
+	}
+
+	storeManager, err := store.New(conf.StoreConfig, log)
+	if err != nil {
+		fmt.Printf("Failed to open store, reason: %s\n", err)
+		log.WithFields(logrus.Fields{
+			"backend": conf.StoreConfig.Backend,
+			"err":     err.Error(),
+		}).Error("Failed to open store")
+		return 1
+	}
+	// once crawler runs, Manager closes the destination after it stores the last link
+	running := false
+	defer func() {
+		if !running {
+			storeManager.StoreDestination.Close()
+		}
+	}()
+
+	monster := crawler.New(storeManager, conf.CrawlerConfig, parsers.YoutubeParser{Log: log}, os.Stdout, log)
+	if jobs := storeManager.TrackJobs(monster.Events); jobs != nil {
+		defer jobs.Close()
+	}
+	sink, err := startUploads(conf.S3Config, monster, storeManager)
+	if err != nil {
+		fmt.Printf("Failed to set up S3 uploads, reason: %s\n", err)
+		log.WithFields(logrus.Fields{
+			"endpoint": conf.S3Config.Endpoint,
+			"err":      err.Error(),
+		}).Error("Failed to set up S3 uploads")
+		return 1
+	}
+	if sink != nil {
+		defer sink.Close()
+	}
+	if conf.CrawlerConfig.FrontierPath != "" {
+		f, err := frontier.Open(conf.CrawlerConfig.FrontierPath, log)
+		if err != nil {
+			fmt.Printf("Failed to open frontier, reason: %s\n", err)
+			log.WithFields(logrus.Fields{
+				"path": conf.CrawlerConfig.FrontierPath,
+				"err":  err.Error(),
+			}).Error("Failed to open frontier")
+			return 1
+		}
+		defer f.Close()
+		monster.Frontier = f
+		resumed, err := monster.Restore()
+		if err != nil {
+			fmt.Printf("Failed to restore jobs from frontier, reason: %s\n", err)
+			log.WithFields(logrus.Fields{
+				"path": conf.CrawlerConfig.FrontierPath,
+				"err":  err.Error(),
+			}).Error("Failed to restore jobs from frontier")
+			return 1
+		}
+		fmt.Printf("Resumed %v unfinished jobs\n", resumed)
+	}
+
+	handlers.SetHandlers(m, monster, log)
+
+	if conf.WebhookConfig.File != "" {
+		hooks, err := webhooks.Load(conf.WebhookConfig.File)
+		if err != nil {
+			fmt.Printf("Failed to load webhooks, reason: %s\n", err)
+			log.WithFields(logrus.Fields{
+				"file": conf.WebhookConfig.File,
+				"err":  err.Error(),
+			}).Error("Failed to load webhooks")
+			return 1
+		}
+		notifier := webhooks.New(hooks, conf.WebhookConfig.MaxAttempts, log)
+		defer notifier.Run(monster.Events).Close()
+		handlers.SetWebhookHandlers(m, notifier)
+		fmt.Printf("Loaded %v webhooks\n", len(hooks))
+	}
+
+	go monster.Run()
+	running = true
+
+	if conf.CrawlerConfig.SeedFile != "" {
+		importSeeds(conf.CrawlerConfig.SeedFile, monster, os.Stdout)
+	}
+
+	go startServer(server)
+
+	for {
+		select {
+		case <-storeManager.Shutdown:
+			fmt.Println("Server shutting down")
+			server.Shutdown(context.TODO())
+			return 1
+		case <-stop:
+			monster.Stop()
+		}
+	}
+}
+
+// startUploads uploads raw pages and exports of ended jobs to S3 bucket if endpoint is configured, sink is nil otherwise
+func startUploads(conf config.S3Config, monster *crawler.Crawler, storeManager *store.Manager) (*objstore.Sink, error) {
+	if conf.Endpoint == "" {
+		return nil, nil
+	}
+	sink, err := objstore.New(objstore.Options{
+		Endpoint:    conf.Endpoint,
+		Bucket:      conf.Bucket,
+		Region:      conf.Region,
+		AccessKey:   conf.AccessKey,
+		SecretKey:   conf.SecretKey,
+		Secure:      conf.Secure,
+		Prefix:      conf.Prefix,
+		SpoolDir:    conf.SpoolDir,
+		PartSizeMB:  conf.PartSizeMB,
+		MaxAttempts: conf.Attempts,
+		RetryEvery:  conf.RetryEvery,
+	}, log)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Pages {
+		monster.Pages = sink
+	}
+	if conf.ExportEvery <= 0 {
+		return sink, nil
+	}
+	reader, ok := storeManager.Reader()
+	if !ok {
+		fmt.Println("Store can't be read, jobs won't be exported to S3")
+		return sink, nil
+	}
+	exporter, err := objstore.NewExporter(sink, reader, monster.Jobs, conf.ExportFormat)
+	if err != nil {
+		sink.Close()
+		return nil, err
+	}
+	go exporter.Run(conf.ExportEvery)
+	return sink, nil
+}
+
+func startServer(s *http.Server) {
+	fmt.Printf("Starting server at addr: %s\n", s.Addr)
+	log.WithFields(logrus.Fields{
+		"Addr": s.Addr,
+	}).Debug("Server listening")
+	err := s.ListenAndServe()
+	if err != nil {
+	}
+
+}
+
+func catchSignal(stopChan chan os.Signal) {
+	signal.Notify(stopChan, os.Interrupt)
+}
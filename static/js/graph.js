@@ -0,0 +1,171 @@
+// force-directed graph of visited videos loaded from /api/v1/graph
+(function () {
+    var svg = document.getElementById("graph");
+    if (!svg) {
+        return;
+    }
+    var ns = "http://www.w3.org/2000/svg";
+    var width = svg.clientWidth || 960;
+    var height = svg.clientHeight || 640;
+    svg.setAttribute("viewBox", "0 0 " + width + " " + height);
+
+    var params = [];
+    if (svg.dataset.job) {
+        params.push("job=" + encodeURIComponent(svg.dataset.job));
+    }
+    if (svg.dataset.depth) {
+        params.push("depth=" + encodeURIComponent(svg.dataset.depth));
+    }
+
+    fetch("/api/v1/graph" + (params.length ? "?" + params.join("&") : ""))
+        .then(function (res) {
+            if (!res.ok) {
+                throw new Error(res.status + " " + res.statusText);
+            }
+            return res.json();
+        })
+        .then(draw)
+        .catch(function (err) {
+            svg.outerHTML = '<p class="error">Failed to load graph: ' + err.message + "</p>";
+        });
+
+    // color returns the same color for the same channel
+    function color(channel) {
+        var hash = 0;
+        for (var i = 0; i < channel.length; i++) {
+            hash = (hash * 31 + channel.charCodeAt(i)) | 0;
+        }
+        return "hsl(" + (Math.abs(hash) % 360) + ", 65%, 55%)";
+    }
+
+    function radius(node) {
+        return 5 + 3 * Math.sqrt(node.visits);
+    }
+
+    function draw(graph) {
+        var byID = {};
+        graph.nodes.forEach(function (node, i) {
+            var angle = i * 2.399963;
+            var dist = 10 * Math.sqrt(i + 1);
+            node.x = width / 2 + dist * Math.cos(angle);
+            node.y = height / 2 + dist * Math.sin(angle);
+            node.vx = 0;
+            node.vy = 0;
+            byID[node.id] = node;
+        });
+        var edges = graph.edges.filter(function (edge) {
+            edge.sourceNode = byID[edge.source];
+            edge.targetNode = byID[edge.target];
+            return edge.sourceNode && edge.targetNode;
+        });
+
+        var edgeLayer = document.createElementNS(ns, "g");
+        var nodeLayer = document.createElementNS(ns, "g");
+        svg.appendChild(edgeLayer);
+        svg.appendChild(nodeLayer);
+
+        edges.forEach(function (edge) {
+            edge.el = document.createElementNS(ns, "line");
+            edge.el.setAttribute("class", "edge");
+            edge.el.setAttribute("stroke-width", Math.min(6, edge.weight));
+            edgeLayer.appendChild(edge.el);
+        });
+        graph.nodes.forEach(function (node) {
+            node.el = document.createElementNS(ns, "circle");
+            node.el.setAttribute("class", "node");
+            node.el.setAttribute("r", radius(node));
+            node.el.setAttribute("fill", color(node.channel || ""));
+            var title = document.createElementNS(ns, "title");
+            title.textContent = (node.title || node.id) + (node.channel ? " - " + node.channel : "");
+            node.el.appendChild(title);
+            node.el.addEventListener("click", function () {
+                showDetail(node);
+            });
+            nodeLayer.appendChild(node.el);
+        });
+
+        var alpha = 1;
+        function tick() {
+            simulate(graph.nodes, edges, alpha);
+            render(graph.nodes, edges);
+            alpha *= 0.98;
+            if (alpha > 0.005) {
+                window.requestAnimationFrame(tick);
+            }
+        }
+        tick();
+    }
+
+    // simulate moves nodes by one step: nodes repel each other, edges pull nodes together and gravity keeps graph centered
+    function simulate(nodes, edges, alpha) {
+        var i, j, a, b, dx, dy, d2, d, f;
+        for (i = 0; i < nodes.length; i++) {
+            a = nodes[i];
+            for (j = i + 1; j < nodes.length; j++) {
+                b = nodes[j];
+                dx = b.x - a.x;
+                dy = b.y - a.y;
+                d2 = dx * dx + dy * dy || 0.01;
+                f = 800 * alpha / d2;
+                a.vx -= dx * f;
+                a.vy -= dy * f;
+                b.vx += dx * f;
+                b.vy += dy * f;
+            }
+        }
+        edges.forEach(function (edge) {
+            a = edge.sourceNode;
+            b = edge.targetNode;
+            dx = b.x - a.x;
+            dy = b.y - a.y;
+            d = Math.sqrt(dx * dx + dy * dy) || 0.01;
+            f = (d - 60) / d * 0.1 * alpha;
+            a.vx += dx * f;
+            a.vy += dy * f;
+            b.vx -= dx * f;
+            b.vy -= dy * f;
+        });
+        nodes.forEach(function (node) {
+            node.vx += (width / 2 - node.x) * 0.01 * alpha;
+            node.vy += (height / 2 - node.y) * 0.01 * alpha;
+            node.vx *= 0.6;
+            node.vy *= 0.6;
+            node.x = Math.max(10, Math.min(width - 10, node.x + node.vx));
+            node.y = Math.max(10, Math.min(height - 10, node.y + node.vy));
+        });
+    }
+
+    function render(nodes, edges) {
+        edges.forEach(function (edge) {
+            edge.el.setAttribute("x1", edge.sourceNode.x);
+            edge.el.setAttribute("y1", edge.sourceNode.y);
+            edge.el.setAttribute("x2", edge.targetNode.x);
+            edge.el.setAttribute("y2", edge.targetNode.y);
+        });
+        nodes.forEach(function (node) {
+            node.el.setAttribute("cx", node.x);
+            node.el.setAttribute("cy", node.y);
+        });
+    }
+
+    function showDetail(node) {
+        var detail = document.getElementById("node-detail");
+        var video = detail.querySelector(".video");
+        video.href = "https://www.youtube.com/watch?v=" + encodeURIComponent(node.id);
+        video.querySelector("img").src = "https://i.ytimg.com/vi/" + encodeURIComponent(node.id) + "/mqdefault.jpg";
+        video.querySelector(".title").textContent = node.title || node.id;
+        detail.querySelector(".channel").textContent = node.channel || "unknown channel";
+        detail.querySelector(".visits").textContent = node.visits;
+        detail.querySelector(".depth").textContent = node.depth;
+        var jobs = detail.querySelector(".jobs");
+        jobs.textContent = "";
+        (node.jobs || []).forEach(function (id) {
+            var a = document.createElement("a");
+            a.href = "/jobs/" + encodeURIComponent(id);
+            a.textContent = id;
+            jobs.appendChild(a);
+            jobs.appendChild(document.createTextNode(" "));
+        });
+        detail.hidden = false;
+    }
+})();
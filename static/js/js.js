@@ -0,0 +1,77 @@
+// live updates of dashboard and job pages from /api/v1/events
+(function () {
+    var live = document.querySelector("[data-live]");
+    if (!live || !window.EventSource) {
+        return;
+    }
+
+    var url = "/api/v1/events";
+    if (live.dataset.live === "job") {
+        url += "?job=" + encodeURIComponent(live.dataset.job);
+    }
+    var source = new EventSource(url);
+
+    function updateJob(job) {
+        var el = document.getElementById("job-" + job.id);
+        if (!el) {
+            if (live.dataset.live === "jobs" && (job.status === "queued" || job.status === "running")) {
+                window.location.reload();
+            }
+            return;
+        }
+        var total = job.seed.n_of_iterations + 1;
+        el.querySelectorAll(".status").forEach(function (status) {
+            status.textContent = job.status;
+            status.className = "status status-" + job.status;
+        });
+        el.querySelectorAll(".visited").forEach(function (visited) {
+            visited.textContent = job.visited;
+        });
+        el.querySelectorAll(".bar").forEach(function (bar) {
+            bar.style.width = Math.min(100, Math.round(job.visited * 100 / total)) + "%";
+        });
+    }
+
+    function addVisited(link) {
+        var el = document.getElementById("job-" + link.job_id);
+        if (el) {
+            el.querySelectorAll(".visited").forEach(function (visited) {
+                var n = parseInt(visited.textContent, 10) + 1;
+                visited.textContent = n;
+                var total = parseInt(el.dataset.iterations, 10) + 1;
+                el.querySelectorAll(".bar").forEach(function (bar) {
+                    bar.style.width = Math.min(100, Math.round(n * 100 / total)) + "%";
+                });
+            });
+        }
+
+        var chain = document.querySelector(".chain");
+        if (!chain || live.dataset.live !== "job") {
+            return;
+        }
+        var item = document.createElement("li");
+        var a = document.createElement("a");
+        a.href = "https://www.youtube.com" + link.link;
+        a.target = "_blank";
+        a.rel = "noopener";
+        var img = document.createElement("img");
+        img.src = "https://i.ytimg.com/vi/" + encodeURIComponent(link.id) + "/mqdefault.jpg";
+        img.alt = "";
+        var title = document.createElement("span");
+        title.className = "title";
+        title.textContent = link.title || link.id;
+        a.appendChild(img);
+        a.appendChild(title);
+        item.appendChild(a);
+        chain.appendChild(item);
+    }
+
+    ["job.started", "job.queued", "job.paused", "job.resumed", "job.completed", "job.failed", "job.cancelled", "job.loop_detected"].forEach(function (type) {
+        source.addEventListener(type, function (e) {
+            updateJob(JSON.parse(e.data).job);
+        });
+    });
+    source.addEventListener("video.visited", function (e) {
+        addVisited(JSON.parse(e.data).link);
+    });
+})();
@@ -0,0 +1,8 @@
+package static
+
+import "embed"
+
+// FS holds CSS and JS assets embedded in the binary
+//
+//go:embed css js
+var FS embed.FS
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+)
+
+// Backends built into the crawler
+const (
+	BackendSQLite   = DialectSQLite
+	BackendMySQL    = DialectMySQL
+	BackendPostgres = DialectPostgres
+	BackendFile     = "file"
+	BackendJSONL    = "jsonl"
+)
+
+// Factory opens Storer of single backend from store config
+type Factory func(c config.StoreConfig, log *logrus.Logger) (Storer, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Factory)
+)
+
+// Register makes backend available by name, it panics if name is empty or already registered
+func Register(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if name == "" || factory == nil {
+		panic("store: Register backend with empty name or nil factory")
+	}
+	if _, dup := backends[name]; dup {
+		panic("store: Register called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// Backends returns sorted names of registered backends
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// factory returns factory of backend or error listing registered backends
+func factory(name string) (Factory, error) {
+	backendsMu.RLock()
+	f, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown store backend '%s', available backends are %s", name, strings.Join(Backends(), ", "))
+	}
+	return f, nil
+}
+
+// Open opens Storer of backend configured by Backend, backends listed in Fallback are tried in order only if it fails
+// if Destinations are configured, returned Storer is FanOut writing to the opened backend and all destinations,
+// the opened backend is always required and it's the one data are read from
+// all backend names are checked before anything is opened so misconfiguration is reported right away
+func Open(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+	names := append([]string{c.Backend}, c.Fallback...)
+	factories := make([]Factory, len(names))
+	for i, name := range names {
+		f, err := factory(name)
+		if err != nil {
+			return nil, err
+		}
+		factories[i] = f
+	}
+	destinations := make([]Destination, len(c.Destinations))
+	destFactories := make([]Factory, len(c.Destinations))
+	for i, d := range c.Destinations {
+		name, required, err := parseDestination(d)
+		if err != nil {
+			return nil, err
+		}
+		if destFactories[i], err = factory(name); err != nil {
+			return nil, err
+		}
+		destinations[i] = Destination{Name: name, Required: required}
+	}
+
+	s, name, err := openFirst(c, log, names, factories)
+	if err != nil || len(destinations) == 0 {
+		return s, err
+	}
+	opened := []Destination{{Name: name, Storer: s, Required: true}}
+	for i, d := range destinations {
+		if d.Storer, err = destFactories[i](c, log); err != nil {
+			for _, o := range opened {
+				o.Storer.Close()
+			}
+			return nil, fmt.Errorf("failed to open store destination %s: %s", d.Name, err)
+		}
+		opened = append(opened, d)
+	}
+	return NewFanOut(log, opened...), nil
+}
+
+// openFirst returns Storer and name of the first backend that opens
+func openFirst(c config.StoreConfig, log *logrus.Logger, names []string, factories []Factory) (Storer, string, error) {
+	var errs []string
+	for i, f := range factories {
+		s, err := f(c, log)
+		if err == nil {
+			if i > 0 {
+				fmt.Fprintf(output(c.Out), "Storing data to fallback backend '%s'\n", names[i])
+				log.WithFields(logrus.Fields{
+					"backend": names[i],
+					"failed":  strings.Join(errs, "; "),
+				}).Warn("Storing data to fallback backend")
+			}
+			return s, names[i], nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", names[i], err))
+		fmt.Fprintf(output(c.Out), "Failed to open store backend '%s', reason '%s'\n", names[i], err)
+		log.WithFields(logrus.Fields{
+			"method":  "Open",
+			"backend": names[i],
+			"err":     err.Error(),
+		}).Warn("Failed to open store backend")
+	}
+	if len(errs) == 1 {
+		return nil, "", fmt.Errorf("failed to open store backend %s", errs[0])
+	}
+	return nil, "", fmt.Errorf("failed to open any store backend (%s)", strings.Join(errs, "; "))
+}
+
+// OpenReader opens backend configured by Backend for reading, files of file, jsonl and csv backends are opened read only
+// fallback backends aren't tried since they hold different data
+func OpenReader(c config.StoreConfig, log *logrus.Logger) (ReadCloser, error) {
+	if c.Backend == BackendFile {
+		file, err := os.Open(c.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		return FileStore{destFile: file, log: log}, nil
+	}
+	if c.Backend == BackendJSONL {
+		return NewJSONLReader(c)
+	}
+	if c.Backend == BackendCSV {
+		return NewCSVReader(c.CSVPath)
+	}
+	f, err := factory(c.Backend)
+	if err != nil {
+		return nil, err
+	}
+	s, err := f(c, log)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := s.(ReadCloser)
+	if !ok {
+		s.Close()
+		return nil, fmt.Errorf("store backend '%s' can't be read", c.Backend)
+	}
+	return r, nil
+}
+
+func init() {
+	Register(BackendSQLite, func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return NewSQLiteStore(c, log)
+	})
+	Register(BackendMySQL, func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return NewDbStore(c, log)
+	})
+	Register(BackendPostgres, func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return NewPostgresStore(c, log)
+	})
+	Register(BackendFile, func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return NewFileStore(c.FilePath, c.Out, log)
+	})
+	Register(BackendJSONL, func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return NewJSONLStoreFromConfig(c, log)
+	})
+	Register(BackendCSV, func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return NewCSVStoreFromConfig(c, log)
+	})
+}
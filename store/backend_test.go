@@ -0,0 +1,74 @@
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+type nopStore struct{ name string }
+
+func (nopStore) Store(link models.NextLink) error { return nil }
+func (nopStore) Close()                           {}
+
+func init() {
+	Register("test-ok", func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return nopStore{name: "test-ok"}, nil
+	})
+	Register("test-broken", func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return nil, errors.New("access denied")
+	})
+}
+
+func TestOpen(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+
+	t.Run("selected backend", func(t *testing.T) {
+		s, err := Open(config.StoreConfig{Backend: "test-ok"}, log)
+		if err != nil || s.(nopStore).name != "test-ok" {
+			t.Errorf("Got %v, err %v", s, err)
+		}
+	})
+
+	t.Run("failure without fallback", func(t *testing.T) {
+		_, err := Open(config.StoreConfig{Backend: "test-broken", FilePath: filepath.Join(t.TempDir(), "links.dat")}, log)
+		if err == nil || !strings.Contains(err.Error(), "access denied") {
+			t.Errorf("Got %v, want error of broken backend", err)
+		}
+	})
+
+	t.Run("configured fallback", func(t *testing.T) {
+		s, err := Open(config.StoreConfig{Backend: "test-broken", Fallback: []string{"test-broken", "test-ok"}}, log)
+		if err != nil || s.(nopStore).name != "test-ok" {
+			t.Errorf("Got %v, err %v", s, err)
+		}
+	})
+
+	t.Run("unknown backend", func(t *testing.T) {
+		if _, err := Open(config.StoreConfig{Backend: "mysq1"}, log); err == nil || !strings.Contains(err.Error(), "unknown store backend 'mysq1'") {
+			t.Errorf("Got %v, want unknown backend error", err)
+		}
+	})
+
+	t.Run("unknown fallback is reported before opening", func(t *testing.T) {
+		if _, err := Open(config.StoreConfig{Backend: "test-ok", Fallback: []string{"nope"}}, log); err == nil {
+			t.Error("Got no error for unknown fallback backend")
+		}
+	})
+
+	t.Run("duplicate registration", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Got no panic for backend registered twice")
+			}
+		}()
+		Register(BackendSQLite, func(c config.StoreConfig, log *logrus.Logger) (Storer, error) { return nil, nil })
+	})
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// BackendCSV is name of backend writing links to CSV file
+const BackendCSV = "csv"
+
+// csvHeader are columns of CSV file, they are the same as columns of exported edges dataset
+var csvHeader = []string{"job_id", "number", "parent_id", "video_id", "title", "channel", "link", "visited_at"}
+
+// CSVStore appends links to CSV file with header, every link is flushed to the file once it's written
+type CSVStore struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+	w    *csv.Writer
+	log  *logrus.Logger
+}
+
+// NewCSVStore opens CSV file at path for appending, header is written if the file is new or empty, path is printed to out
+func NewCSVStore(path string, out io.Writer, log *logrus.Logger) (*CSVStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing path of CSV file")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s := &CSVStore{path: path, file: file, w: csv.NewWriter(file), log: log}
+	if info.Size() == 0 {
+		if err := s.write(csvHeader); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	fmt.Fprintf(output(out), "Storing data to '%s'\n", path)
+	log.WithFields(logrus.Fields{
+		"path": path,
+	}).Debug("Opened CSV file")
+	return s, nil
+}
+
+// NewCSVStoreFromConfig returns CSVStore writing to CSVPath of store config
+func NewCSVStoreFromConfig(c config.StoreConfig, log *logrus.Logger) (*CSVStore, error) {
+	return NewCSVStore(c.CSVPath, c.Out, log)
+}
+
+func (s *CSVStore) write(record []string) error {
+	if err := s.w.Write(record); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// Store appends link as single row
+func (s *CSVStore) Store(link models.NextLink) error {
+	visitedAt := ""
+	if !link.VisitedAt.IsZero() {
+		visitedAt = link.VisitedAt.UTC().Format(time.RFC3339Nano)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write([]string{link.JobID, strconv.Itoa(link.Number), link.ParentID, link.ID, link.Title, link.Channel, link.Link, visitedAt})
+}
+
+// Close closes the file
+func (s *CSVStore) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.file.Close(); err != nil {
+		s.log.WithFields(logrus.Fields{
+			"path": s.path,
+			"err":  err.Error(),
+		}).Warn("Failed to close CSV file")
+	}
+}
+
+// CSVReader reads links back from CSV file written by CSVStore
+type CSVReader struct {
+	path string
+}
+
+// NewCSVReader returns reader of CSV file at path, it fails if the file doesn't exist
+func NewCSVReader(path string) (CSVReader, error) {
+	if _, err := os.Stat(path); err != nil {
+		return CSVReader{}, err
+	}
+	return CSVReader{path: path}, nil
+}
+
+// scan calls fn for links of the file matching query in order they were stored
+func (r CSVReader) scan(q LinkQuery, fn func(link models.NextLink) error) error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	cr := csv.NewReader(file)
+	cr.FieldsPerRecord = len(csvHeader)
+	for n := 1; ; n++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n == 1 && record[0] == csvHeader[0] {
+			continue
+		}
+		link, err := parseCSVRecord(record)
+		if err != nil {
+			return fmt.Errorf("invalid record %d of %s: %w", n, r.path, err)
+		}
+		if (q.JobID != "" && link.JobID != q.JobID) || !q.matches(link.VisitedAt) {
+			continue
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+}
+
+func parseCSVRecord(record []string) (models.NextLink, error) {
+	number, err := strconv.Atoi(record[1])
+	if err != nil {
+		return models.NextLink{}, err
+	}
+	link := models.NextLink{JobID: record[0], Number: number, ParentID: record[2], ID: record[3], Title: record[4], Channel: record[5], Link: record[6]}
+	if record[7] != "" {
+		if link.VisitedAt, err = time.Parse(time.RFC3339Nano, record[7]); err != nil {
+			return models.NextLink{}, err
+		}
+	}
+	return link, nil
+}
+
+func (r CSVReader) records() ([]models.NextLink, error) {
+	var records []models.NextLink
+	err := r.scan(LinkQuery{}, func(link models.NextLink) error {
+		records = append(records, link)
+		return nil
+	})
+	return records, err
+}
+
+// ScanLinks calls fn for links matching query, links of single job are ordered by number of iteration
+func (r CSVReader) ScanLinks(q LinkQuery, fn func(link models.NextLink) error) error {
+	if q.JobID == "" {
+		return r.scan(q, fn)
+	}
+	path, err := r.Path(q.JobID)
+	if err != nil {
+		return err
+	}
+	for _, link := range path {
+		if q.matches(link.VisitedAt) {
+			if err := fn(link); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Videos returns page of videos stored in the file
+func (r CSVReader) Videos(q VideoQuery) (VideoPage, error) {
+	records, err := r.records()
+	if err != nil {
+		return VideoPage{}, err
+	}
+	return queryVideos(records, q)
+}
+
+// Video returns video stored in the file with all its visits or ErrNotFound
+func (r CSVReader) Video(id string) (models.Video, []models.NextLink, error) {
+	records, err := r.records()
+	if err != nil {
+		return models.Video{}, nil, err
+	}
+	return findVideo(records, id)
+}
+
+// Path returns links stored by job ordered by number of iteration
+func (r CSVReader) Path(jobID string) ([]models.NextLink, error) {
+	var records []models.NextLink
+	err := r.scan(LinkQuery{JobID: jobID}, func(link models.NextLink) error {
+		records = append(records, link)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobPath(records, jobID), nil
+}
+
+// Close does nothing, the file is opened only while it's read
+func (r CSVReader) Close() {}
+
+// Videos returns page of videos stored in the file
+func (s *CSVStore) Videos(q VideoQuery) (VideoPage, error) {
+	return CSVReader{path: s.path}.Videos(q)
+}
+
+// Video returns video stored in the file with all its visits or ErrNotFound
+func (s *CSVStore) Video(id string) (models.Video, []models.NextLink, error) {
+	return CSVReader{path: s.path}.Video(id)
+}
+
+// Path returns links stored by job ordered by number of iteration
+func (s *CSVStore) Path(jobID string) ([]models.NextLink, error) {
+	return CSVReader{path: s.path}.Path(jobID)
+}
+
+// ScanLinks calls fn for links matching query stored in the file
+func (s *CSVStore) ScanLinks(q LinkQuery, fn func(link models.NextLink) error) error {
+	return CSVReader{path: s.path}.ScanLinks(q, fn)
+}
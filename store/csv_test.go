@@ -0,0 +1,54 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+)
+
+func TestCSVStore(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	conf := config.StoreConfig{Backend: BackendCSV, CSVPath: filepath.Join(t.TempDir(), "links.csv")}
+	for i := 0; i < 2; i++ {
+		// header is written only to new file
+		s, err := Open(conf, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, link := range testRecords[i*3 : i*3+3] {
+			link.VisitedAt = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			if err := s.Store(link); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.Close()
+	}
+
+	b, _ := os.ReadFile(conf.CSVPath)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != len(testRecords)+1 || lines[0] != strings.Join(csvHeader, ",") ||
+		lines[2] != `j1,1,aaa,bbb,"Beta 'quoted', Title: x",ch2,/watch?v=bbb,2020-01-02T03:04:05Z` {
+		t.Fatalf("Got %q", lines)
+	}
+
+	r, err := OpenReader(conf, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := r.Videos(VideoQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, []string{"aaa", "bbb", "ccc"}, page.Videos)
+	path, err := r.Path("j2")
+	if err != nil || len(path) != 3 || path[1].ID != "ccc" || path[1].ParentID != "aaa" || path[1].VisitedAt.Year() != 2020 {
+		t.Errorf("Got path %+v, err %v", path, err)
+	}
+}
@@ -0,0 +1,255 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// Errors of dead-letter replay
+var (
+	ErrNoDeadLetters = errors.New("dead-letter file isn't configured")
+	ErrUnhealthy     = errors.New("store isn't healthy")
+	ErrReplaying     = errors.New("dead letters are being replayed already")
+)
+
+// Pinger is optional interface of Storer for destinations that can check they are healthy
+type Pinger interface {
+	Ping() error
+}
+
+// DestinationStorer is optional interface of Storer that writes to more destinations, like FanOut
+// links failed with *DestinationsError are replayed only to destinations that failed to store them
+type DestinationStorer interface {
+	StoreTo(names []string, link models.NextLink) error
+}
+
+// DeadLetter is link that failed to store with the error it failed with
+type DeadLetter struct {
+	Time         time.Time       `json:"time"`                   // time link failed to store the first time
+	Error        string          `json:"error"`                  // the last error
+	Attempts     int             `json:"attempts"`               // number of failed attempts to store the link including replays
+	Destinations []string        `json:"destinations,omitempty"` // store destinations that failed to store the link, all if empty
+	Link         models.NextLink `json:"link"`
+}
+
+// ReplayResult is summary of single replay
+type ReplayResult struct {
+	Replayed int `json:"replayed"` // links stored and removed from dead-letter file
+	Failed   int `json:"failed"`   // links that failed again and are kept in dead-letter file
+}
+
+// DeadLetters is JSON Lines file of links that failed to store
+// links are appended by Add and stored again by Replay, links that fail again are kept in the file
+type DeadLetters struct {
+	path      string
+	mu        sync.Mutex
+	replaying sync.Mutex // held for the whole replay, so links aren't replayed twice by concurrent replays
+}
+
+// NewDeadLetters returns DeadLetters kept in file at path, file is created by the first failed link
+func NewDeadLetters(path string) *DeadLetters {
+	return &DeadLetters{path: path}
+}
+
+// Path returns path of dead-letter file
+func (d *DeadLetters) Path() string {
+	return d.path
+}
+
+// Add appends link that failed with err to the file and syncs it to disk
+// destinations of *DestinationsError are kept with the link, so it's replayed only to them
+func (d *DeadLetters) Add(link models.NextLink, err error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.append([]DeadLetter{{Time: time.Now(), Error: err.Error(), Attempts: 1, Destinations: failedDestinations(err), Link: link}})
+}
+
+// failedDestinations returns destinations of *DestinationsError, nil for any other error
+func failedDestinations(err error) []string {
+	var destErr *DestinationsError
+	if errors.As(err, &destErr) {
+		return destErr.Destinations
+	}
+	return nil
+}
+
+func (d *DeadLetters) append(letters []DeadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(d.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(file)
+	for _, l := range letters {
+		if err = enc.Encode(l); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// List returns all links in the file, oldest first
+func (d *DeadLetters) List() ([]DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	letters, err := readDeadLetters(d.replayPath())
+	if err != nil {
+		return nil, err
+	}
+	more, err := readDeadLetters(d.path)
+	return append(letters, more...), err
+}
+
+// replayPath is file links are moved to while they are replayed
+func (d *DeadLetters) replayPath() string {
+	return d.path + ".replay"
+}
+
+// readDeadLetters reads dead-letter file, missing file has no links
+func readDeadLetters(path string) ([]DeadLetter, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var l DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return nil, fmt.Errorf("invalid dead letter at line %d of %s: %s", n, path, err)
+		}
+		letters = append(letters, l)
+	}
+	return letters, scanner.Err()
+}
+
+// Replay stores all links of the file to s, links that fail again are kept in the file with their new error
+// s that is Pinger is checked first, so nothing is replayed until it's healthy
+// links are moved aside while they are replayed, so Add doesn't wait for the replay,
+// links left aside by interrupted replay are replayed first the next time. Only one replay runs at once,
+// concurrent one returns ErrReplaying. Links with destinations are stored only to them if s is DestinationStorer,
+// so destinations that stored them already don't get them twice
+func (d *DeadLetters) Replay(s Storer) (ReplayResult, error) {
+	var result ReplayResult
+	if !d.replaying.TryLock() {
+		return result, ErrReplaying
+	}
+	defer d.replaying.Unlock()
+	if p, ok := s.(Pinger); ok {
+		if err := p.Ping(); err != nil {
+			return result, fmt.Errorf("%w: %s", ErrUnhealthy, err)
+		}
+	}
+
+	d.mu.Lock()
+	letters, err := d.takeAll()
+	d.mu.Unlock()
+	if err != nil {
+		return result, err
+	}
+
+	ds, toDestinations := s.(DestinationStorer)
+	var failed []DeadLetter
+	for _, l := range letters {
+		var err error
+		if toDestinations && len(l.Destinations) > 0 {
+			err = ds.StoreTo(l.Destinations, l.Link)
+		} else {
+			err = s.Store(l.Link)
+		}
+		if err != nil {
+			l.Error = err.Error()
+			l.Attempts++
+			if destinations := failedDestinations(err); destinations != nil {
+				l.Destinations = destinations
+			}
+			failed = append(failed, l)
+			continue
+		}
+		result.Replayed++
+	}
+	result.Failed = len(failed)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.append(failed); err != nil {
+		return result, fmt.Errorf("failed to keep %d links that failed again, they are left in %s: %w", len(failed), d.replayPath(), err)
+	}
+	if err := os.Remove(d.replayPath()); err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	return result, nil
+}
+
+// takeAll moves dead-letter file aside and returns all links from it and from previously interrupted replay
+func (d *DeadLetters) takeAll() ([]DeadLetter, error) {
+	replay := d.replayPath()
+	if _, err := os.Stat(replay); os.IsNotExist(err) {
+		if err = os.Rename(d.path, replay); os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return readDeadLetters(replay)
+	}
+
+	// links of interrupted replay are replayed together with new ones
+	letters, err := readDeadLetters(replay)
+	if err != nil {
+		return nil, err
+	}
+	more, err := readDeadLetters(d.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(more) == 0 {
+		return letters, nil
+	}
+	// keep all of them aside so none is lost if this replay is interrupted too
+	tmp := &DeadLetters{path: replay}
+	if err = tmp.append(more); err != nil {
+		return nil, err
+	}
+	if err = os.Remove(d.path); err != nil {
+		return nil, err
+	}
+	return append(letters, more...), nil
+}
+
+// ReplayDeadLetters stores links from dead-letter file to destination of the manager
+func (m *Manager) ReplayDeadLetters() (ReplayResult, error) {
+	if m.DeadLetters == nil {
+		return ReplayResult{}, ErrNoDeadLetters
+	}
+	result, err := m.DeadLetters.Replay(m.StoreDestination)
+	m.log.WithFields(logrus.Fields{
+		"replayed": result.Replayed,
+		"failed":   result.Failed,
+		"err":      fmt.Sprint(err),
+	}).Info("Replayed dead letters")
+	return result, err
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// unhealthyStore fails to ping
+type unhealthyStore struct {
+	batchRecorder
+}
+
+func (u *unhealthyStore) Ping() error {
+	return errors.New("connection refused")
+}
+
+func TestDeadLetters(t *testing.T) {
+	d := NewDeadLetters(filepath.Join(t.TempDir(), "dead-letters.jsonl"))
+	for _, id := range []string{"a", "b", "c"} {
+		if err := d.Add(models.NextLink{ID: id, JobID: "j1"}, errors.New("deadlock")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	letters, err := d.List()
+	if err != nil || len(letters) != 3 || letters[0].Link.ID != "a" || letters[0].Error != "deadlock" || letters[0].Attempts != 1 {
+		t.Fatalf("Got %+v, err %v", letters, err)
+	}
+
+	t.Run("unhealthy store", func(t *testing.T) {
+		if _, err := d.Replay(&unhealthyStore{}); !errors.Is(err, ErrUnhealthy) {
+			t.Errorf("Got %v, want %v", err, ErrUnhealthy)
+		}
+		if letters, _ := d.List(); len(letters) != 3 {
+			t.Errorf("Got %d dead letters, want all 3 kept", len(letters))
+		}
+	})
+
+	t.Run("links failing again are kept", func(t *testing.T) {
+		s := &failingStore{failIDs: map[string]bool{"b": true}}
+		result, err := d.Replay(s)
+		if err != nil || result.Replayed != 2 || result.Failed != 1 {
+			t.Errorf("Got %+v, err %v", result, err)
+		}
+		letters, _ := d.List()
+		if len(letters) != 1 || letters[0].Link.ID != "b" || letters[0].Attempts != 2 || letters[0].Error != "disk full" {
+			t.Errorf("Got %+v", letters)
+		}
+	})
+
+	t.Run("interrupted replay", func(t *testing.T) {
+		// links left aside by replay that didn't finish are replayed with new ones
+		if err := os.Rename(d.path, d.replayPath()); err != nil {
+			t.Fatal(err)
+		}
+		d.Add(models.NextLink{ID: "d"}, errors.New("deadlock"))
+		s := &batchRecorder{}
+		result, err := d.Replay(s)
+		if _, single := s.stored(); err != nil || result.Replayed != 2 || len(single) != 2 || single[0] != "b" {
+			t.Errorf("Got %+v with %v stored, err %v", result, single, err)
+		}
+		if letters, _ := d.List(); len(letters) != 0 {
+			t.Errorf("Got %+v, want no dead letters", letters)
+		}
+		if _, err := os.Stat(d.replayPath()); !os.IsNotExist(err) {
+			t.Errorf("Got replay file left, err %v", err)
+		}
+	})
+}
+
+// blockingStore signals every stored link on started and waits until release is closed
+type blockingStore struct {
+	batchRecorder
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStore) Store(link models.NextLink) error {
+	b.started <- struct{}{}
+	<-b.release
+	return b.batchRecorder.Store(link)
+}
+
+func TestConcurrentReplay(t *testing.T) {
+	d := NewDeadLetters(filepath.Join(t.TempDir(), "dead-letters.jsonl"))
+	for _, id := range []string{"a", "b"} {
+		d.Add(models.NextLink{ID: id}, errors.New("deadlock"))
+	}
+	s := &blockingStore{started: make(chan struct{}, 2), release: make(chan struct{})}
+	done := make(chan ReplayResult)
+	go func() {
+		result, _ := d.Replay(s)
+		done <- result
+	}()
+	<-s.started
+
+	// link added meanwhile is left for the next replay
+	d.Add(models.NextLink{ID: "c"}, errors.New("deadlock"))
+	if _, err := d.Replay(&batchRecorder{}); !errors.Is(err, ErrReplaying) {
+		t.Errorf("Got %v, want %v", err, ErrReplaying)
+	}
+	close(s.release)
+	if result := <-done; result.Replayed != 2 {
+		t.Errorf("Got %+v, want 2 replayed", result)
+	}
+	if _, single := s.stored(); len(single) != 2 {
+		t.Errorf("Got %v stored, want each link once", single)
+	}
+	if letters, _ := d.List(); len(letters) != 1 || letters[0].Link.ID != "c" {
+		t.Errorf("Got %+v, want only link added during replay", letters)
+	}
+}
+
+func TestManagerDeadLetters(t *testing.T) {
+	dest := &failingStore{failIDs: map[string]bool{"b": true}}
+	m := newTestManager(dest, 2, time.Hour)
+	m.DeadLetters = NewDeadLetters(filepath.Join(t.TempDir(), "dead-letters.jsonl"))
+	go m.StoreData()
+	for _, id := range []string{"a", "b", "c"} {
+		m.StorePipe <- models.NextLink{ID: id}
+	}
+	close(m.StorePipe)
+	<-m.Shutdown
+
+	letters, err := m.DeadLetters.List()
+	if err != nil || len(letters) != 1 || letters[0].Link.ID != "b" {
+		t.Fatalf("Got %+v, err %v", letters, err)
+	}
+	delete(dest.failIDs, "b")
+	if result, err := m.ReplayDeadLetters(); err != nil || result.Replayed != 1 {
+		t.Errorf("Got %+v, err %v", result, err)
+	}
+	if _, err := NewManager(dest, m.log).ReplayDeadLetters(); err != ErrNoDeadLetters {
+		t.Errorf("Got %v, want %v", err, ErrNoDeadLetters)
+	}
+}
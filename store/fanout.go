@@ -0,0 +1,306 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// Failure policies of FanOut destination
+const (
+	PolicyRequired   = "required"    // failure is returned to Manager as failure of the whole store
+	PolicyBestEffort = "best-effort" // failure is only counted and logged
+)
+
+// Destination is single store FanOut writes to
+type Destination struct {
+	Name     string
+	Storer   Storer
+	Required bool
+}
+
+// DestinationStats are counters of single FanOut destination
+type DestinationStats struct {
+	Name        string     `json:"name"`
+	Policy      string     `json:"policy"`
+	Stored      uint64     `json:"stored"` // links stored
+	Errors      uint64     `json:"errors"` // failed writes of links, jobs and attempts
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// DestinationsError is error of link that required FanOut destinations failed to store,
+// it's kept with dead letter so the link is replayed only to destinations that failed
+type DestinationsError struct {
+	Destinations []string // names of destinations that failed
+	Err          error
+}
+
+func (e *DestinationsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DestinationsError) Unwrap() error {
+	return e.Err
+}
+
+// FanOut writes every record to all its destinations in order they were given
+// it's read from the first destination that can be read
+type FanOut struct {
+	destinations []*destination
+	log          *logrus.Logger
+}
+
+// destination is Destination with its counters
+type destination struct {
+	Destination
+	stored    uint64
+	errors    uint64
+	mu        sync.Mutex
+	lastError string
+	lastAt    time.Time
+}
+
+// NewFanOut returns FanOut writing to destinations
+func NewFanOut(log *logrus.Logger, destinations ...Destination) *FanOut {
+	f := &FanOut{log: log}
+	for _, d := range destinations {
+		f.destinations = append(f.destinations, &destination{Destination: d})
+	}
+	return f
+}
+
+// parseDestination parses `name[:policy]` item of StoreConfig.Destinations, policy defaults to required
+func parseDestination(s string) (name string, required bool, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) == 1 || parts[1] == PolicyRequired {
+		return parts[0], true, nil
+	}
+	if parts[1] == PolicyBestEffort {
+		return parts[0], false, nil
+	}
+	return "", false, fmt.Errorf("unknown failure policy '%s' of store destination '%s', use required or best-effort", parts[1], parts[0])
+}
+
+// failed counts failure of destination, it returns error if destination is required
+func (f *FanOut) failed(d *destination, n int, err error) error {
+	atomic.AddUint64(&d.errors, uint64(n))
+	d.mu.Lock()
+	d.lastError, d.lastAt = err.Error(), time.Now()
+	d.mu.Unlock()
+	if d.Required {
+		return fmt.Errorf("%s: %w", d.Name, err)
+	}
+	f.log.WithFields(logrus.Fields{
+		"destination": d.Name,
+		"err":         err.Error(),
+	}).Warn("Failed to write to best-effort store destination")
+	return nil
+}
+
+// Store stores link to all destinations, errors of required destinations are returned as *DestinationsError
+func (f *FanOut) Store(link models.NextLink) error {
+	return f.store(f.destinations, link)
+}
+
+// StoreTo stores link only to destinations with given names, it's used to replay link to destinations that failed to store it.
+// Names that aren't configured anymore are skipped, link is stored to all destinations if none of them is configured
+func (f *FanOut) StoreTo(names []string, link models.NextLink) error {
+	var destinations []*destination
+	for _, d := range f.destinations {
+		for _, name := range names {
+			if d.Name == name {
+				destinations = append(destinations, d)
+				break
+			}
+		}
+	}
+	if len(destinations) == 0 {
+		destinations = f.destinations
+	}
+	return f.store(destinations, link)
+}
+
+func (f *FanOut) store(destinations []*destination, link models.NextLink) error {
+	failed := &DestinationsError{}
+	var errs []error
+	for _, d := range destinations {
+		if err := d.Storer.Store(link); err != nil {
+			if err = f.failed(d, 1, err); err != nil {
+				failed.Destinations = append(failed.Destinations, d.Name)
+				errs = append(errs, err)
+			}
+			continue
+		}
+		atomic.AddUint64(&d.stored, 1)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	failed.Err = errors.Join(errs...)
+	return failed
+}
+
+// StoreBatch stores links to all destinations, destinations that aren't BatchStorer get links one by one
+// if batch of destination fails, links are stored to it one by one so only failing links are counted as errors.
+// Links that required destination failed to store are returned as *BatchError with *DestinationsError of every link, all other links were stored
+// to every destination, so they mustn't be stored again
+func (f *FanOut) StoreBatch(links []models.NextLink) error {
+	failed := make(map[int]*DestinationsError) // errors of required destinations by index of link
+	errs := make(map[int][]error)
+	for _, d := range f.destinations {
+		if b, ok := d.Storer.(BatchStorer); ok {
+			if err := b.StoreBatch(links); err == nil {
+				atomic.AddUint64(&d.stored, uint64(len(links)))
+				continue
+			}
+		}
+		var firstErr error
+		n := 0
+		for i, link := range links {
+			err := d.Storer.Store(link)
+			if err == nil {
+				atomic.AddUint64(&d.stored, 1)
+				continue
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			n++
+			if d.Required {
+				if failed[i] == nil {
+					failed[i] = &DestinationsError{}
+				}
+				failed[i].Destinations = append(failed[i].Destinations, d.Name)
+				errs[i] = append(errs[i], fmt.Errorf("%s: %w", d.Name, err))
+			}
+		}
+		if n > 0 {
+			f.failed(d, n, firstErr)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	batchErr := &BatchError{}
+	for i, link := range links {
+		if err, ok := failed[i]; ok {
+			err.Err = errors.Join(errs[i]...)
+			batchErr.Links = append(batchErr.Links, link)
+			batchErr.Errs = append(batchErr.Errs, err)
+		}
+	}
+	return batchErr
+}
+
+// StoreJob stores job to destinations that can store jobs
+func (f *FanOut) StoreJob(job models.Job) error {
+	var errs []error
+	for _, d := range f.destinations {
+		if s, ok := d.Storer.(JobStorer); ok {
+			if err := s.StoreJob(job); err != nil {
+				if err = f.failed(d, 1, err); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StoreAttempt stores fetch attempt to destinations that can store attempts
+func (f *FanOut) StoreAttempt(attempt models.FetchAttempt) error {
+	var errs []error
+	for _, d := range f.destinations {
+		if s, ok := d.Storer.(AttemptStorer); ok {
+			if err := s.StoreAttempt(attempt); err != nil {
+				if err = f.failed(d, 1, err); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StoreObservation stores video observation to destinations that keep observations
+func (f *FanOut) StoreObservation(o models.Observation) error {
+	var errs []error
+	for _, d := range f.destinations {
+		if s, ok := d.Storer.(ObservationStorer); ok {
+			if err := s.StoreObservation(o); err != nil {
+				if err = f.failed(d, 1, err); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping checks required destinations that can be checked
+func (f *FanOut) Ping() error {
+	for _, d := range f.destinations {
+		if p, ok := d.Storer.(Pinger); ok && d.Required {
+			if err := p.Ping(); err != nil {
+				return fmt.Errorf("%s: %w", d.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes all destinations
+func (f *FanOut) Close() {
+	for _, d := range f.destinations {
+		d.Storer.Close()
+	}
+}
+
+// Reader returns the first destination that can be read
+func (f *FanOut) Reader() (Reader, bool) {
+	for _, d := range f.destinations {
+		if r, ok := d.Storer.(Reader); ok {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Stats returns counters of destinations
+func (f *FanOut) Stats() []DestinationStats {
+	stats := make([]DestinationStats, 0, len(f.destinations))
+	for _, d := range f.destinations {
+		s := DestinationStats{
+			Name:   d.Name,
+			Policy: PolicyBestEffort,
+			Stored: atomic.LoadUint64(&d.stored),
+			Errors: atomic.LoadUint64(&d.errors),
+		}
+		if d.Required {
+			s.Policy = PolicyRequired
+		}
+		d.mu.Lock()
+		if d.lastError != "" {
+			at := d.lastAt
+			s.LastError, s.LastErrorAt = d.lastError, &at
+		}
+		d.mu.Unlock()
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// Destinations returns counters of destinations if manager stores to FanOut, it's empty for single backend
+func (m *Manager) Destinations() []DestinationStats {
+	if f, ok := m.StoreDestination.(*FanOut); ok {
+		return f.Stats()
+	}
+	return []DestinationStats{}
+}
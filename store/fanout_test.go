@@ -0,0 +1,229 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/webhooks"
+)
+
+// failingStore fails to store links with IDs in fail
+type failingStore struct {
+	batchRecorder
+	failIDs map[string]bool
+}
+
+func (f *failingStore) Store(link models.NextLink) error {
+	if f.failIDs[link.ID] {
+		return errors.New("disk full")
+	}
+	return f.batchRecorder.Store(link)
+}
+
+func (f *failingStore) StoreBatch(links []models.NextLink) error {
+	for _, l := range links {
+		if f.failIDs[l.ID] {
+			return errors.New("disk full")
+		}
+	}
+	return f.batchRecorder.StoreBatch(links)
+}
+
+func newTestFanOut(destinations ...Destination) *FanOut {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	return NewFanOut(log, destinations...)
+}
+
+func TestFanOut(t *testing.T) {
+	t.Run("best-effort failure is only counted", func(t *testing.T) {
+		primary, archive := &batchRecorder{}, &failingStore{failIDs: map[string]bool{"b": true}}
+		f := newTestFanOut(Destination{Name: "db", Storer: primary, Required: true}, Destination{Name: "archive", Storer: archive})
+		for _, id := range []string{"a", "b"} {
+			if err := f.Store(models.NextLink{ID: id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stats := f.Stats()
+		if stats[0].Stored != 2 || stats[0].Errors != 0 || stats[0].Policy != PolicyRequired {
+			t.Errorf("Got %+v for required destination", stats[0])
+		}
+		if stats[1].Stored != 1 || stats[1].Errors != 1 || stats[1].LastError != "disk full" || stats[1].LastErrorAt == nil {
+			t.Errorf("Got %+v for best-effort destination", stats[1])
+		}
+	})
+
+	t.Run("required failure is returned", func(t *testing.T) {
+		f := newTestFanOut(Destination{Name: "db", Storer: &failingStore{failIDs: map[string]bool{"a": true}}, Required: true}, Destination{Name: "archive", Storer: &batchRecorder{}})
+		if err := f.Store(models.NextLink{ID: "a"}); err == nil || !strings.Contains(err.Error(), "db: disk full") {
+			t.Errorf("Got %v, want error of required destination", err)
+		}
+	})
+
+	t.Run("failed batch is retried per destination", func(t *testing.T) {
+		primary, archive := &batchRecorder{}, &failingStore{failIDs: map[string]bool{"b": true}}
+		f := newTestFanOut(Destination{Name: "db", Storer: primary, Required: true}, Destination{Name: "archive", Storer: archive})
+		if err := f.StoreBatch([]models.NextLink{{ID: "a"}, {ID: "b"}, {ID: "c"}}); err != nil {
+			t.Fatal(err)
+		}
+		if batches, single := primary.stored(); len(batches) != 1 || len(single) != 0 {
+			t.Errorf("Got batches %v and single %v of required destination", batches, single)
+		}
+		if _, single := archive.stored(); len(single) != 2 {
+			t.Errorf("Got single %v, want a and c stored one by one", single)
+		}
+		if stats := f.Stats(); stats[1].Stored != 2 || stats[1].Errors != 1 {
+			t.Errorf("Got %+v", stats[1])
+		}
+	})
+
+	t.Run("healthy destinations get batch once if required one fails", func(t *testing.T) {
+		primary, archive := &batchRecorder{}, &batchRecorder{}
+		broken := &failingStore{failIDs: map[string]bool{"b": true}}
+		f := newTestFanOut(Destination{Name: "db", Storer: primary, Required: true},
+			Destination{Name: "broken", Storer: broken, Required: true}, Destination{Name: "archive", Storer: archive})
+		m := newTestManager(f, 3, time.Hour)
+		m.DeadLetters = NewDeadLetters(filepath.Join(t.TempDir(), "dead.jsonl"))
+		go m.StoreData()
+		for _, id := range []string{"a", "b", "c"} {
+			m.StorePipe <- models.NextLink{ID: id}
+		}
+		close(m.StorePipe)
+		<-m.Shutdown
+
+		assertStoredOnce := func(brokenHasB bool) {
+			t.Helper()
+			for name, r := range map[string]*batchRecorder{"db": primary, "archive": archive, "broken": &broken.batchRecorder} {
+				count := map[string]int{}
+				batches, single := r.stored()
+				for _, b := range batches {
+					for _, id := range b {
+						count[id]++
+					}
+				}
+				for _, id := range single {
+					count[id]++
+				}
+				want := map[string]int{"a": 1, "b": 1, "c": 1}
+				if name == "broken" && !brokenHasB {
+					delete(want, "b")
+				}
+				if len(count) != len(want) || count["a"] != 1 || count["b"] != want["b"] || count["c"] != 1 {
+					t.Errorf("Got %v stored by %s, want %v", count, name, want)
+				}
+			}
+		}
+		assertStoredOnce(false)
+		letters, err := m.DeadLetters.List()
+		if err != nil || len(letters) != 1 || letters[0].Link.ID != "b" || !strings.Contains(letters[0].Error, "broken: disk full") ||
+			len(letters[0].Destinations) != 1 || letters[0].Destinations[0] != "broken" {
+			t.Errorf("Got dead letters %+v, err %v", letters, err)
+		}
+
+		// replayed link goes only to destination that failed to store it
+		broken.failIDs = nil
+		if result, err := m.ReplayDeadLetters(); err != nil || result.Replayed != 1 {
+			t.Fatalf("Got %+v, err %v", result, err)
+		}
+		assertStoredOnce(true)
+	})
+
+	t.Run("failed destinations are returned with error", func(t *testing.T) {
+		f := newTestFanOut(Destination{Name: "db", Storer: &batchRecorder{}, Required: true},
+			Destination{Name: "broken", Storer: &failingStore{failIDs: map[string]bool{"a": true}}, Required: true})
+		var destErr *DestinationsError
+		if err := f.Store(models.NextLink{ID: "a"}); !errors.As(err, &destErr) || len(destErr.Destinations) != 1 || destErr.Destinations[0] != "broken" {
+			t.Errorf("Got %v, want error of broken destination", err)
+		}
+	})
+
+	t.Run("read from the first reader", func(t *testing.T) {
+		s := newTestSQLiteStore(t, "")
+		f := newTestFanOut(Destination{Name: "archive", Storer: &batchRecorder{}}, Destination{Name: "sqlite", Storer: s, Required: true})
+		m := NewManager(f, logrus.New())
+		if r, ok := m.Reader(); !ok || r != Reader(s) {
+			t.Errorf("Got reader %v, want sqlite store", r)
+		}
+		if stats := m.Destinations(); len(stats) != 2 {
+			t.Errorf("Got %+v", stats)
+		}
+	})
+}
+
+func TestOpenDestinations(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+
+	t.Run("fan out", func(t *testing.T) {
+		c := config.StoreConfig{Backend: "test-ok", Destinations: []string{"jsonl:best-effort", "test-ok:required"}, JSONLPath: filepath.Join(t.TempDir(), "links.jsonl")}
+		s, err := Open(c, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		stats := s.(*FanOut).Stats()
+		if len(stats) != 3 || stats[0].Name != "test-ok" || stats[1].Policy != PolicyBestEffort || stats[2].Policy != PolicyRequired {
+			t.Errorf("Got %+v", stats)
+		}
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		if _, err := Open(config.StoreConfig{Backend: "test-ok", Destinations: []string{"jsonl:maybe"}}, log); err == nil || !strings.Contains(err.Error(), "unknown failure policy") {
+			t.Errorf("Got %v, want invalid policy error", err)
+		}
+	})
+
+	t.Run("destination failing to open", func(t *testing.T) {
+		if _, err := Open(config.StoreConfig{Backend: "test-ok", Destinations: []string{"test-broken:best-effort"}}, log); err == nil || !strings.Contains(err.Error(), "access denied") {
+			t.Errorf("Got %v, want error of broken destination", err)
+		}
+	})
+}
+
+func TestWebhookStore(t *testing.T) {
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(webhooks.SignatureHeader) != webhooks.Sign("secret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		bodies = append(bodies, body)
+	}))
+	defer srv.Close()
+
+	s, err := NewWebhookStore(srv.URL, "secret", logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Store(models.NextLink{ID: "aaa"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreBatch([]models.NextLink{{ID: "bbb"}, {ID: "ccc"}}); err != nil {
+		t.Fatal(err)
+	}
+	var link models.NextLink
+	var links []models.NextLink
+	if len(bodies) != 2 || json.Unmarshal(bodies[0], &link) != nil || json.Unmarshal(bodies[1], &links) != nil || link.ID != "aaa" || len(links) != 2 {
+		t.Errorf("Got bodies %q", bodies)
+	}
+
+	s.secret = "wrong"
+	if err := s.Store(models.NextLink{ID: "aaa"}); err == nil {
+		t.Error("Got no error for rejected request")
+	}
+	if _, err := NewWebhookStore("ftp://example.com", "", logrus.New()); err == nil {
+		t.Error("Got no error for invalid URL")
+	}
+}
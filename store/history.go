@@ -0,0 +1,180 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// ObservationStorer is optional interface of Storer for destinations that keep metadata observations of videos
+type ObservationStorer interface {
+	StoreObservation(o models.Observation) error
+}
+
+// HistoryQuery selects observations of single video, From is inclusive and To exclusive, zero time isn't limited
+// observations are filtered to those that changed Field if it's set
+type HistoryQuery struct {
+	VideoID string
+	From    time.Time
+	To      time.Time
+	Field   string
+}
+
+// HistoryReader is optional interface of Reader for stores that keep metadata observations of videos
+type HistoryReader interface {
+	History(q HistoryQuery) ([]models.Observation, error)
+}
+
+// CheckField returns error if field isn't metadata field of observation
+func CheckField(field string) error {
+	switch field {
+	case "", models.FieldTitle, models.FieldChannel, models.FieldViews, models.FieldLikes:
+		return nil
+	}
+	return fmt.Errorf("unknown field '%s', use title, channel, views or likes", field)
+}
+
+// StoreObservation stores metadata of video seen on its page if destination keeps observations
+func (m *Manager) StoreObservation(o models.Observation) {
+	s, ok := m.StoreDestination.(ObservationStorer)
+	if !ok {
+		return
+	}
+	if err := s.StoreObservation(o); err != nil {
+		m.log.WithFields(logrus.Fields{
+			"err":     err.Error(),
+			"jobID":   o.JobID,
+			"videoID": o.VideoID,
+		}).Warn("Failed to store video observation")
+	}
+}
+
+// storeObservation inserts observation with fields changed since the previous observation of the video,
+// previous observation is read in the same transaction
+func (r sqlReader) storeObservation(o models.Observation) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var prev *models.Observation
+	err = r.scanObservations(tx, func(p models.Observation) error {
+		prev = &p
+		return nil
+	}, "video_id = ? order by observed_at desc, id desc limit 1", o.VideoID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(rebind(r.dialect, "insert into "+r.prefix+"video_observations (video_id, job_id, observed_at, title, channel, views, likes, changed) values (?, ?, ?, ?, ?, ?, ?, ?)"),
+		o.VideoID, o.JobID, o.ObservedAt.UTC(), o.Title, o.Channel, nullInt(o.Views), nullInt(o.Likes), strings.Join(o.Diff(prev), ","))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// History returns observations of video matching query, oldest first
+func (r sqlReader) History(q HistoryQuery) ([]models.Observation, error) {
+	if err := CheckField(q.Field); err != nil {
+		return nil, err
+	}
+	condition, args := "video_id = ?", []interface{}{q.VideoID}
+	if !q.From.IsZero() {
+		condition, args = condition+" and observed_at >= ?", append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		condition, args = condition+" and observed_at < ?", append(args, q.To.UTC())
+	}
+	observations := []models.Observation{}
+	err := r.scanObservations(r.db, func(o models.Observation) error {
+		if q.Field == "" || changed(o, q.Field) {
+			observations = append(observations, o)
+		}
+		return nil
+	}, condition+" order by observed_at, id", args...)
+	return observations, err
+}
+
+// changed returns true if field of observation changed
+func changed(o models.Observation, field string) bool {
+	for _, f := range o.Changed {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// queryer is *sql.DB or *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// scanObservations calls fn for every observation matching condition
+func (r sqlReader) scanObservations(db queryer, fn func(o models.Observation) error, condition string, args ...interface{}) error {
+	rows, err := db.Query(rebind(r.dialect, "select video_id, job_id, observed_at, title, channel, views, likes, changed from "+
+		r.prefix+"video_observations where "+condition), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o models.Observation
+		var views, likes sql.NullInt64
+		var changed string
+		if err := rows.Scan(&o.VideoID, &o.JobID, &o.ObservedAt, &o.Title, &o.Channel, &views, &likes, &changed); err != nil {
+			return err
+		}
+		o.Views, o.Likes = validInt(views), validInt(likes)
+		o.Changed = []string{}
+		if changed != "" {
+			o.Changed = strings.Split(changed, ",")
+		}
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// nullInt returns NULL for nil
+func nullInt(i *int64) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *i, Valid: true}
+}
+
+// validInt returns pointer to valid integer, nil otherwise
+func validInt(i sql.NullInt64) *int64 {
+	if !i.Valid {
+		return nil
+	}
+	return &i.Int64
+}
+
+// StoreObservation inserts metadata observation of video
+func (db *DbStore) StoreObservation(o models.Observation) error {
+	return db.reader().storeObservation(o)
+}
+
+// History returns observations of video stored in DB
+func (db *DbStore) History(q HistoryQuery) ([]models.Observation, error) {
+	return db.reader().History(q)
+}
+
+// StoreObservation inserts metadata observation of video
+func (s *sqlStore) StoreObservation(o models.Observation) error {
+	return s.reader().storeObservation(o)
+}
+
+// History returns observations of video stored in DB
+func (s *sqlStore) History(q HistoryQuery) ([]models.Observation, error) {
+	return s.reader().History(q)
+}
@@ -0,0 +1,558 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// Compressions of JSONLStore files
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Sync policies of JSONLStore, any other policy is interval of periodic sync like `1s`
+const (
+	SyncNever  = "never"  // data are flushed on rotation and close, syncing is left to OS
+	SyncAlways = "always" // data are flushed and synced after every record
+)
+
+// extensions of compressed files
+var compressionExt = map[string]string{
+	CompressionNone: "",
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
+// JSONLOptions configures JSONLStore
+type JSONLOptions struct {
+	Path        string        // path of the file, extension of compression is appended to it
+	Compression string        // one of Compressions, defaults to CompressionNone
+	Sync        string        // one of Sync policies or interval, defaults to SyncNever
+	MaxSize     int64         // rotate file once this many bytes were written to it, 0 disables size rotation
+	RotateEvery time.Duration // rotate file once it's open this long, 0 disables time rotation
+	Out         io.Writer     // path of the file is printed here, os.Stdout if nil
+}
+
+// JSONLStore writes links as JSON Lines to file using JSON tags of models.NextLink
+// active file is always at the same path, rotated files are renamed to `<name>-<time it was opened><ext>`
+type JSONLStore struct {
+	opts      JSONLOptions
+	path      string
+	syncEvery time.Duration
+
+	mu         sync.Mutex
+	file       *os.File
+	size       int64 // bytes written to active file
+	opened     time.Time
+	compressor compressor // nil if file isn't compressed
+	encoder    *json.Encoder
+	dirty      bool // some records weren't synced yet
+
+	stop chan struct{}
+	done chan struct{}
+	log  *logrus.Logger
+}
+
+// compressor is compressing writer that can flush data written so far
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// countingWriter counts bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// NewJSONLStore opens file configured by options for appending and returns JSONLStore writing to it
+func NewJSONLStore(opts JSONLOptions, log *logrus.Logger) (*JSONLStore, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("missing path of JSON Lines file")
+	}
+	if opts.Compression == "" {
+		opts.Compression = CompressionNone
+	}
+	ext, ok := compressionExt[opts.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression '%s', use none, gzip or zstd", opts.Compression)
+	}
+	s := &JSONLStore{opts: opts, path: opts.Path + ext, log: log}
+
+	switch opts.Sync {
+	case "", SyncNever, SyncAlways:
+	default:
+		d, err := time.ParseDuration(opts.Sync)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid sync policy '%s', use never, always or interval like 1s", opts.Sync)
+		}
+		s.syncEvery = d
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(output(opts.Out), "Storing data to '%s'\n", s.path)
+	log.WithFields(logrus.Fields{
+		"path":        s.path,
+		"compression": opts.Compression,
+		"sync":        opts.Sync,
+	}).Debug("Opened JSON Lines file")
+
+	if s.syncEvery > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+// NewJSONLStoreFromConfig returns JSONLStore configured by JSONL settings of store config
+func NewJSONLStoreFromConfig(c config.StoreConfig, log *logrus.Logger) (*JSONLStore, error) {
+	return NewJSONLStore(JSONLOptions{
+		Path:        c.JSONLPath,
+		Compression: c.JSONLCompression,
+		Sync:        c.JSONLSync,
+		MaxSize:     int64(c.JSONLMaxSizeMB) << 20,
+		RotateEvery: c.JSONLRotateEvery,
+		Out:         c.Out,
+	}, log)
+}
+
+// open opens active file, compressed data are appended as new gzip member or zstd frame
+func (s *JSONLStore) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.size, s.opened, s.dirty = file, info.Size(), time.Now(), false
+
+	var w io.Writer = countingWriter{w: file, n: &s.size}
+	switch s.opts.Compression {
+	case CompressionGzip:
+		s.compressor = gzip.NewWriter(w)
+	case CompressionZstd:
+		if s.compressor, err = zstd.NewWriter(w); err != nil {
+			file.Close()
+			return err
+		}
+	default:
+		s.compressor = nil
+	}
+	if s.compressor != nil {
+		w = s.compressor
+	}
+	s.encoder = json.NewEncoder(w)
+	return nil
+}
+
+// Store writes link as single line, file is rotated before writing if it's too big or too old
+func (s *JSONLStore) Store(link models.NextLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.needsRotation() {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if err := s.encoder.Encode(link); err != nil {
+		return err
+	}
+	s.dirty = true
+	if s.opts.Sync == SyncAlways {
+		return s.sync()
+	}
+	return nil
+}
+
+// needsRotation reports whether active file reached max size or age, empty file isn't rotated
+func (s *JSONLStore) needsRotation() bool {
+	if s.size == 0 && !s.dirty {
+		return false
+	}
+	return (s.opts.MaxSize > 0 && s.size >= s.opts.MaxSize) ||
+		(s.opts.RotateEvery > 0 && time.Since(s.opened) >= s.opts.RotateEvery)
+}
+
+// rotate closes active file, renames it and opens new active file
+func (s *JSONLStore) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	rotated := s.rotatedPath()
+	if err := os.Rename(s.path, rotated); err != nil {
+		// keep writing to the same file rather than losing records
+		if openErr := s.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	s.log.WithFields(logrus.Fields{
+		"path": rotated,
+	}).Info("Rotated JSON Lines file")
+	return s.open()
+}
+
+// rotatedPath returns unused path for active file named by time it was opened
+func (s *JSONLStore) rotatedPath() string {
+	ext := filepath.Ext(s.opts.Path)
+	name := strings.TrimSuffix(s.opts.Path, ext) + "-" + s.opened.UTC().Format("20060102T150405Z")
+	ext += compressionExt[s.opts.Compression]
+	rotated := name + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			return rotated
+		}
+		rotated = name + "-" + strconv.Itoa(i) + ext
+	}
+}
+
+// sync flushes compressor and syncs active file to disk
+func (s *JSONLStore) sync() error {
+	if s.compressor != nil {
+		if err := s.compressor.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// closeFile finishes compressed stream and closes active file
+func (s *JSONLStore) closeFile() error {
+	if s.compressor != nil {
+		if err := s.compressor.Close(); err != nil {
+			s.file.Close()
+			return err
+		}
+	}
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// syncLoop syncs written records every interval of sync policy and rotates file that got too old meanwhile
+func (s *JSONLStore) syncLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.syncEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			var err error
+			if s.needsRotation() {
+				err = s.rotate()
+			} else if s.dirty {
+				err = s.sync()
+			}
+			s.mu.Unlock()
+			if err != nil {
+				s.log.WithFields(logrus.Fields{
+					"path": s.path,
+					"err":  err.Error(),
+				}).Warn("Failed to sync JSON Lines file")
+			}
+		}
+	}
+}
+
+// Close flushes written records and closes the file
+func (s *JSONLStore) Close() {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.closeFile(); err != nil {
+		s.log.WithFields(logrus.Fields{
+			"path": s.path,
+			"err":  err.Error(),
+		}).Warn("Failed to close JSON Lines file")
+	}
+}
+
+// JSONLReader reads links back from files of JSONLStore, rotated files are read first in order they were rotated
+// and active file last. Files are decompressed by their extension, so files written with other compression are read too
+type JSONLReader struct {
+	opts  JSONLOptions
+	lock  sync.Locker  // held while files are opened so active file isn't rotated meanwhile, nil if nothing writes
+	flush func() error // flushes records written so far, nil if nothing writes
+}
+
+// NewJSONLReader returns reader of files written by JSONLStore configured by JSONL settings of store config
+// it fails if there are no such files
+func NewJSONLReader(c config.StoreConfig) (JSONLReader, error) {
+	r := JSONLReader{opts: JSONLOptions{Path: c.JSONLPath}}
+	files, err := r.files()
+	if err != nil {
+		return JSONLReader{}, err
+	}
+	if len(files) == 0 {
+		return JSONLReader{}, fmt.Errorf("no JSON Lines files at '%s'", c.JSONLPath)
+	}
+	return r, nil
+}
+
+// reader returns JSONLReader of files the store writes to
+func (s *JSONLStore) reader() JSONLReader {
+	return JSONLReader{opts: s.opts, lock: &s.mu, flush: s.flush}
+}
+
+// flush writes records buffered by compressor to active file without syncing it
+func (s *JSONLStore) flush() error {
+	if s.compressor != nil {
+		return s.compressor.Flush()
+	}
+	return nil
+}
+
+// files returns rotated files in order they were rotated followed by active file if it exists
+func (r JSONLReader) files() ([]string, error) {
+	ext := filepath.Ext(r.opts.Path)
+	name := strings.TrimSuffix(r.opts.Path, ext)
+	var rotated, active []string
+	for _, compExt := range []string{"", ".gz", ".zst"} {
+		matches, err := filepath.Glob(name + "-*" + ext + compExt)
+		if err != nil {
+			return nil, err
+		}
+		rotated = append(rotated, matches...)
+		if _, err := os.Stat(r.opts.Path + compExt); err == nil {
+			active = append(active, r.opts.Path+compExt)
+		}
+	}
+	// rotated file isn't written after it's renamed, so modification time orders them
+	modTimes := make(map[string]time.Time, len(rotated))
+	for _, f := range rotated {
+		if info, err := os.Stat(f); err == nil {
+			modTimes[f] = info.ModTime()
+		}
+	}
+	sort.SliceStable(rotated, func(i, j int) bool {
+		if !modTimes[rotated[i]].Equal(modTimes[rotated[j]]) {
+			return modTimes[rotated[i]].Before(modTimes[rotated[j]])
+		}
+		return rotated[i] < rotated[j]
+	})
+	return append(rotated, active...), nil
+}
+
+// open opens all files, records written to active file so far are flushed first
+func (r JSONLReader) open() ([]*os.File, error) {
+	if r.lock != nil {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if err := r.flush(); err != nil {
+			return nil, err
+		}
+	}
+	names, err := r.files()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*os.File, 0, len(names))
+	for _, name := range names {
+		file, err := os.Open(name)
+		if err != nil {
+			closeFiles(files)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// ScanLinks calls fn for links matching query in order they were stored, links of single job are ordered by number
+// of iteration, so they are read to memory first
+func (r JSONLReader) ScanLinks(q LinkQuery, fn func(link models.NextLink) error) error {
+	if q.JobID == "" {
+		return r.scan(q, fn)
+	}
+	var path []models.NextLink
+	err := r.scan(q, func(link models.NextLink) error {
+		path = append(path, link)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(path, func(i, j int) bool {
+		return path[i].Number < path[j].Number
+	})
+	for _, link := range path {
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan calls fn for links matching query in order they were stored
+func (r JSONLReader) scan(q LinkQuery, fn func(link models.NextLink) error) error {
+	files, err := r.open()
+	if err != nil {
+		return err
+	}
+	defer closeFiles(files)
+	for _, file := range files {
+		// active file can end with part of record that is being written
+		active := strings.HasPrefix(file.Name(), r.opts.Path)
+		if err := scanJSONL(file, active, q, fn); err != nil {
+			return fmt.Errorf("failed to read '%s': %w", file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// scanJSONL calls fn for links of file matching query, unfinished record at the end of active file is skipped
+func scanJSONL(file *os.File, active bool, q LinkQuery, fn func(link models.NextLink) error) error {
+	var r io.Reader = file
+	switch filepath.Ext(file.Name()) {
+	case ".gz":
+		gz, err := gzip.NewReader(file)
+		if err == io.EOF && active {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case ".zst":
+		d, err := zstd.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+		r = d
+	}
+
+	lines := bufio.NewReader(r)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF || (active && err == io.ErrUnexpectedEOF) {
+				if len(bytes.TrimSpace(line)) == 0 || active {
+					return nil
+				}
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		var link models.NextLink
+		if err := json.Unmarshal(line, &link); err != nil {
+			return err
+		}
+		if (q.JobID != "" && link.JobID != q.JobID) || !q.matches(link.VisitedAt) {
+			continue
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+}
+
+// records reads all links
+func (r JSONLReader) records() ([]models.NextLink, error) {
+	var records []models.NextLink
+	err := r.scan(LinkQuery{}, func(link models.NextLink) error {
+		records = append(records, link)
+		return nil
+	})
+	return records, err
+}
+
+// Videos returns page of videos stored in files
+func (r JSONLReader) Videos(q VideoQuery) (VideoPage, error) {
+	records, err := r.records()
+	if err != nil {
+		return VideoPage{}, err
+	}
+	return queryVideos(records, q)
+}
+
+// Video returns video stored in files with all its visits or ErrNotFound
+func (r JSONLReader) Video(id string) (models.Video, []models.NextLink, error) {
+	records, err := r.records()
+	if err != nil {
+		return models.Video{}, nil, err
+	}
+	return findVideo(records, id)
+}
+
+// Path returns links stored by job ordered by number of iteration
+func (r JSONLReader) Path(jobID string) ([]models.NextLink, error) {
+	path := []models.NextLink{}
+	err := r.ScanLinks(LinkQuery{JobID: jobID}, func(link models.NextLink) error {
+		path = append(path, link)
+		return nil
+	})
+	return path, err
+}
+
+// Close does nothing, files are opened only while they are read
+func (r JSONLReader) Close() {}
+
+// Videos returns page of videos stored in files
+func (s *JSONLStore) Videos(q VideoQuery) (VideoPage, error) {
+	return s.reader().Videos(q)
+}
+
+// Video returns video stored in files with all its visits or ErrNotFound
+func (s *JSONLStore) Video(id string) (models.Video, []models.NextLink, error) {
+	return s.reader().Video(id)
+}
+
+// Path returns links stored by job ordered by number of iteration
+func (s *JSONLStore) Path(jobID string) ([]models.NextLink, error) {
+	return s.reader().Path(jobID)
+}
+
+// ScanLinks calls fn for links matching query stored in files
+func (s *JSONLStore) ScanLinks(q LinkQuery, fn func(link models.NextLink) error) error {
+	return s.reader().ScanLinks(q, fn)
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+func newTestJSONLStore(t *testing.T, opts JSONLOptions) *JSONLStore {
+	t.Helper()
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	opts.Path = filepath.Join(t.TempDir(), "links.jsonl")
+	s, err := NewJSONLStore(opts, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// readJSONL reads records from all files in directory of the store
+func readJSONL(t *testing.T, s *JSONLStore) ([]models.NextLink, int) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(s.path), "links*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	var records []models.NextLink
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = file
+		switch s.opts.Compression {
+		case CompressionGzip:
+			if r, err = gzip.NewReader(file); err != nil {
+				t.Fatal(err)
+			}
+		case CompressionZstd:
+			d, err := zstd.NewReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			r = d
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			var link models.NextLink
+			if err := json.Unmarshal(scanner.Bytes(), &link); err != nil {
+				t.Fatalf("Failed to decode line '%s' of %s: %s", scanner.Text(), name, err)
+			}
+			records = append(records, link)
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+	return records, len(files)
+}
+
+func storeTestRecords(t *testing.T, s *JSONLStore) {
+	t.Helper()
+	for _, link := range testRecords {
+		link.VisitedAt = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		if err := s.Store(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestJSONLStore(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			s := newTestJSONLStore(t, JSONLOptions{Compression: compression, Sync: SyncAlways})
+			storeTestRecords(t, s)
+			s.Close()
+
+			records, files := readJSONL(t, s)
+			if files != 1 || len(records) != len(testRecords) {
+				t.Fatalf("Got %d records in %d files, want %d in 1 file", len(records), files, len(testRecords))
+			}
+			for i, got := range records {
+				want := testRecords[i]
+				if got.ID != want.ID || got.Title != want.Title || got.ParentID != want.ParentID || got.JobID != want.JobID || got.VisitedAt.Year() != 2020 {
+					t.Errorf("Got %+v, want %+v", got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("appends to existing file", func(t *testing.T) {
+		s := newTestJSONLStore(t, JSONLOptions{Compression: CompressionGzip})
+		storeTestRecords(t, s)
+		s.Close()
+		s, err := NewJSONLStore(s.opts, s.log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		storeTestRecords(t, s)
+		s.Close()
+		if records, _ := readJSONL(t, s); len(records) != 2*len(testRecords) {
+			t.Errorf("Got %d records, want %d", len(records), 2*len(testRecords))
+		}
+	})
+
+	t.Run("size rotation", func(t *testing.T) {
+		s := newTestJSONLStore(t, JSONLOptions{MaxSize: 300})
+		storeTestRecords(t, s)
+		s.Close()
+		records, files := readJSONL(t, s)
+		if len(records) != len(testRecords) || files < 2 {
+			t.Errorf("Got %d records in %d files, want %d records in more files", len(records), files, len(testRecords))
+		}
+	})
+
+	t.Run("time rotation", func(t *testing.T) {
+		s := newTestJSONLStore(t, JSONLOptions{Compression: CompressionZstd, RotateEvery: time.Nanosecond})
+		storeTestRecords(t, s)
+		s.Close()
+		records, files := readJSONL(t, s)
+		if len(records) != len(testRecords) || files != len(testRecords) {
+			t.Errorf("Got %d records in %d files, want every record in its own file", len(records), files)
+		}
+	})
+
+	t.Run("interval sync", func(t *testing.T) {
+		s := newTestJSONLStore(t, JSONLOptions{Compression: CompressionGzip, Sync: "10ms"})
+		defer s.Close()
+		storeTestRecords(t, s)
+		time.Sleep(50 * time.Millisecond)
+		s.mu.Lock()
+		dirty := s.dirty
+		s.mu.Unlock()
+		if dirty {
+			t.Error("Got unsynced records after sync interval")
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		log := logrus.New()
+		for _, opts := range []JSONLOptions{
+			{Path: filepath.Join(t.TempDir(), "a.jsonl"), Compression: "lz4"},
+			{Path: filepath.Join(t.TempDir(), "b.jsonl"), Sync: "sometimes"},
+			{Path: filepath.Join(t.TempDir(), "c.jsonl"), Sync: "-1s"},
+			{},
+		} {
+			if _, err := NewJSONLStore(opts, log); err == nil {
+				t.Errorf("Got no error for %+v", opts)
+			}
+		}
+	})
+}
+
+func TestJSONLReader(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			s := newTestJSONLStore(t, JSONLOptions{Compression: compression, RotateEvery: time.Nanosecond})
+			storeTestRecords(t, s)
+
+			// records buffered by compressor of open store are read too
+			var links []models.NextLink
+			err := s.ScanLinks(LinkQuery{}, func(l models.NextLink) error {
+				links = append(links, l)
+				return nil
+			})
+			if err != nil || len(links) != len(testRecords) {
+				t.Fatalf("Got %+v, err %v", links, err)
+			}
+			for i, l := range links {
+				if l.ID != testRecords[i].ID || l.JobID != testRecords[i].JobID || l.Number != testRecords[i].Number {
+					t.Errorf("Got %+v at %d, want links in order they were stored", l, i)
+				}
+			}
+			page, err := s.Videos(VideoQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertIDs(t, []string{"aaa", "bbb", "ccc"}, page.Videos)
+			s.Close()
+			if _, files := readJSONL(t, s); files < 2 {
+				t.Errorf("Got %d files, want rotated files", files)
+			}
+
+			r, err := NewJSONLReader(config.StoreConfig{JSONLPath: s.opts.Path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			path, err := r.Path("j2")
+			if err != nil || len(path) != 3 || path[1].ID != "ccc" || path[2].Number != 2 {
+				t.Errorf("Got path %+v, err %v", path, err)
+			}
+			if _, visits, err := r.Video("bbb"); err != nil || len(visits) != 1 {
+				t.Errorf("Got visits %+v, err %v", visits, err)
+			}
+		})
+	}
+
+	t.Run("unfinished record of active file is skipped", func(t *testing.T) {
+		s := newTestJSONLStore(t, JSONLOptions{})
+		storeTestRecords(t, s)
+		s.Close()
+		f, _ := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+		f.WriteString(`{"id":"ddd","job_`)
+		f.Close()
+		r, err := OpenReader(config.StoreConfig{Backend: BackendJSONL, JSONLPath: s.opts.Path}, s.log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page, err := r.Videos(VideoQuery{}); err != nil || len(page.Videos) != 3 {
+			t.Errorf("Got %+v, err %v", page, err)
+		}
+	})
+
+	t.Run("missing files", func(t *testing.T) {
+		if _, err := NewJSONLReader(config.StoreConfig{JSONLPath: filepath.Join(t.TempDir(), "links.jsonl")}); err == nil {
+			t.Error("Got no error for missing files")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// batchRecorder records batches and links stored one by one
+type batchRecorder struct {
+	sync.Mutex
+	batches [][]string
+	single  []string
+	fail    bool
+	block   chan struct{} // StoreBatch waits until it's closed if it's set
+}
+
+func (b *batchRecorder) Store(link models.NextLink) error {
+	b.Lock()
+	defer b.Unlock()
+	b.single = append(b.single, link.ID)
+	return nil
+}
+
+func (b *batchRecorder) StoreBatch(links []models.NextLink) error {
+	if b.block != nil {
+		<-b.block
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.fail {
+		return errors.New("deadlock")
+	}
+	var ids []string
+	for _, l := range links {
+		ids = append(ids, l.ID)
+	}
+	b.batches = append(b.batches, ids)
+	return nil
+}
+
+func (b *batchRecorder) Close() {}
+
+func (b *batchRecorder) stored() ([][]string, []string) {
+	b.Lock()
+	defer b.Unlock()
+	return append([][]string{}, b.batches...), append([]string{}, b.single...)
+}
+
+func newTestManager(dest Storer, batchSize int, interval time.Duration) *Manager {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	m := NewManager(dest, log)
+	m.BatchSize, m.FlushInterval = batchSize, interval
+	return m
+}
+
+func TestManagerBatches(t *testing.T) {
+	t.Run("flush by count and on close", func(t *testing.T) {
+		dest := &batchRecorder{}
+		m := newTestManager(dest, 3, time.Hour)
+		go m.StoreData()
+		for _, id := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+			m.StorePipe <- models.NextLink{ID: id}
+		}
+		close(m.StorePipe)
+		<-m.Shutdown
+		batches, single := dest.stored()
+		if len(batches) != 3 || len(batches[0]) != 3 || len(batches[1]) != 3 || len(batches[2]) != 1 || batches[2][0] != "g" || len(single) != 0 {
+			t.Errorf("Got batches %v and single %v", batches, single)
+		}
+	})
+
+	t.Run("flush by interval", func(t *testing.T) {
+		dest := &batchRecorder{}
+		m := newTestManager(dest, 100, 10*time.Millisecond)
+		go m.StoreData()
+		defer close(m.StorePipe)
+		m.StorePipe <- models.NextLink{ID: "a"}
+		time.Sleep(50 * time.Millisecond)
+		if batches, _ := dest.stored(); len(batches) != 1 {
+			t.Errorf("Got batches %v, want link flushed by interval", batches)
+		}
+	})
+
+	t.Run("failed batch is stored one by one", func(t *testing.T) {
+		dest := &batchRecorder{fail: true}
+		m := newTestManager(dest, 2, time.Hour)
+		go m.StoreData()
+		m.StorePipe <- models.NextLink{ID: "a"}
+		m.StorePipe <- models.NextLink{ID: "b"}
+		close(m.StorePipe)
+		<-m.Shutdown
+		if _, single := dest.stored(); len(single) != 2 {
+			t.Errorf("Got single %v, want both links", single)
+		}
+	})
+
+	t.Run("batching disabled", func(t *testing.T) {
+		dest := &batchRecorder{}
+		m := newTestManager(dest, 1, time.Hour)
+		go m.StoreData()
+		m.StorePipe <- models.NextLink{ID: "a"}
+		close(m.StorePipe)
+		<-m.Shutdown
+		if batches, single := dest.stored(); len(batches) != 0 || len(single) != 1 {
+			t.Errorf("Got batches %v and single %v", batches, single)
+		}
+	})
+
+	t.Run("backpressure", func(t *testing.T) {
+		dest := &batchRecorder{block: make(chan struct{})}
+		m := newTestManager(dest, 2, time.Hour)
+		m.StorePipe = make(chan models.NextLink, 2)
+		go m.StoreData()
+		// the first two links are taken to batch that blocks, next two fill the pipe
+		for i := 0; i < 4; i++ {
+			m.StorePipe <- models.NextLink{ID: "a"}
+		}
+		select {
+		case m.StorePipe <- models.NextLink{ID: "b"}:
+			t.Error("Got link accepted while store is blocked and pipe is full")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(dest.block)
+		m.StorePipe <- models.NextLink{ID: "b"}
+		close(m.StorePipe)
+		<-m.Shutdown
+		batches, _ := dest.stored()
+		n := 0
+		for _, batch := range batches {
+			n += len(batch)
+		}
+		if n != 5 {
+			t.Errorf("Got batches %v, want 5 links", batches)
+		}
+	})
+}
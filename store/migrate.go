@@ -0,0 +1,211 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialects with embedded migrations
+const (
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+// migrationFS holds SQL migrations, each dialect has its own directory with files named `<version>_<name>.sql`
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+// validPrefix allows only characters that can't break SQL statements
+var validPrefix = regexp.MustCompile(`^[A-Za-z0-9_]*$`)
+
+// Migration is single versioned change of DB schema
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string // statements with `{prefix}` placeholder for table prefix
+}
+
+// MigrationStatus is migration with time it was applied, Applied is empty for pending migrations
+type MigrationStatus struct {
+	Migration
+	Applied string
+}
+
+// Migrations returns embedded migrations of dialect ordered by version
+func Migrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := migrationFS.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect '%s'", dialect)
+	}
+
+	var migrations []Migration
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 || e.IsDir() {
+			return nil, fmt.Errorf("invalid migration file name '%s'", e.Name())
+		}
+		b, err := migrationFS.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: parts[1], SQL: string(b)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Statements returns statements of migration with table prefix filled in
+func (m Migration) Statements(prefix string) []string {
+	var statements []string
+	for _, s := range strings.Split(strings.ReplaceAll(m.SQL, "{prefix}", prefix), ";\n") {
+		if s = strings.TrimSpace(stripComments(s)); s != "" {
+			statements = append(statements, strings.TrimSuffix(s, ";"))
+		}
+	}
+	return statements
+}
+
+// stripComments removes lines with `--` comments
+func stripComments(s string) string {
+	lines := strings.Split(s, "\n")
+	kept := lines[:0]
+	for _, l := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(l), "--") {
+			kept = append(kept, l)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// MigrationsStatus returns all migrations of dialect with time they were applied
+func MigrationsStatus(db *sql.DB, dialect, prefix string) ([]MigrationStatus, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := createMigrationsTable(db, prefix); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db, prefix)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status = append(status, MigrationStatus{Migration: m, Applied: applied[m.Version]})
+	}
+	return status, nil
+}
+
+// Migrate applies pending migrations of dialect in order of their versions and returns applied migrations
+// applied versions are kept in `<prefix>schema_migrations` table
+func Migrate(db *sql.DB, dialect, prefix string) ([]Migration, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return migrate(db, dialect, prefix, migrations)
+}
+
+// migrate applies pending migrations, each migration is applied together with its record in single transaction
+// if DDL of dialect is transactional, so failed migration leaves no changes. MySQL commits DDL implicitly,
+// so statements that ran before the failed one stay applied there
+func migrate(db *sql.DB, dialect, prefix string, migrations []Migration) ([]Migration, error) {
+	if err := createMigrationsTable(db, prefix); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if applied[m.Version] != "" {
+			continue
+		}
+		if err := applyMigration(db, dialect, prefix, m); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// execer is DB or transaction statements are executed in
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// applyMigration executes statements of migration and records it as applied
+func applyMigration(db *sql.DB, dialect, prefix string, m Migration) error {
+	var ex execer = db
+	var tx *sql.Tx
+	if dialect != DialectMySQL {
+		var err error
+		if tx, err = db.Begin(); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		defer tx.Rollback()
+		ex = tx
+	}
+	for _, statement := range m.Statements(prefix) {
+		if _, err := ex.Exec(statement); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+	insert := rebind(dialect, "insert into "+prefix+"schema_migrations (version, name, applied_at) values (?, ?, ?)")
+	if _, err := ex.Exec(insert, m.Version, m.Name, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to record migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// createMigrationsTable creates table of applied migrations if it doesn't exist
+func createMigrationsTable(db *sql.DB, prefix string) error {
+	if !validPrefix.MatchString(prefix) {
+		return fmt.Errorf("invalid table prefix '%s', only letters, digits and underscore are allowed", prefix)
+	}
+	if _, err := db.Exec("create table if not exists " + prefix + "schema_migrations (version int primary key, name varchar(255) not null, applied_at varchar(32) not null)"); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns applied versions with time they were applied
+func appliedMigrations(db *sql.DB, prefix string) (map[int]string, error) {
+	applied := make(map[int]string)
+	rows, err := db.Query("select version, applied_at from " + prefix + "schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations(DialectMySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) < 2 {
+		t.Fatalf("Got %d migrations, want at least 2", len(migrations))
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Got version %d at position %d, want versions without gaps", m.Version, i)
+		}
+	}
+
+	statements := migrations[1].Statements("crawler_")
+	if len(statements) != 6 {
+		t.Errorf("Got %d statements, want 6", len(statements))
+	}
+	for _, s := range statements {
+		if strings.Contains(s, "{prefix}") || strings.HasPrefix(s, "--") || strings.HasSuffix(s, ";") {
+			t.Errorf("Got invalid statement %q", s)
+		}
+	}
+	if !strings.HasPrefix(statements[0], "create table crawler_videos") {
+		t.Errorf("Got %q, want prefixed videos table", statements[0])
+	}
+
+	if _, err := Migrations("nope"); err == nil {
+		t.Error("Got no error for unknown dialect")
+	}
+}
+
+func TestMigrateInvalidPrefix(t *testing.T) {
+	if _, err := Migrate(nil, DialectMySQL, "x; drop table links"); err == nil {
+		t.Error("Got no error for invalid prefix")
+	}
+}
+
+func TestMigrateRollsBackFailedMigration(t *testing.T) {
+	db, err := sql.Open("sqlite", SQLiteDSN(filepath.Join(t.TempDir(), "crawler.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrations := []Migration{
+		{Version: 1, Name: "first", SQL: "create table {prefix}a (id int);\n"},
+		{Version: 2, Name: "it's broken", SQL: "create table {prefix}b (id int);\ninsert into {prefix}missing values (1);\n"},
+	}
+	done, err := migrate(db, DialectSQLite, "x_", migrations)
+	if err == nil || len(done) != 1 {
+		t.Fatalf("Got %d applied migrations, err %v, want the second one to fail", len(done), err)
+	}
+	if _, err := db.Exec("select * from x_b"); err == nil {
+		t.Error("Got table of failed migration")
+	}
+
+	migrations[1].SQL = "create table {prefix}b (id int);\n"
+	if done, err := migrate(db, DialectSQLite, "x_", migrations); err != nil || len(done) != 1 || done[0].Version != 2 {
+		t.Fatalf("Got %+v, err %v, want fixed migration applied", done, err)
+	}
+	status, err := appliedMigrations(db, "x_")
+	if err != nil || len(status) != 2 {
+		t.Errorf("Got %v, err %v", status, err)
+	}
+
+	// failed read isn't taken as nothing applied
+	if _, err := appliedMigrations(db, "y_"); err == nil {
+		t.Error("Got no error reading applied migrations from missing table")
+	}
+}
+
+// baselineLinks is links table of versions before migrations existed, the table was created by hand
+var baselineLinks = map[string]string{
+	DialectMySQL:  "create table {prefix}links (id int auto_increment primary key, title varchar(255), link varchar(255), link_id varchar(32), number int)",
+	DialectSQLite: "create table {prefix}links (id integer primary key autoincrement, title text, link text, link_id text, number integer)",
+}
+
+func TestMigrateBaselineSchema(t *testing.T) {
+	db, err := sql.Open("sqlite", SQLiteDSN(filepath.Join(t.TempDir(), "crawler.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	testMigrateBaseline(t, db, DialectSQLite, "")
+}
+
+// TestMySQLMigrateBaselineSchema runs against MySQL at MYSQL_TEST_DSN, e.g. user:pwd@tcp(127.0.0.1:3306)/test
+func TestMySQLMigrateBaselineSchema(t *testing.T) {
+	dsn := os.Getenv("MYSQL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MYSQL_TEST_DSN isn't set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	prefix := fmt.Sprintf("baseline%d_", time.Now().UnixNano())
+	defer dropMigratedTables(db, prefix)
+	testMigrateBaseline(t, db, DialectMySQL, prefix)
+}
+
+// dropMigratedTables drops tables created by migrations in integration DB
+func dropMigratedTables(db *sql.DB, prefix string) {
+	for _, table := range []string{"links", "videos", "jobs", "edges", "fetch_attempts", "video_observations", "schema_migrations"} {
+		db.Exec("drop table if exists " + prefix + table)
+	}
+}
+
+// testMigrateBaseline migrates links stored in baseline table to normalized tables
+func testMigrateBaseline(t *testing.T, db *sql.DB, dialect, prefix string) {
+	t.Helper()
+	statements := []string{
+		strings.ReplaceAll(baselineLinks[dialect], "{prefix}", prefix),
+		"insert into " + prefix + "links (title, link, link_id, number) values ('Alpha', '/watch?v=aaa', 'aaa', 0), ('Beta', '/watch?v=bbb', 'bbb', 1), ('Alpha', '/watch?v=aaa', 'aaa', 2)",
+	}
+	for _, s := range statements {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Migrate(db, dialect, prefix); err != nil {
+		t.Fatalf("Failed to migrate baseline schema: %s", err)
+	}
+	var edges int
+	if err := db.QueryRow("select count(*) from " + prefix + "edges where job_id = ''").Scan(&edges); err != nil || edges != 3 {
+		t.Errorf("Got %d edges, err %v, want 3", edges, err)
+	}
+	var title string
+	var visits int
+	if err := db.QueryRow("select title, visits from "+prefix+"videos where id = 'aaa'").Scan(&title, &visits); err != nil || title != "Alpha" || visits != 2 {
+		t.Errorf("Got %q visited %d times, err %v, want Alpha visited twice", title, visits, err)
+	}
+}
@@ -0,0 +1,14 @@
+-- links table written before normalized schema, created so data of older versions can be migrated
+-- existing table has only the baseline columns, columns written by later versions are added to it
+create table if not exists {prefix}links (
+    id int auto_increment primary key,
+    title varchar(255),
+    link varchar(255),
+    link_id varchar(32),
+    number int
+);
+
+alter table {prefix}links
+    add column job_id varchar(32),
+    add column parent_id varchar(32),
+    add column channel varchar(255);
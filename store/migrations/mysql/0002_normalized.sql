@@ -0,0 +1,56 @@
+-- videos are crawled YouTube videos, title and channel are the latest seen
+create table {prefix}videos (
+    id varchar(32) primary key,
+    link varchar(255) not null default '',
+    title varchar(255) not null default '',
+    channel varchar(255) not null default ''
+);
+
+-- jobs are crawling chains started from single seed
+create table {prefix}jobs (
+    id varchar(32) primary key,
+    seed varchar(255) not null,
+    label varchar(255) not null default '',
+    n_of_iterations int not null,
+    status varchar(32) not null,
+    visited int not null default 0,
+    error text,
+    created datetime(3) not null,
+    started datetime(3) null,
+    ended datetime(3) null
+);
+
+-- edges are visits of videos, parent_id is video the visited one was recommended by
+create table {prefix}edges (
+    id bigint auto_increment primary key,
+    job_id varchar(32) not null default '',
+    number int not null,
+    parent_id varchar(32) null,
+    video_id varchar(32) not null,
+    visited_at datetime(3) null,
+    index edges_job (job_id, number),
+    index edges_video (video_id),
+    index edges_parent (parent_id)
+);
+
+-- fetch_attempts are requests for video pages including failed ones
+create table {prefix}fetch_attempts (
+    id bigint auto_increment primary key,
+    job_id varchar(32) not null default '',
+    video_id varchar(32) not null,
+    url varchar(1024) not null,
+    status_code int not null default 0,
+    error text,
+    duration_ms int not null,
+    attempted_at datetime(3) not null,
+    index fetch_attempts_job (job_id),
+    index fetch_attempts_video (video_id)
+);
+
+insert into {prefix}videos (id, link, title, channel)
+select link_id, max(coalesce(link, '')), max(coalesce(title, '')), max(coalesce(channel, ''))
+from {prefix}links where link_id <> '' group by link_id;
+
+insert into {prefix}edges (job_id, number, parent_id, video_id)
+select coalesce(job_id, ''), coalesce(number, 0), nullif(parent_id, ''), link_id
+from {prefix}links where link_id <> '' order by id;
@@ -0,0 +1,10 @@
+-- videos keep time they were first and last visited and number of visits, title and channel are the ones of the latest visit
+alter table {prefix}videos
+    add column first_seen datetime(3) null,
+    add column last_seen datetime(3) null,
+    add column visits int not null default 0;
+
+update {prefix}videos v
+join (select video_id, min(visited_at) as first_seen, max(visited_at) as last_seen, count(*) as visits from {prefix}edges group by video_id) a
+on a.video_id = v.id
+set v.first_seen = a.first_seen, v.last_seen = a.last_seen, v.visits = a.visits;
@@ -0,0 +1,14 @@
+-- video_observations are metadata of videos seen on their pages, one row per fetch,
+-- changed lists comma separated fields that differ from the previous observation of the video
+create table {prefix}video_observations (
+    id bigint auto_increment primary key,
+    video_id varchar(32) not null,
+    job_id varchar(32) not null default '',
+    observed_at datetime(3) not null,
+    title varchar(255) not null default '',
+    channel varchar(255) not null default '',
+    views bigint null,
+    likes bigint null,
+    changed varchar(64) not null default '',
+    index video_observations_video (video_id, observed_at)
+);
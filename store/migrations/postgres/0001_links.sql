@@ -0,0 +1,13 @@
+-- links table written before normalized schema, created so both dialects have the same history
+create table if not exists {prefix}links (
+    id serial primary key,
+    title varchar(255),
+    link varchar(255),
+    link_id varchar(32),
+    number int
+);
+
+alter table {prefix}links
+    add column if not exists job_id varchar(32),
+    add column if not exists parent_id varchar(32),
+    add column if not exists channel varchar(255);
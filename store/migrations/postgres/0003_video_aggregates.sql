@@ -0,0 +1,8 @@
+-- videos keep time they were first and last visited and number of visits, title and channel are the ones of the latest visit
+alter table {prefix}videos add column first_seen timestamptz null;
+alter table {prefix}videos add column last_seen timestamptz null;
+alter table {prefix}videos add column visits integer not null default 0;
+
+update {prefix}videos v set first_seen = a.first_seen, last_seen = a.last_seen, visits = a.visits
+from (select video_id, min(visited_at) as first_seen, max(visited_at) as last_seen, count(*) as visits from {prefix}edges group by video_id) a
+where a.video_id = v.id;
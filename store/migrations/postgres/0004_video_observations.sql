@@ -0,0 +1,15 @@
+-- video_observations are metadata of videos seen on their pages, one row per fetch,
+-- changed lists comma separated fields that differ from the previous observation of the video
+create table {prefix}video_observations (
+    id bigserial primary key,
+    video_id varchar(32) not null,
+    job_id varchar(32) not null default '',
+    observed_at timestamptz not null,
+    title varchar(255) not null default '',
+    channel varchar(255) not null default '',
+    views bigint null,
+    likes bigint null,
+    changed varchar(64) not null default ''
+);
+
+create index {prefix}video_observations_video on {prefix}video_observations (video_id, observed_at);
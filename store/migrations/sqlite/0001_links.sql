@@ -0,0 +1,12 @@
+-- links table written before normalized schema, created so all dialects have the same history
+create table if not exists {prefix}links (
+    id integer primary key autoincrement,
+    title text,
+    link text,
+    link_id text,
+    number integer
+);
+
+alter table {prefix}links add column job_id text;
+alter table {prefix}links add column parent_id text;
+alter table {prefix}links add column channel text;
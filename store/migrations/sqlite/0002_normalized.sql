@@ -0,0 +1,58 @@
+-- videos are crawled YouTube videos, title and channel are the latest seen
+create table {prefix}videos (
+    id text primary key,
+    link text not null default '',
+    title text not null default '',
+    channel text not null default ''
+);
+
+-- jobs are crawling chains started from single seed
+create table {prefix}jobs (
+    id text primary key,
+    seed text not null,
+    label text not null default '',
+    n_of_iterations integer not null,
+    status text not null,
+    visited integer not null default 0,
+    error text,
+    created datetime not null,
+    started datetime null,
+    ended datetime null
+);
+
+-- edges are visits of videos, parent_id is video the visited one was recommended by
+create table {prefix}edges (
+    id integer primary key autoincrement,
+    job_id text not null default '',
+    number integer not null,
+    parent_id text null,
+    video_id text not null,
+    visited_at datetime null
+);
+
+create index {prefix}edges_job on {prefix}edges (job_id, number);
+create index {prefix}edges_video on {prefix}edges (video_id);
+create index {prefix}edges_parent on {prefix}edges (parent_id);
+
+-- fetch_attempts are requests for video pages including failed ones
+create table {prefix}fetch_attempts (
+    id integer primary key autoincrement,
+    job_id text not null default '',
+    video_id text not null,
+    url text not null,
+    status_code integer not null default 0,
+    error text,
+    duration_ms integer not null,
+    attempted_at datetime not null
+);
+
+create index {prefix}fetch_attempts_job on {prefix}fetch_attempts (job_id);
+create index {prefix}fetch_attempts_video on {prefix}fetch_attempts (video_id);
+
+insert into {prefix}videos (id, link, title, channel)
+select link_id, max(coalesce(link, '')), max(coalesce(title, '')), max(coalesce(channel, ''))
+from {prefix}links where link_id <> '' group by link_id;
+
+insert into {prefix}edges (job_id, number, parent_id, video_id)
+select coalesce(job_id, ''), coalesce(number, 0), nullif(parent_id, ''), link_id
+from {prefix}links where link_id <> '' order by id;
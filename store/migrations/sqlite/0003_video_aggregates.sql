@@ -0,0 +1,9 @@
+-- videos keep time they were first and last visited and number of visits, title and channel are the ones of the latest visit
+alter table {prefix}videos add column first_seen datetime null;
+alter table {prefix}videos add column last_seen datetime null;
+alter table {prefix}videos add column visits integer not null default 0;
+
+update {prefix}videos set
+    first_seen = (select min(e.visited_at) from {prefix}edges e where e.video_id = {prefix}videos.id),
+    last_seen = (select max(e.visited_at) from {prefix}edges e where e.video_id = {prefix}videos.id),
+    visits = (select count(*) from {prefix}edges e where e.video_id = {prefix}videos.id);
@@ -0,0 +1,15 @@
+-- video_observations are metadata of videos seen on their pages, one row per fetch,
+-- changed lists comma separated fields that differ from the previous observation of the video
+create table {prefix}video_observations (
+    id integer primary key autoincrement,
+    video_id text not null,
+    job_id text not null default '',
+    observed_at datetime not null,
+    title text not null default '',
+    channel text not null default '',
+    views integer null,
+    likes integer null,
+    changed text not null default ''
+);
+
+create index {prefix}video_observations_video on {prefix}video_observations (video_id, observed_at);
@@ -0,0 +1,340 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// BackendNATS publishes stored links to NATS JetStream
+const BackendNATS = "nats"
+
+// VideoIDHeader is header of published message with ID of the video, the same ID is the last token of the subject
+const VideoIDHeader = "Video-Id"
+
+// errNotConnected is returned while client isn't connected to NATS
+var errNotConnected = errors.New("not connected to NATS")
+
+// MQOptions configures MQStore
+type MQOptions struct {
+	URL        string        // NATS server URL, e.g. nats://127.0.0.1:4222
+	Subject    string        // link of video is published to subject `Subject.<video ID>`
+	Stream     string        // JetStream stream capturing `Subject.>`, created if it doesn't exist
+	BufferPath string        // JSON Lines file links are kept in while broker is down, links fail to store if empty
+	RetryEvery time.Duration // how often buffered links are published again
+	AckTimeout time.Duration // max time to wait for broker to acknowledge published link
+	Out        io.Writer     // server and subject links are published to are printed here, os.Stdout if nil
+}
+
+// MQStore publishes every link as JSON object to JetStream and waits until the broker acknowledges it,
+// so every link is delivered at least once. Links that aren't acknowledged are appended to buffer file
+// and published again once the broker is back, order of buffered links isn't kept.
+// Messages carry ID made of job, iteration and video, so the stream drops duplicates of republished links
+type MQStore struct {
+	opts   MQOptions
+	conn   *nats.Conn
+	js     nats.JetStreamContext
+	buffer *DeadLetters // nil if buffering is disabled
+
+	mu          sync.Mutex
+	streamReady bool // stream was checked to exist
+
+	buffered int64 // number of links waiting in buffer file, updated atomically
+	stop     chan struct{}
+	done     chan struct{}
+	log      *logrus.Logger
+}
+
+// NewMQStore connects to NATS server and returns MQStore publishing to it
+// server that is down isn't error, links are buffered until it's reachable
+func NewMQStore(opts MQOptions, log *logrus.Logger) (*MQStore, error) {
+	if opts.URL == "" || opts.Subject == "" || opts.Stream == "" {
+		return nil, fmt.Errorf("missing NATS URL, subject or stream")
+	}
+	if opts.RetryEvery <= 0 {
+		opts.RetryEvery = 5 * time.Second
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = 5 * time.Second
+	}
+	s := &MQStore{opts: opts, log: log, stop: make(chan struct{}), done: make(chan struct{})}
+	if opts.BufferPath != "" {
+		s.buffer = NewDeadLetters(opts.BufferPath)
+		letters, err := s.buffer.List()
+		if err != nil {
+			return nil, err
+		}
+		s.buffered = int64(len(letters))
+	}
+
+	// messages aren't kept by client while disconnected, they go to buffer file instead
+	conn, err := nats.Connect(opts.URL,
+		nats.Name("youtubeCrawler"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectBufSize(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.WithField("err", fmt.Sprint(err)).Warn("Disconnected from NATS")
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			log.WithField("url", c.ConnectedUrl()).Info("Reconnected to NATS")
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	if s.js, err = conn.JetStream(nats.MaxWait(opts.AckTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	fmt.Fprintf(output(opts.Out), "Publishing data to NATS '%s' subject '%s.>'\n", opts.URL, opts.Subject)
+	log.WithFields(logrus.Fields{
+		"url":      opts.URL,
+		"subject":  opts.Subject,
+		"stream":   opts.Stream,
+		"buffered": s.buffered,
+	}).Debug("Opened NATS publisher")
+	go s.retryLoop()
+	return s, nil
+}
+
+// NewMQStoreFromConfig returns MQStore configured by MQ settings of store config
+func NewMQStoreFromConfig(c config.StoreConfig, log *logrus.Logger) (*MQStore, error) {
+	return NewMQStore(MQOptions{
+		URL:        c.MQURL,
+		Subject:    c.MQSubject,
+		Stream:     c.MQStream,
+		BufferPath: c.MQBufferPath,
+		RetryEvery: c.MQRetryEvery,
+		Out:        c.Out,
+	}, log)
+}
+
+// Store publishes link, link is buffered if broker doesn't acknowledge it
+func (s *MQStore) Store(link models.NextLink) error {
+	if err := s.publish(link); err != nil {
+		return s.keep(link, err)
+	}
+	return nil
+}
+
+// StoreBatch publishes all links without waiting for each acknowledgement, links that aren't acknowledged are buffered
+func (s *MQStore) StoreBatch(links []models.NextLink) error {
+	if err := s.ensureStream(); err != nil {
+		for _, l := range links {
+			if err := s.keep(l, err); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	futures := make([]nats.PubAckFuture, len(links))
+	for i, l := range links {
+		msg, err := s.message(l)
+		if err != nil {
+			return err
+		}
+		if futures[i], err = s.js.PublishMsgAsync(msg); err != nil {
+			if err := s.keep(l, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	// all links share single deadline, links not acknowledged once it passes aren't waited for
+	timer := time.NewTimer(s.opts.AckTimeout)
+	defer timer.Stop()
+	expired := false
+	for i, f := range futures {
+		if f == nil {
+			continue
+		}
+		var err error
+		if expired {
+			select {
+			case <-f.Ok():
+				continue
+			case err = <-f.Err():
+			default:
+				err = nats.ErrTimeout
+			}
+		} else {
+			select {
+			case <-f.Ok():
+				continue
+			case err = <-f.Err():
+			case <-timer.C:
+				expired = true
+				err = nats.ErrTimeout
+			}
+		}
+		if err := s.keep(links[i], err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keep appends link that failed to publish with err to buffer file, err is returned if buffering is disabled
+func (s *MQStore) keep(link models.NextLink, err error) error {
+	if s.buffer == nil {
+		return err
+	}
+	if bufErr := s.buffer.Add(link, err); bufErr != nil {
+		return fmt.Errorf("failed to publish link: %s, failed to buffer it: %w", err, bufErr)
+	}
+	if atomic.AddInt64(&s.buffered, 1) == 1 {
+		s.log.WithFields(logrus.Fields{
+			"err":    err.Error(),
+			"buffer": s.buffer.Path(),
+		}).Warn("NATS isn't available, buffering links")
+	}
+	return nil
+}
+
+// publish publishes link and waits for acknowledgement
+func (s *MQStore) publish(link models.NextLink) error {
+	if err := s.ensureStream(); err != nil {
+		return err
+	}
+	msg, err := s.message(link)
+	if err != nil {
+		return err
+	}
+	_, err = s.js.PublishMsg(msg)
+	return err
+}
+
+// message returns message of link keyed by video ID, message ID lets stream drop republished duplicates
+func (s *MQStore) message(link models.NextLink) (*nats.Msg, error) {
+	body, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+	key := link.ID
+	if key == "" {
+		key = "unknown"
+	}
+	msg := nats.NewMsg(s.opts.Subject + "." + key)
+	msg.Data = body
+	msg.Header.Set("Content-Type", "application/json")
+	msg.Header.Set(VideoIDHeader, link.ID)
+	msg.Header.Set(nats.MsgIdHdr, fmt.Sprintf("%s-%d-%s", link.JobID, link.Number, link.ID))
+	return msg, nil
+}
+
+// ensureStream creates stream for the subject once broker is reachable
+func (s *MQStore) ensureStream() error {
+	if s.conn.Status() != nats.CONNECTED {
+		return errNotConnected
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streamReady {
+		return nil
+	}
+	_, err := s.js.StreamInfo(s.opts.Stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = s.js.AddStream(&nats.StreamConfig{
+			Name:     s.opts.Stream,
+			Subjects: []string{s.opts.Subject + ".>"},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set up stream '%s': %w", s.opts.Stream, err)
+	}
+	s.streamReady = true
+	return nil
+}
+
+// Ping returns error if broker isn't reachable
+func (s *MQStore) Ping() error {
+	return s.ensureStream()
+}
+
+// Buffered returns number of links waiting in buffer file
+func (s *MQStore) Buffered() int {
+	return int(atomic.LoadInt64(&s.buffered))
+}
+
+// Flush publishes buffered links, links that fail again are kept in buffer file
+func (s *MQStore) Flush() (ReplayResult, error) {
+	if s.buffer == nil {
+		return ReplayResult{}, nil
+	}
+	result, err := s.buffer.Replay(mqPublisher{s})
+	atomic.AddInt64(&s.buffered, -int64(result.Replayed))
+	return result, err
+}
+
+// retryLoop publishes buffered links every RetryEvery
+func (s *MQStore) retryLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.RetryEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if s.Buffered() == 0 {
+				continue
+			}
+			result, err := s.Flush()
+			if errors.Is(err, ErrUnhealthy) || errors.Is(err, ErrReplaying) {
+				continue
+			}
+			entry := s.log.WithFields(logrus.Fields{
+				"published": result.Replayed,
+				"failed":    result.Failed,
+			})
+			if err != nil {
+				entry.WithField("err", err.Error()).Warn("Failed to publish buffered links")
+				continue
+			}
+			entry.Info("Published buffered links")
+		}
+	}
+}
+
+// Close stops publishing buffered links and drains the connection
+func (s *MQStore) Close() {
+	close(s.stop)
+	<-s.done
+	if err := s.conn.Drain(); err != nil {
+		s.conn.Close()
+	}
+}
+
+// mqPublisher publishes links of buffer without buffering them again
+type mqPublisher struct {
+	s *MQStore
+}
+
+func (p mqPublisher) Store(link models.NextLink) error {
+	return p.s.publish(link)
+}
+
+func (p mqPublisher) Ping() error {
+	return p.s.Ping()
+}
+
+func (p mqPublisher) Close() {}
+
+func init() {
+	Register(BackendNATS, func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return NewMQStoreFromConfig(c, log)
+	})
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/internal/testutil"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// runNATSServer starts embedded NATS server with JetStream stored to dir
+func runNATSServer(t *testing.T, dir string, port int) *server.Server {
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: port, JetStream: true, StoreDir: dir, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server didn't start")
+	}
+	return ns
+}
+
+func TestMQStore(t *testing.T) {
+	dir := t.TempDir()
+	ns := runNATSServer(t, filepath.Join(dir, "jetstream"), server.RANDOM_PORT)
+	port := ns.Addr().(*net.TCPAddr).Port
+	url := ns.ClientURL()
+	defer func() { ns.Shutdown() }()
+
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	s, err := NewMQStore(MQOptions{URL: url, Subject: "test.videos", Stream: "TEST", BufferPath: filepath.Join(dir, "buffer.jsonl"),
+		RetryEvery: 50 * time.Millisecond, AckTimeout: time.Second}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := nats.Connect(url, nats.MaxReconnects(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	js, _ := conn.JetStream()
+	messages := func() uint64 {
+		info, err := js.StreamInfo("TEST")
+		if err != nil {
+			return 0
+		}
+		return info.State.Msgs
+	}
+
+	if err := s.Store(models.NextLink{ID: "aaa", JobID: "j1", Number: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreBatch([]models.NextLink{{ID: "bbb", JobID: "j1", Number: 2}, {ID: "ccc", JobID: "j1", Number: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := js.GetLastMsg("TEST", "test.videos.bbb")
+	var link models.NextLink
+	if err != nil || msg.Header.Get(VideoIDHeader) != "bbb" || json.Unmarshal(msg.Data, &link) != nil || link.Number != 2 {
+		t.Fatalf("Got %+v, err %v", msg, err)
+	}
+	// republished link is dropped by the stream
+	s.Store(models.NextLink{ID: "aaa", JobID: "j1", Number: 1})
+	if n := messages(); n != 3 {
+		t.Errorf("Got %d messages, want 3", n)
+	}
+
+	t.Run("links are buffered while broker is down", func(t *testing.T) {
+		ns.Shutdown()
+		testutil.WaitFor(t, "disconnect", func() bool { return s.conn.Status() != nats.CONNECTED })
+		if err := s.Store(models.NextLink{ID: "ddd", JobID: "j1", Number: 4}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.StoreBatch([]models.NextLink{{ID: "eee", JobID: "j1", Number: 5}}); err != nil {
+			t.Fatal(err)
+		}
+		if s.Buffered() != 2 {
+			t.Fatalf("Got %d buffered links, want 2", s.Buffered())
+		}
+
+		ns = runNATSServer(t, filepath.Join(dir, "jetstream"), port)
+		testutil.WaitFor(t, "buffered links to be published", func() bool { return s.Buffered() == 0 })
+		testutil.WaitFor(t, "client to reconnect", func() bool { return conn.Status() == nats.CONNECTED })
+		if n := messages(); n != 5 {
+			t.Errorf("Got %d messages, want 5", n)
+		}
+	})
+
+	t.Run("all unacknowledged links of batch are buffered", func(t *testing.T) {
+		s, err := NewMQStore(MQOptions{URL: ns.ClientURL(), Subject: "test.hang", Stream: "HANG", BufferPath: filepath.Join(dir, "hang.jsonl"),
+			RetryEvery: time.Hour, AckTimeout: 100 * time.Millisecond, Out: ioutil.Discard}, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		// subscriber without stream takes messages and never acknowledges them
+		sub, err := conn.SubscribeSync("test.hang.>")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Unsubscribe()
+		testutil.WaitFor(t, "store to connect", func() bool { return s.conn.Status() == nats.CONNECTED })
+		s.streamReady = true
+
+		stored := make(chan error, 1)
+		go func() {
+			stored <- s.StoreBatch([]models.NextLink{{ID: "ggg", Number: 1}, {ID: "hhh", Number: 2}, {ID: "iii", Number: 3}})
+		}()
+		select {
+		case err := <-stored:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("StoreBatch waits for acknowledgements after deadline")
+		}
+		if s.Buffered() != 3 {
+			t.Errorf("Got %d buffered links, want 3", s.Buffered())
+		}
+	})
+
+	t.Run("links fail without buffer", func(t *testing.T) {
+		s, err := NewMQStore(MQOptions{URL: "nats://127.0.0.1:1", Subject: "test.videos", Stream: "TEST"}, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		if err := s.Store(models.NextLink{ID: "fff"}); err == nil {
+			t.Error("Got no error without broker and buffer")
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// PostgresStore stores data to PostgreSQL DB with the same schema as DbStore
+type PostgresStore struct {
+	*sqlStore
+}
+
+// PostgresDSN returns connection URL of PostgreSQL DB from store config
+func PostgresDSN(c config.StoreConfig) string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.DbUser, c.DbPwd),
+		Host:     c.DbURL,
+		Path:     "/" + c.DbName,
+		RawQuery: url.Values{"sslmode": {c.DbSSLMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// NewPostgresStore connects to PostgreSQL DB, applies migrations if configured to and returns PostgresStore storing data to it
+func NewPostgresStore(c config.StoreConfig, log *logrus.Logger) (*PostgresStore, error) {
+	pool, err := sql.Open("postgres", PostgresDSN(c))
+	if err != nil {
+		return nil, err
+	}
+	if err = pool.Ping(); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	fmt.Fprintln(output(c.Out), "Connected to DB")
+	log.WithFields(logrus.Fields{
+		"method": "NewPostgresStore",
+		"user":   c.DbUser,
+		"DBURL":  c.DbURL,
+		"DBName": c.DbName,
+	}).Debug("Connected to DB!")
+
+	s, err := newSQLStore(pool, DialectPostgres, c.TablePrefix, c.AutoMigrate, c.Out, log)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &PostgresStore{s}, nil
+}
+
+// StoreBatch stores links in single transaction, visits are loaded by COPY and videos are upserted from COPY loaded temporary table
+func (pg *PostgresStore) StoreBatch(links []models.NextLink) error {
+	if len(links) == 0 {
+		return nil
+	}
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("create temporary table batch_videos (id varchar(32), link varchar(255), title varchar(255), channel varchar(255), visited_at timestamptz) on commit drop"); err != nil {
+		return err
+	}
+	err = copyRows(tx, pq.CopyIn("batch_videos", "id", "link", "title", "channel", "visited_at"), len(links), func(i int) []interface{} {
+		l := links[i]
+		return []interface{}{l.ID, l.Link, l.Title, l.Channel, nullTime(l.VisitedAt)}
+	})
+	if err != nil {
+		return err
+	}
+	// visits of one video in batch are upserted as one row with title and channel of the latest visit having them
+	_, err = tx.Exec("insert into " + pg.prefix + "videos as v (id, link, title, channel, first_seen, last_seen, visits) " +
+		"select id, max(link), " +
+		"coalesce((array_agg(title order by visited_at desc nulls first) filter (where title <> ''))[1], ''), " +
+		"coalesce((array_agg(channel order by visited_at desc nulls first) filter (where channel <> ''))[1], ''), " +
+		"min(visited_at), max(visited_at), count(*) from batch_videos group by id " + videoConflict)
+	if err != nil {
+		return err
+	}
+
+	err = copyRows(tx, pq.CopyIn(pg.prefix+"edges", "job_id", "number", "parent_id", "video_id", "visited_at"), len(links), func(i int) []interface{} {
+		l := links[i]
+		return []interface{}{l.JobID, l.Number, nullString(l.ParentID), l.ID, nullTime(l.VisitedAt)}
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// copyRows loads n rows returned by row using COPY statement
+func copyRows(tx *sql.Tx, copyStatement string, n int, row func(i int) []interface{}) error {
+	stmt, err := tx.Prepare(copyStatement)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if _, err := stmt.Exec(row(i)...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
@@ -0,0 +1,408 @@
+package store
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// Errors returned by Reader
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrJobRequired   = errors.New("store can be read only by job")
+)
+
+// Sort keys of VideoQuery
+const (
+	SortID      = "id"
+	SortTitle   = "title"
+	SortChannel = "channel"
+	SortVisits  = "visits"
+)
+
+// DefaultLimit and MaxLimit limit number of videos in single VideoPage
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// Reader reads stored data back, Storer implements it if its destination can be read
+type Reader interface {
+	// Videos returns page of videos matching query
+	Videos(q VideoQuery) (VideoPage, error)
+	// Video returns video with all its stored visits or ErrNotFound
+	Video(id string) (models.Video, []models.NextLink, error)
+	// Path returns links stored by job ordered by number of iteration
+	Path(jobID string) ([]models.NextLink, error)
+}
+
+// Scanner is optional interface of Reader for destinations that can stream stored links without loading them to memory
+type Scanner interface {
+	// ScanLinks calls fn for every stored link matching query, it stops on first error returned by fn
+	ScanLinks(q LinkQuery, fn func(link models.NextLink) error) error
+}
+
+// LinkQuery selects stored links by job and time they were visited
+// links of single job are ordered by number of iteration, otherwise by time they were visited
+type LinkQuery struct {
+	JobID string    // only links of this job
+	From  time.Time // only links visited at or after this time, zero for no limit
+	To    time.Time // only links visited before this time, zero for no limit
+}
+
+// matches reports whether link visited at given time is in time range of query
+func (q LinkQuery) matches(visitedAt time.Time) bool {
+	return (q.From.IsZero() || !visitedAt.Before(q.From)) && (q.To.IsZero() || visitedAt.Before(q.To))
+}
+
+// ReadCloser is Reader that has to be closed once it isn't needed
+type ReadCloser interface {
+	Reader
+	Close()
+}
+
+// VideoQuery filters, sorts and paginates videos
+type VideoQuery struct {
+	JobID     string // only visits of this job
+	Channel   string // only videos of this channel
+	Title     string // only videos with title containing this text, case insensitive
+	MinVisits int    // only videos visited at least this many times
+	Sort      string // one of Sort keys, defaults to SortID
+	Desc      bool   // sort in descending order
+	Cursor    string // VideoPage.NextCursor of previous page
+	Limit     int    // defaults to DefaultLimit, at most MaxLimit
+}
+
+// VideoPage is single page of videos, NextCursor is empty on the last page
+type VideoPage struct {
+	Videos     []models.Video `json:"videos"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// Reader returns destination of the manager as Reader if it can be read, FanOut is read from its first readable destination
+func (m *Manager) Reader() (Reader, bool) {
+	if f, ok := m.StoreDestination.(*FanOut); ok {
+		return f.Reader()
+	}
+	r, ok := m.StoreDestination.(Reader)
+	return r, ok
+}
+
+// ScanLinks streams links matching query from reader
+// readers that aren't Scanner are read by Path at once so they return ErrJobRequired for query without job
+func ScanLinks(r Reader, q LinkQuery, fn func(link models.NextLink) error) error {
+	if s, ok := r.(Scanner); ok {
+		return s.ScanLinks(q, fn)
+	}
+	if q.JobID == "" {
+		return ErrJobRequired
+	}
+	path, err := r.Path(q.JobID)
+	if err != nil {
+		return err
+	}
+	for _, link := range path {
+		if !q.matches(link.VisitedAt) {
+			continue
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalize sets defaults of query and checks sort key
+func (q *VideoQuery) normalize() error {
+	switch q.Sort {
+	case "":
+		q.Sort = SortID
+	case SortID, SortTitle, SortChannel, SortVisits:
+	default:
+		return fmt.Errorf("%w '%s'", ErrInvalidSort, q.Sort)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+	return nil
+}
+
+// cursor points behind the last video of page, it holds sort value and ID of that video
+type cursor struct {
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(sortKey string, v models.Video) string {
+	b, _ := json.Marshal(cursor{Value: sortValue(sortKey, v), ID: v.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func sortValue(sortKey string, v models.Video) string {
+	switch sortKey {
+	case SortTitle:
+		return v.Title
+	case SortChannel:
+		return v.Channel
+	case SortVisits:
+		return strconv.Itoa(v.Visits)
+	default:
+		return v.ID
+	}
+}
+
+// compareVideos compares videos by sort key, ties are broken by ID
+func compareVideos(sortKey string, a, b models.Video) int {
+	if sortKey == SortVisits && a.Visits != b.Visits {
+		if a.Visits < b.Visits {
+			return -1
+		}
+		return 1
+	}
+	if sortKey != SortVisits {
+		if c := strings.Compare(sortValue(sortKey, a), sortValue(sortKey, b)); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// queryVideos aggregates records to videos and returns page matching query, it's used by readers without query language
+func queryVideos(records []models.NextLink, q VideoQuery) (VideoPage, error) {
+	if err := q.normalize(); err != nil {
+		return VideoPage{}, err
+	}
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	var last *models.Video
+	if after != nil {
+		last = &models.Video{ID: after.ID, Title: after.Value, Channel: after.Value}
+		if q.Sort == SortVisits {
+			if last.Visits, err = strconv.Atoi(after.Value); err != nil {
+				return VideoPage{}, ErrInvalidCursor
+			}
+		}
+	}
+
+	title := strings.ToLower(q.Title)
+	index := make(map[string]int)
+	jobs := make(map[string]map[string]bool)
+	var videos []models.Video
+	for _, r := range records {
+		if r.ID == "" ||
+			(q.JobID != "" && r.JobID != q.JobID) ||
+			(q.Channel != "" && r.Channel != q.Channel) ||
+			(title != "" && !strings.Contains(strings.ToLower(r.Title), title)) {
+			continue
+		}
+		i, ok := index[r.ID]
+		if !ok {
+			i = len(videos)
+			index[r.ID] = i
+			videos = append(videos, models.Video{ID: r.ID})
+			jobs[r.ID] = make(map[string]bool)
+		}
+		v := &videos[i]
+		v.Visits++
+		// title and channel of visit older than the last one only fill missing ones, visit without time counts as the latest one
+		seen := r.VisitedAt
+		latest := seen.IsZero() || v.LastSeen == nil || !seen.Before(*v.LastSeen)
+		if r.Title != "" && (v.Title == "" || latest) {
+			v.Title = r.Title
+		}
+		if r.Channel != "" && (v.Channel == "" || latest) {
+			v.Channel = r.Channel
+		}
+		if !seen.IsZero() {
+			if v.FirstSeen == nil || seen.Before(*v.FirstSeen) {
+				v.FirstSeen = &seen
+			}
+			if latest {
+				v.LastSeen = &seen
+			}
+		}
+		if r.JobID != "" && !jobs[r.ID][r.JobID] {
+			jobs[r.ID][r.JobID] = true
+			v.Jobs++
+		}
+	}
+
+	page := VideoPage{Videos: []models.Video{}}
+	matching := videos[:0]
+	for _, v := range videos {
+		if v.Visits < q.MinVisits {
+			continue
+		}
+		if last != nil {
+			c := compareVideos(q.Sort, v, *last)
+			if (!q.Desc && c <= 0) || (q.Desc && c >= 0) {
+				continue
+			}
+		}
+		matching = append(matching, v)
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		c := compareVideos(q.Sort, matching[i], matching[j])
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	if len(matching) > q.Limit {
+		matching = matching[:q.Limit]
+		page.NextCursor = encodeCursor(q.Sort, matching[len(matching)-1])
+	}
+	page.Videos = append(page.Videos, matching...)
+	return page, nil
+}
+
+// findVideo returns video aggregated from records with all its visits
+func findVideo(records []models.NextLink, id string) (models.Video, []models.NextLink, error) {
+	visits := []models.NextLink{}
+	for _, r := range records {
+		if r.ID == id {
+			visits = append(visits, r)
+		}
+	}
+	if len(visits) == 0 {
+		return models.Video{}, nil, ErrNotFound
+	}
+	page, err := queryVideos(visits, VideoQuery{})
+	if err != nil {
+		return models.Video{}, nil, err
+	}
+	return page.Videos[0], visits, nil
+}
+
+// jobPath returns records of job ordered by number of iteration
+func jobPath(records []models.NextLink, jobID string) []models.NextLink {
+	path := []models.NextLink{}
+	for _, r := range records {
+		if r.JobID == jobID {
+			path = append(path, r)
+		}
+	}
+	sort.SliceStable(path, func(i, j int) bool {
+		return path[i].Number < path[j].Number
+	})
+	return path
+}
+
+// records reads all links back from the file
+func (f FileStore) records() ([]models.NextLink, error) {
+	file, err := os.Open(f.destFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []models.NextLink
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if link, ok := parseTextLine(scanner.Text()); ok {
+			records = append(records, link)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Videos returns page of videos stored in file
+func (f FileStore) Videos(q VideoQuery) (VideoPage, error) {
+	records, err := f.records()
+	if err != nil {
+		return VideoPage{}, err
+	}
+	return queryVideos(records, q)
+}
+
+// Video returns video stored in file with all its visits
+func (f FileStore) Video(id string) (models.Video, []models.NextLink, error) {
+	records, err := f.records()
+	if err != nil {
+		return models.Video{}, nil, err
+	}
+	return findVideo(records, id)
+}
+
+// Path returns links of job stored in file
+func (f FileStore) Path(jobID string) ([]models.NextLink, error) {
+	records, err := f.records()
+	if err != nil {
+		return nil, err
+	}
+	return jobPath(records, jobID), nil
+}
+
+// textFields are keys of values in line written by textLine in order they are written
+var textFields = []string{"ID", "Job", "Parent", "Link", "Title", "Channel", "no."}
+
+// parseTextLine parses line written by textLine, lines written before some key was added are parsed too
+func parseTextLine(line string) (models.NextLink, bool) {
+	if !strings.HasPrefix(line, "[ID: '") || !strings.HasSuffix(line, "']") {
+		return models.NextLink{}, false
+	}
+	rest := strings.TrimSuffix(strings.TrimPrefix(line, "["), "']")
+	values := make(map[string]string)
+	for i, key := range textFields {
+		if !strings.HasPrefix(rest, key+": '") {
+			continue
+		}
+		rest = strings.TrimPrefix(rest, key+": '")
+		end := len(rest)
+		// value ends where the next present key starts, values are not escaped so title may contain quotes
+		for _, next := range textFields[i+1:] {
+			if j := strings.Index(rest, "', "+next+": '"); j >= 0 {
+				end = j
+				break
+			}
+		}
+		values[key] = rest[:end]
+		rest = strings.TrimPrefix(rest[end:], "', ")
+	}
+
+	number, err := strconv.Atoi(values["no."])
+	if err != nil {
+		return models.NextLink{}, false
+	}
+	return models.NextLink{
+		ID:       values["ID"],
+		JobID:    values["Job"],
+		ParentID: values["Parent"],
+		Link:     values["Link"],
+		Title:    values["Title"],
+		Channel:  values["Channel"],
+		Number:   number,
+	}, true
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+var testRecords = []models.NextLink{
+	{ID: "aaa", JobID: "j1", Title: "Alpha", Channel: "ch1", Link: "/watch?v=aaa", Number: 0},
+	{ID: "bbb", JobID: "j1", ParentID: "aaa", Title: "Beta 'quoted', Title: x", Channel: "ch2", Link: "/watch?v=bbb", Number: 1},
+	{ID: "ccc", JobID: "j1", ParentID: "bbb", Title: "Gamma", Channel: "ch1", Link: "/watch?v=ccc", Number: 2},
+	{ID: "aaa", JobID: "j2", Title: "Alpha", Channel: "ch1", Link: "/watch?v=aaa", Number: 0},
+	{ID: "ccc", JobID: "j2", ParentID: "aaa", Title: "Gamma", Channel: "ch1", Link: "/watch?v=ccc", Number: 1},
+	{ID: "aaa", JobID: "j2", ParentID: "ccc", Title: "Alpha", Channel: "ch1", Link: "/watch?v=aaa", Number: 2},
+}
+
+func newTestFileStore(t *testing.T) FileStore {
+	t.Helper()
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "links.dat"), ioutil.Discard, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range testRecords {
+		if err := s.Store(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(s.Close)
+	return s.(FileStore)
+}
+
+func videoIDs(videos []models.Video) []string {
+	ids := []string{}
+	for _, v := range videos {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
+
+func assertIDs(t *testing.T, want []string, got []models.Video) {
+	t.Helper()
+	ids := videoIDs(got)
+	if len(ids) != len(want) {
+		t.Fatalf("Got %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("Got %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestParseTextLine(t *testing.T) {
+	for _, want := range testRecords {
+		got, ok := parseTextLine(textLine(want)[:len(textLine(want))-1])
+		if !ok || got.ID != want.ID || got.JobID != want.JobID || got.ParentID != want.ParentID ||
+			got.Title != want.Title || got.Channel != want.Channel || got.Link != want.Link || got.Number != want.Number {
+			t.Errorf("Got %+v, want %+v", got, want)
+		}
+	}
+
+	t.Run("line without job", func(t *testing.T) {
+		got, ok := parseTextLine("[ID: 'aaa', Link: '/watch?v=aaa', Title: 'Alpha', no.: '3']")
+		if !ok || got.ID != "aaa" || got.Title != "Alpha" || got.Number != 3 {
+			t.Errorf("Got %+v", got)
+		}
+	})
+}
+
+func TestFileStoreReader(t *testing.T) {
+	s := newTestFileStore(t)
+
+	t.Run("videos", func(t *testing.T) {
+		page, err := s.Videos(VideoQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIDs(t, []string{"aaa", "bbb", "ccc"}, page.Videos)
+		if a := page.Videos[0]; a.Visits != 3 || a.Jobs != 2 || a.Title != "Alpha" || a.Channel != "ch1" {
+			t.Errorf("Got %+v", a)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		page, _ := s.Videos(VideoQuery{JobID: "j2"})
+		assertIDs(t, []string{"aaa", "ccc"}, page.Videos)
+		page, _ = s.Videos(VideoQuery{Channel: "ch2"})
+		assertIDs(t, []string{"bbb"}, page.Videos)
+		page, _ = s.Videos(VideoQuery{Title: "gam"})
+		assertIDs(t, []string{"ccc"}, page.Videos)
+		page, _ = s.Videos(VideoQuery{MinVisits: 2})
+		assertIDs(t, []string{"aaa", "ccc"}, page.Videos)
+	})
+
+	t.Run("sort and pagination", func(t *testing.T) {
+		page, err := s.Videos(VideoQuery{Sort: SortVisits, Desc: true, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIDs(t, []string{"aaa", "ccc"}, page.Videos)
+		if page.NextCursor == "" {
+			t.Fatal("Got empty cursor for first page")
+		}
+		page, err = s.Videos(VideoQuery{Sort: SortVisits, Desc: true, Limit: 2, Cursor: page.NextCursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIDs(t, []string{"bbb"}, page.Videos)
+		if page.NextCursor != "" {
+			t.Errorf("Got cursor %s for last page", page.NextCursor)
+		}
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		if _, err := s.Videos(VideoQuery{Sort: "nope"}); err == nil {
+			t.Error("Got no error for invalid sort")
+		}
+		if _, err := s.Videos(VideoQuery{Cursor: "!!"}); err != ErrInvalidCursor {
+			t.Errorf("Got %v, want %v", err, ErrInvalidCursor)
+		}
+	})
+
+	t.Run("video", func(t *testing.T) {
+		video, visits, err := s.Video("ccc")
+		if err != nil || video.Visits != 2 || len(visits) != 2 {
+			t.Errorf("Got %+v, %d visits, err %v", video, len(visits), err)
+		}
+		if _, _, err := s.Video("zzz"); err != ErrNotFound {
+			t.Errorf("Got %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("path", func(t *testing.T) {
+		path, err := s.Path("j2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(path) != 3 || path[0].ID != "aaa" || path[1].ID != "ccc" || path[2].ParentID != "ccc" {
+			t.Errorf("Got %+v", path)
+		}
+	})
+}
@@ -0,0 +1,416 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// videoColumns are sort keys mapped to expressions of videos query
+var videoColumns = map[string]string{
+	SortID:      "e.video_id",
+	SortTitle:   "max(coalesce(v.title, ''))",
+	SortChannel: "max(coalesce(v.channel, ''))",
+	SortVisits:  "count(*)",
+}
+
+// sqlReader implements Reader on top of normalized schema created by migrations, it's shared by all SQL stores
+type sqlReader struct {
+	db      *sql.DB
+	prefix  string
+	dialect string
+}
+
+// rebind replaces `?` placeholders with placeholders of the dialect
+func rebind(dialect, query string) string {
+	if dialect != DialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Videos returns page of videos stored in DB
+func (r sqlReader) Videos(q VideoQuery) (VideoPage, error) {
+	if err := q.normalize(); err != nil {
+		return VideoPage{}, err
+	}
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return VideoPage{}, err
+	}
+
+	p := r.prefix
+	query := "select e.video_id, max(coalesce(v.title, '')), max(coalesce(v.channel, '')), count(*), count(distinct nullif(e.job_id, '')), v.first_seen, v.last_seen" +
+		" from " + p + "edges e left join " + p + "videos v on v.id = e.video_id where e.video_id <> ''"
+	var args []interface{}
+	if q.JobID != "" {
+		query += " and e.job_id = ?"
+		args = append(args, q.JobID)
+	}
+	if q.Channel != "" {
+		query += " and v.channel = ?"
+		args = append(args, q.Channel)
+	}
+	if q.Title != "" {
+		query += " and lower(v.title) like ?"
+		if r.dialect == DialectSQLite {
+			// SQLite has no default escape character
+			query += ` escape '\'`
+		}
+		args = append(args, "%"+strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(q.Title))+"%")
+	}
+	// first and last seen are columns of single video row, they are grouped by so their type is kept
+	query += " group by e.video_id, v.first_seen, v.last_seen having count(*) >= ?"
+	args = append(args, q.MinVisits)
+
+	column, op, dir := videoColumns[q.Sort], ">", "asc"
+	if q.Desc {
+		op, dir = "<", "desc"
+	}
+	if after != nil {
+		var value interface{} = after.Value
+		if q.Sort == SortVisits {
+			if value, err = strconv.Atoi(after.Value); err != nil {
+				return VideoPage{}, ErrInvalidCursor
+			}
+		}
+		query += " and (" + column + " " + op + " ? or (" + column + " = ? and e.video_id " + op + " ?))"
+		args = append(args, value, value, after.ID)
+	}
+	query += " order by " + column + " " + dir + ", e.video_id " + dir + " limit ?"
+	args = append(args, q.Limit+1)
+
+	rows, err := r.db.Query(rebind(r.dialect, query), args...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	defer rows.Close()
+
+	page := VideoPage{Videos: []models.Video{}}
+	for rows.Next() {
+		var v models.Video
+		var firstSeen, lastSeen sql.NullTime
+		if err := rows.Scan(&v.ID, &v.Title, &v.Channel, &v.Visits, &v.Jobs, &firstSeen, &lastSeen); err != nil {
+			return VideoPage{}, err
+		}
+		v.FirstSeen, v.LastSeen = validTime(firstSeen), validTime(lastSeen)
+		page.Videos = append(page.Videos, v)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoPage{}, err
+	}
+	if len(page.Videos) > q.Limit {
+		page.Videos = page.Videos[:q.Limit]
+		page.NextCursor = encodeCursor(q.Sort, page.Videos[q.Limit-1])
+	}
+	return page, nil
+}
+
+// Video returns video stored in DB with all its visits
+func (r sqlReader) Video(id string) (models.Video, []models.NextLink, error) {
+	visits, err := r.links("e.video_id = ? order by e.id", id)
+	if err != nil {
+		return models.Video{}, nil, err
+	}
+	if len(visits) == 0 {
+		return models.Video{}, nil, ErrNotFound
+	}
+	page, err := queryVideos(visits, VideoQuery{})
+	if err != nil {
+		return models.Video{}, nil, err
+	}
+	video := page.Videos[0]
+
+	// title, channel and first and last seen are taken from canonical row of the video
+	var title, channel string
+	var firstSeen, lastSeen sql.NullTime
+	err = r.db.QueryRow(rebind(r.dialect, "select title, channel, first_seen, last_seen from "+r.prefix+"videos where id = ?"), id).Scan(&title, &channel, &firstSeen, &lastSeen)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return models.Video{}, nil, err
+	default:
+		video.Title, video.Channel = title, channel
+		video.FirstSeen, video.LastSeen = validTime(firstSeen), validTime(lastSeen)
+	}
+	return video, visits, nil
+}
+
+// validTime returns pointer to valid time, nil otherwise
+func validTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// Path returns links of job stored in DB
+func (r sqlReader) Path(jobID string) ([]models.NextLink, error) {
+	return r.links("e.job_id = ? order by e.number, e.id", jobID)
+}
+
+// ScanLinks calls fn for links stored in DB matching query, rows are read one by one
+func (r sqlReader) ScanLinks(q LinkQuery, fn func(link models.NextLink) error) error {
+	conditions, args := []string{"1 = 1"}, []interface{}{}
+	if q.JobID != "" {
+		conditions, args = append(conditions, "e.job_id = ?"), append(args, q.JobID)
+	}
+	if !q.From.IsZero() {
+		conditions, args = append(conditions, "e.visited_at >= ?"), append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		conditions, args = append(conditions, "e.visited_at < ?"), append(args, q.To.UTC())
+	}
+	order := " order by e.visited_at, e.id"
+	if q.JobID != "" {
+		order = " order by e.number, e.id"
+	}
+	return r.scanLinks(fn, strings.Join(conditions, " and ")+order, args...)
+}
+
+// links returns stored links matching condition
+func (r sqlReader) links(condition string, args ...interface{}) ([]models.NextLink, error) {
+	links := []models.NextLink{}
+	err := r.scanLinks(func(l models.NextLink) error {
+		links = append(links, l)
+		return nil
+	}, condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// scanLinks calls fn for every stored link matching condition
+func (r sqlReader) scanLinks(fn func(link models.NextLink) error, condition string, args ...interface{}) error {
+	p := r.prefix
+	rows, err := r.db.Query(rebind(r.dialect, "select coalesce(v.title, ''), coalesce(v.link, ''), e.video_id, e.job_id, coalesce(e.parent_id, ''), coalesce(v.channel, ''), e.number, e.visited_at"+
+		" from "+p+"edges e left join "+p+"videos v on v.id = e.video_id where "+condition), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.NextLink
+		var visitedAt sql.NullTime
+		if err := rows.Scan(&l.Title, &l.Link, &l.ID, &l.JobID, &l.ParentID, &l.Channel, &l.Number, &visitedAt); err != nil {
+			return err
+		}
+		l.VisitedAt = visitedAt.Time
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Videos returns page of videos stored in DB
+func (db *DbStore) Videos(q VideoQuery) (VideoPage, error) {
+	return db.reader().Videos(q)
+}
+
+// Video returns video stored in DB with all its visits
+func (db *DbStore) Video(id string) (models.Video, []models.NextLink, error) {
+	return db.reader().Video(id)
+}
+
+// Path returns links of job stored in DB
+func (db *DbStore) Path(jobID string) ([]models.NextLink, error) {
+	return db.reader().Path(jobID)
+}
+
+// ScanLinks calls fn for links stored in DB matching query
+func (db *DbStore) ScanLinks(q LinkQuery, fn func(link models.NextLink) error) error {
+	return db.reader().ScanLinks(q, fn)
+}
+
+func (db *DbStore) reader() sqlReader {
+	return sqlReader{db: db.DbPool, prefix: db.TablePrefix, dialect: DialectMySQL}
+}
+
+// sqlStore stores data to DB with normalized schema created by migrations, it's shared by PostgreSQL and SQLite stores
+// both support `on conflict` upserts, placeholders are rebound for the dialect
+type sqlStore struct {
+	db            *sql.DB
+	prefix        string
+	dialect       string
+	upsertVideo   *sql.Stmt
+	insertEdge    *sql.Stmt
+	upsertJob     *sql.Stmt
+	insertAttempt *sql.Stmt
+	log           *logrus.Logger
+}
+
+// videoConflict upserts canonical video row, all expressions read the old row,
+// title and channel are replaced by non-empty ones of visit that isn't older than the last one,
+// visit without time counts as the latest one
+const videoConflict = "on conflict (id) do update set link = excluded.link, " +
+	"title = case when excluded.title <> '' and (v.title = '' or " + latestVisit + ") then excluded.title else v.title end, " +
+	"channel = case when excluded.channel <> '' and (v.channel = '' or " + latestVisit + ") then excluded.channel else v.channel end, " +
+	"first_seen = case when v.first_seen is null or excluded.first_seen < v.first_seen then coalesce(excluded.first_seen, v.first_seen) else v.first_seen end, " +
+	"last_seen = case when v.last_seen is null or excluded.last_seen > v.last_seen then coalesce(excluded.last_seen, v.last_seen) else v.last_seen end, " +
+	"visits = v.visits + excluded.visits"
+
+// latestVisit is true if upserted visit isn't older than the last stored one
+const latestVisit = "excluded.last_seen is null or v.last_seen is null or excluded.last_seen >= v.last_seen"
+
+// newSQLStore applies migrations if migrate is true and prepares statements used for storing, applied migrations are printed to out
+func newSQLStore(db *sql.DB, dialect, prefix string, migrate bool, out io.Writer, log *logrus.Logger) (*sqlStore, error) {
+	if !validPrefix.MatchString(prefix) {
+		return nil, fmt.Errorf("invalid table prefix '%s', only letters, digits and underscore are allowed", prefix)
+	}
+	if migrate {
+		applied, err := Migrate(db, dialect, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range applied {
+			fmt.Fprintf(output(out), "Applied migration %04d_%s\n", m.Version, m.Name)
+			log.WithFields(logrus.Fields{
+				"version": m.Version,
+				"name":    m.Name,
+			}).Info("Applied migration")
+		}
+	}
+
+	s := &sqlStore{db: db, prefix: prefix, dialect: dialect, log: log}
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.upsertVideo, "insert into " + prefix + "videos as v (id, link, title, channel, first_seen, last_seen, visits) values (?, ?, ?, ?, ?, ?, 1) " + videoConflict},
+		{&s.insertEdge, "insert into " + prefix + "edges (job_id, number, parent_id, video_id, visited_at) values (?, ?, ?, ?, ?)"},
+		{&s.upsertJob, "insert into " + prefix + "jobs (id, seed, label, n_of_iterations, status, visited, error, created, started, ended) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) " +
+			"on conflict (id) do update set status = excluded.status, visited = excluded.visited, error = excluded.error, started = excluded.started, ended = excluded.ended"},
+		{&s.insertAttempt, "insert into " + prefix + "fetch_attempts (job_id, video_id, url, status_code, error, duration_ms, attempted_at) values (?, ?, ?, ?, ?, ?, ?)"},
+	}
+	for _, st := range statements {
+		stmt, err := db.Prepare(rebind(dialect, st.query))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"err": err.Error(),
+			}).Warn("Failed to prepare insert statement")
+			s.closeStatements()
+			return nil, err
+		}
+		*st.stmt = stmt
+	}
+	return s, nil
+}
+
+// Store upserts video and inserts its visit
+func (s *sqlStore) Store(link models.NextLink) error {
+	err := s.storeLinks([]models.NextLink{link})
+	if err != nil {
+		s.log.WithFields(logrus.Fields{
+			"err":            err.Error(),
+			"nextLinkID":     link.ID,
+			"nextLinkJobID":  link.JobID,
+			"nextLinkTitle":  link.Title,
+			"nextLinkLink":   link.Link,
+			"nextLinkNumber": link.Number,
+		}).Warn("Failed to insert data to DB")
+	}
+	return err
+}
+
+// Ping checks connection to DB
+func (s *sqlStore) Ping() error {
+	return s.db.Ping()
+}
+
+// storeLinks stores links in single transaction, so visit of video is never counted without its edge
+func (s *sqlStore) storeLinks(links []models.NextLink) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsertVideo, insertEdge := tx.Stmt(s.upsertVideo), tx.Stmt(s.insertEdge)
+	defer upsertVideo.Close()
+	defer insertEdge.Close()
+	for _, link := range links {
+		if err := s.store(upsertVideo, insertEdge, link); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) store(upsertVideo, insertEdge *sql.Stmt, link models.NextLink) error {
+	visited := nullTime(link.VisitedAt)
+	if _, err := upsertVideo.Exec(link.ID, link.Link, link.Title, link.Channel, visited, visited); err != nil {
+		return err
+	}
+	_, err := insertEdge.Exec(link.JobID, link.Number, nullString(link.ParentID), link.ID, visited)
+	return err
+}
+
+// StoreJob inserts job or updates its state if it's already stored
+func (s *sqlStore) StoreJob(job models.Job) error {
+	_, err := s.upsertJob.Exec(job.ID, job.Seed.Link, job.Seed.Label, job.Seed.NOfIterations, string(job.Status), job.Visited,
+		nullString(job.Error), job.Created, timePtr(job.Started), timePtr(job.Ended))
+	return err
+}
+
+// StoreAttempt inserts fetch attempt
+func (s *sqlStore) StoreAttempt(a models.FetchAttempt) error {
+	_, err := s.insertAttempt.Exec(a.JobID, a.VideoID, a.URL, a.StatusCode, nullString(a.Error), a.Duration.Milliseconds(), a.Time)
+	return err
+}
+
+// Close closes prepared statements and connection pool
+func (s *sqlStore) Close() {
+	s.closeStatements()
+	s.db.Close()
+}
+
+func (s *sqlStore) closeStatements() {
+	for _, stmt := range []*sql.Stmt{s.upsertVideo, s.insertEdge, s.upsertJob, s.insertAttempt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// Videos returns page of videos stored in DB
+func (s *sqlStore) Videos(q VideoQuery) (VideoPage, error) {
+	return s.reader().Videos(q)
+}
+
+// Video returns video stored in DB with all its visits
+func (s *sqlStore) Video(id string) (models.Video, []models.NextLink, error) {
+	return s.reader().Video(id)
+}
+
+// Path returns links of job stored in DB
+func (s *sqlStore) Path(jobID string) ([]models.NextLink, error) {
+	return s.reader().Path(jobID)
+}
+
+// ScanLinks calls fn for links stored in DB matching query
+func (s *sqlStore) ScanLinks(q LinkQuery, fn func(link models.NextLink) error) error {
+	return s.reader().ScanLinks(q, fn)
+}
+
+func (s *sqlStore) reader() sqlReader {
+	return sqlReader{db: s.db, prefix: s.prefix, dialect: s.dialect}
+}
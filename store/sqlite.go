@@ -0,0 +1,57 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore stores data to embedded SQLite DB file with the same schema as DbStore
+type SQLiteStore struct {
+	*sqlStore
+}
+
+// SQLiteDSN returns DSN of SQLite DB file at path, connections use WAL journal and wait for locks instead of failing
+// times are written in SQLite format `2006-01-02 15:04:05.999999999-07:00` so they sort as text
+func SQLiteDSN(path string) string {
+	params := url.Values{"_pragma": {"journal_mode(WAL)", "busy_timeout(5000)", "synchronous(NORMAL)"}, "_time_format": {"sqlite"}}
+	return "file:" + path + "?" + params.Encode()
+}
+
+// NewSQLiteStore opens SQLite DB file at SQLitePath, applies migrations if configured to and returns SQLiteStore storing data to it
+// the file is created if it doesn't exist
+func NewSQLiteStore(c config.StoreConfig, log *logrus.Logger) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", SQLiteDSN(c.SQLitePath))
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	path, _ := filepath.Abs(c.SQLitePath)
+	fmt.Fprintf(output(c.Out), "Opened SQLite DB at '%v'\n", path)
+	log.WithFields(logrus.Fields{
+		"method": "NewSQLiteStore",
+		"path":   path,
+	}).Debug("Opened SQLite DB")
+
+	s, err := newSQLStore(db, DialectSQLite, c.TablePrefix, c.AutoMigrate, c.Out, log)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{s}, nil
+}
+
+// StoreBatch stores links in single transaction
+func (sq *SQLiteStore) StoreBatch(links []models.NextLink) error {
+	return sq.storeLinks(links)
+}
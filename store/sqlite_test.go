@@ -0,0 +1,280 @@
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+func newTestSQLiteStore(t *testing.T, prefix string) *SQLiteStore {
+	t.Helper()
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	s, err := NewSQLiteStore(config.StoreConfig{SQLitePath: filepath.Join(t.TempDir(), "crawler.db"), TablePrefix: prefix, AutoMigrate: true}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSQLiteStore(t *testing.T) {
+	s := newTestSQLiteStore(t, "crawler_")
+	for _, link := range testRecords {
+		link.VisitedAt = time.Now()
+		if err := s.Store(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("migrations are applied once", func(t *testing.T) {
+		applied, err := Migrate(s.db, DialectSQLite, "crawler_")
+		if err != nil || len(applied) != 0 {
+			t.Errorf("Got %d applied migrations and err %v, want none", len(applied), err)
+		}
+		status, err := MigrationsStatus(s.db, DialectSQLite, "crawler_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range status {
+			if m.Applied == "" {
+				t.Errorf("Got pending migration %04d_%s", m.Version, m.Name)
+			}
+		}
+	})
+
+	t.Run("videos", func(t *testing.T) {
+		page, err := s.Videos(VideoQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIDs(t, []string{"aaa", "bbb", "ccc"}, page.Videos)
+		if a := page.Videos[0]; a.Visits != 3 || a.Jobs != 2 || a.Title != "Alpha" || a.Channel != "ch1" {
+			t.Errorf("Got %+v", a)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		page, _ := s.Videos(VideoQuery{JobID: "j2"})
+		assertIDs(t, []string{"aaa", "ccc"}, page.Videos)
+		page, _ = s.Videos(VideoQuery{Channel: "ch2"})
+		assertIDs(t, []string{"bbb"}, page.Videos)
+		page, _ = s.Videos(VideoQuery{Title: "GAM"})
+		assertIDs(t, []string{"ccc"}, page.Videos)
+		page, _ = s.Videos(VideoQuery{MinVisits: 2})
+		assertIDs(t, []string{"aaa", "ccc"}, page.Videos)
+	})
+
+	t.Run("sort and pagination", func(t *testing.T) {
+		page, err := s.Videos(VideoQuery{Sort: SortVisits, Desc: true, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIDs(t, []string{"aaa", "ccc"}, page.Videos)
+		page, err = s.Videos(VideoQuery{Sort: SortVisits, Desc: true, Limit: 2, Cursor: page.NextCursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIDs(t, []string{"bbb"}, page.Videos)
+		if page.NextCursor != "" {
+			t.Errorf("Got cursor %s for last page", page.NextCursor)
+		}
+
+		page, _ = s.Videos(VideoQuery{Sort: SortTitle, Limit: 1})
+		assertIDs(t, []string{"aaa"}, page.Videos)
+		page, _ = s.Videos(VideoQuery{Sort: SortTitle, Limit: 1, Cursor: page.NextCursor})
+		assertIDs(t, []string{"bbb"}, page.Videos)
+	})
+
+	t.Run("video and path", func(t *testing.T) {
+		video, visits, err := s.Video("ccc")
+		if err != nil || video.Visits != 2 || len(visits) != 2 || visits[0].VisitedAt.IsZero() {
+			t.Errorf("Got %+v, visits %+v, err %v", video, visits, err)
+		}
+		if _, _, err := s.Video("zzz"); err != ErrNotFound {
+			t.Errorf("Got %v, want %v", err, ErrNotFound)
+		}
+		path, err := s.Path("j2")
+		if err != nil || len(path) != 3 || path[2].ParentID != "ccc" {
+			t.Errorf("Got %+v, err %v", path, err)
+		}
+	})
+
+	t.Run("jobs and attempts", func(t *testing.T) {
+		now := time.Now()
+		job := models.Job{ID: "j1", Seed: models.Seed{Link: "/watch?v=aaa", NOfIterations: 2}, Status: models.JobRunning, Created: now, Started: &now}
+		if err := s.StoreJob(job); err != nil {
+			t.Fatal(err)
+		}
+		job.Status, job.Visited, job.Ended = models.JobCompleted, 3, &now
+		if err := s.StoreJob(job); err != nil {
+			t.Fatal(err)
+		}
+		var status string
+		var visited int
+		if err := s.db.QueryRow("select status, visited from crawler_jobs where id = 'j1'").Scan(&status, &visited); err != nil {
+			t.Fatal(err)
+		}
+		if status != string(models.JobCompleted) || visited != 3 {
+			t.Errorf("Got status %s with %d visited, want completed with 3", status, visited)
+		}
+
+		err := s.StoreAttempt(models.FetchAttempt{JobID: "j1", VideoID: "aaa", URL: "https://www.youtube.com/watch?v=aaa", StatusCode: 200, Duration: time.Second, Time: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("batch keeps known title", func(t *testing.T) {
+		batch := []models.NextLink{
+			{ID: "aaa", JobID: "j3", Link: "/watch?v=aaa"},
+			{ID: "ddd", JobID: "j3", ParentID: "aaa", Title: "Delta", Number: 1},
+		}
+		if err := s.StoreBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+		video, _, err := s.Video("aaa")
+		if err != nil || video.Title != "Alpha" || video.Visits != 4 {
+			t.Errorf("Got %+v, err %v", video, err)
+		}
+		path, _ := s.Path("j3")
+		if len(path) != 2 || path[1].Title != "Delta" {
+			t.Errorf("Got %+v", path)
+		}
+	})
+}
+
+func TestSQLiteStoreRollsBackFailedLink(t *testing.T) {
+	s := newTestSQLiteStore(t, "")
+	if err := s.Store(models.NextLink{ID: "aaa", JobID: "j1"}); err != nil {
+		t.Fatal(err)
+	}
+	// edge can't be inserted, so visit of the video must not be counted either
+	if _, err := s.db.Exec("drop table edges"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store(models.NextLink{ID: "aaa", JobID: "j1", Number: 1}); err == nil {
+		t.Fatal("Got no error storing link without edges table")
+	}
+	var visits int
+	if err := s.db.QueryRow("select visits from videos where id = 'aaa'").Scan(&visits); err != nil || visits != 1 {
+		t.Errorf("Got %d visits, err %v, want 1", visits, err)
+	}
+}
+
+func TestSQLiteScanLinks(t *testing.T) {
+	s := newTestSQLiteStore(t, "")
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	for i, link := range testRecords {
+		link.VisitedAt = start.Add(time.Duration(i) * time.Minute)
+		if err := s.Store(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []string
+	collect := func(l models.NextLink) error {
+		ids = append(ids, l.JobID+"/"+l.ID)
+		return nil
+	}
+	if err := ScanLinks(s, LinkQuery{From: start.Add(2 * time.Minute), To: start.Add(4*time.Minute + time.Second)}, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != "j1/ccc" || ids[2] != "j2/ccc" {
+		t.Errorf("Got %v, want 3 links visited from the third minute", ids)
+	}
+
+	ids = nil
+	if err := ScanLinks(s, LinkQuery{JobID: "j2", From: start.Add(4 * time.Minute).UTC()}, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "j2/ccc" || ids[1] != "j2/aaa" {
+		t.Errorf("Got %v, want the last two links of j2", ids)
+	}
+}
+
+func TestSQLiteVideoAggregates(t *testing.T) {
+	s := newTestSQLiteStore(t, "")
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	// the third visit is stored late, e.g. replayed from dead-letter file, so its title and channel don't replace known ones
+	for _, link := range []models.NextLink{
+		{ID: "aaa", JobID: "j1", Title: "Old", Channel: "ch1", VisitedAt: start},
+		{ID: "aaa", JobID: "j2", Title: "New", VisitedAt: start.Add(2 * time.Hour)},
+		{ID: "aaa", JobID: "j1", Title: "Older", Channel: "ch2", VisitedAt: start.Add(time.Hour)},
+	} {
+		if err := s.Store(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.StoreBatch([]models.NextLink{{ID: "aaa", JobID: "j3", Number: 1}, {ID: "aaa", JobID: "j3", Number: 2, VisitedAt: start.Add(-time.Hour)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var title, channel string
+	var visits int
+	var firstSeen, lastSeen time.Time
+	if err := s.db.QueryRow("select title, channel, visits, first_seen, last_seen from videos where id = 'aaa'").Scan(&title, &channel, &visits, &firstSeen, &lastSeen); err != nil {
+		t.Fatal(err)
+	}
+	if title != "New" || channel != "ch1" || visits != 5 || !firstSeen.Equal(start.Add(-time.Hour)) || !lastSeen.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("Got %s, %s, %d visits, first seen %s, last seen %s", title, channel, visits, firstSeen, lastSeen)
+	}
+
+	video, _, err := s.Video("aaa")
+	if err != nil || video.Title != "New" || video.Visits != 5 || video.FirstSeen == nil || !video.LastSeen.Equal(lastSeen) {
+		t.Errorf("Got %+v, err %v", video, err)
+	}
+	page, err := s.Videos(VideoQuery{})
+	if err != nil || len(page.Videos) != 1 || page.Videos[0].FirstSeen == nil || !page.Videos[0].FirstSeen.Equal(firstSeen) {
+		t.Errorf("Got %+v, err %v", page, err)
+	}
+}
+
+func TestSQLiteHistory(t *testing.T) {
+	s := newTestSQLiteStore(t, "crawler_")
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	count := func(n int64) *int64 { return &n }
+	for i, o := range []models.Observation{
+		{Title: "Mayday", Channel: "TheFatRat", Views: count(100), Likes: count(10)},
+		{Title: "Mayday", Channel: "TheFatRat", Views: count(150), Likes: count(10)},
+		{Title: "MAYDAY feat. Laura Brehm", Channel: "TheFatRat", Views: count(150)},
+		{Title: "MAYDAY feat. Laura Brehm", Channel: "TheFatRat", Views: count(200), Likes: count(12)},
+	} {
+		o.VideoID, o.JobID, o.ObservedAt = "aaa", "j1", start.Add(time.Duration(i)*time.Hour)
+		if err := s.StoreObservation(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.StoreObservation(models.Observation{VideoID: "bbb", Title: "Beta", ObservedAt: start})
+
+	history, err := s.History(HistoryQuery{VideoID: "aaa"})
+	if err != nil || len(history) != 4 {
+		t.Fatalf("Got %+v, err %v", history, err)
+	}
+	for i, want := range []string{"title,channel,views,likes", "views", "title", "views,likes"} {
+		if got := strings.Join(history[i].Changed, ","); got != want {
+			t.Errorf("Got changed %s of observation %d, want %s", got, i, want)
+		}
+	}
+	if h := history[2]; h.Likes != nil || *h.Views != 150 || !h.ObservedAt.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("Got %+v", h)
+	}
+
+	history, _ = s.History(HistoryQuery{VideoID: "aaa", Field: models.FieldTitle})
+	if len(history) != 2 || history[1].Title != "MAYDAY feat. Laura Brehm" {
+		t.Errorf("Got %+v, want 2 title changes", history)
+	}
+	history, _ = s.History(HistoryQuery{VideoID: "aaa", From: start.Add(time.Hour), To: start.Add(3 * time.Hour)})
+	if len(history) != 2 || *history[0].Views != 150 {
+		t.Errorf("Got %+v, want observations of the second and third hour", history)
+	}
+	if _, err := s.History(HistoryQuery{VideoID: "aaa", Field: "dislikes"}); err == nil {
+		t.Error("Got no error for unknown field")
+	}
+}
@@ -2,23 +2,36 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/sirupsen/logrus"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
 	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
 )
 
+// Defaults of batching in Manager
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+)
+
 // Manager manages data storing
 type Manager struct {
 	StorePipe        chan models.NextLink // chan to receive data to store from
 	StoreDestination Storer               // destination where to store data, DB or file
 	Shutdown         chan bool
+	BatchSize        int           // max number of links stored at once by BatchStorer, 1 or less stores links one by one
+	FlushInterval    time.Duration // max time link waits in batch before it's stored
+	DeadLetters      *DeadLetters  // links that fail to store are kept here, failure stops the application if it's nil
+	Out              io.Writer     // messages about failed links are printed here, os.Stdout if nil
 	log              *logrus.Logger
 }
 
@@ -27,15 +40,45 @@ type Storer interface {
 	Close()
 }
 
+// JobStorer is optional interface of Storer for destinations that store jobs too
+type JobStorer interface {
+	StoreJob(job models.Job) error
+}
+
+// BatchStorer is optional interface of Storer for destinations that can store many links at once in single transaction
+type BatchStorer interface {
+	StoreBatch(links []models.NextLink) error
+}
+
+// BatchError is returned by StoreBatch that stored the rest of batch already, only Links failed to store
+// Manager doesn't store such batch again link by link, failed links are handled as failures of single links
+type BatchError struct {
+	Links []models.NextLink
+	Errs  []error // error of link with the same index
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("failed to store %d links of batch, first error: %s", len(e.Links), e.Errs[0])
+}
+
+// AttemptStorer is optional interface of Storer for destinations that store fetch attempts too
+type AttemptStorer interface {
+	StoreAttempt(attempt models.FetchAttempt) error
+}
+
 // DbStore holds DB configuration
 type DbStore struct {
-	User               string
-	Pwd                string
-	DbURL              string
-	DbName             string
-	DbPool             *sql.DB
-	insertYoutubeLinks *sql.Stmt
-	log                *logrus.Logger
+	User          string
+	Pwd           string
+	DbURL         string
+	DbName        string
+	TablePrefix   string
+	DbPool        *sql.DB
+	upsertVideo   *sql.Stmt
+	insertEdge    *sql.Stmt
+	upsertJob     *sql.Stmt
+	insertAttempt *sql.Stmt
+	log           *logrus.Logger
 }
 
 type FileStore struct {
@@ -43,65 +86,154 @@ type FileStore struct {
 	log      *logrus.Logger
 }
 
-// New returns new *Manager
-func New(config config.StoreConfig, log *logrus.Logger) *Manager {
-	storeDestination, err := decideStoreTarget(config, log)
+// New returns new *Manager storing data to backend selected by config
+func New(config config.StoreConfig, log *logrus.Logger) (*Manager, error) {
+	storeDestination, err := Open(config, log)
 	if err != nil {
-		fmt.Printf("Failed to resolve store destination. Reason: %s", err)
-		panic(err)
-	} else {
-		return &Manager{
-			StorePipe:        make(chan models.NextLink, 500),
-			StoreDestination: storeDestination,
-			Shutdown:         make(chan bool, 1),
-			log:              log,
-		}
+		return nil, err
 	}
+	m := NewManager(storeDestination, log)
+	m.BatchSize, m.FlushInterval = config.BatchSize, config.FlushInterval
+	m.Out = config.Out
+	if config.DeadLetterPath != "" {
+		m.DeadLetters = NewDeadLetters(config.DeadLetterPath)
+	}
+	return m, nil
+}
 
+// NewManager returns new *Manager storing data to given destination
+func NewManager(storeDestination Storer, log *logrus.Logger) *Manager {
+	return &Manager{
+		StorePipe:        make(chan models.NextLink, 500),
+		StoreDestination: storeDestination,
+		Shutdown:         make(chan bool, 1),
+		BatchSize:        DefaultBatchSize,
+		FlushInterval:    DefaultFlushInterval,
+		log:              log,
+	}
 }
 
-// Decides target to store data to. If opening connection to DB fails, saves data to file links.dat
-func decideStoreTarget(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
-	db := DbStore{
-		User:   c.DbUser,
-		Pwd:    c.DbPwd,
-		DbURL:  "tcp(" + c.DbURL + ")",
-		DbName: c.DbName,
-		log:    log,
+// output returns w or os.Stdout if w is nil
+func output(w io.Writer) io.Writer {
+	if w == nil {
+		return os.Stdout
 	}
+	return w
+}
 
-	err := db.OpenConnection()
+// NewDbStore connects to MySQL DB, applies migrations if configured to and returns DbStore storing data to it
+func NewDbStore(c config.StoreConfig, log *logrus.Logger) (*DbStore, error) {
+	db := &DbStore{
+		User:        c.DbUser,
+		Pwd:         c.DbPwd,
+		DbURL:       "tcp(" + c.DbURL + ")",
+		DbName:      c.DbName,
+		TablePrefix: c.TablePrefix,
+		log:         log,
+	}
+	if !validPrefix.MatchString(db.TablePrefix) {
+		return nil, fmt.Errorf("invalid table prefix '%s', only letters, digits and underscore are allowed", db.TablePrefix)
+	}
 
-	if err == nil {
-		fmt.Println("Connected to DB")
-		log.WithFields(logrus.Fields{
-			"method": "decideStoreTarget",
-			"user":   db.User,
-			"DBURL":  db.DbURL,
-			"DBName": db.DbName,
-		}).Debug("Connected to DB!")
+	if err := db.OpenConnection(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(output(c.Out), "Connected to DB")
+	log.WithFields(logrus.Fields{
+		"method": "NewDbStore",
+		"user":   db.User,
+		"DBURL":  db.DbURL,
+		"DBName": db.DbName,
+	}).Debug("Connected to DB!")
 
-		db.insertYoutubeLinks, err = db.DbPool.Prepare("insert into testdb.links (id, title, link, link_id, number) values (0,?,?,?,?)")
+	if c.AutoMigrate {
+		applied, err := Migrate(db.DbPool, DialectMySQL, db.TablePrefix)
 		if err != nil {
-			fmt.Printf("Failed to prepare stmt %s", err)
+			db.DbPool.Close()
+			return nil, err
+		}
+		for _, m := range applied {
+			fmt.Fprintf(output(c.Out), "Applied migration %04d_%s\n", m.Version, m.Name)
 			log.WithFields(logrus.Fields{
-				"err": err.Error(),
-			}).Warn("Failed to prepare insert statement")
-
+				"version": m.Version,
+				"name":    m.Name,
+			}).Info("Applied migration")
 		}
-		return db, nil
-	} else {
-		fmt.Printf("Connection to DB failed, reason '%s'\n", err)
+	}
 
+	if err := db.prepare(); err != nil {
+		fmt.Fprintf(output(c.Out), "Failed to prepare stmt %s\n", err)
 		log.WithFields(logrus.Fields{
-			"method": "decideStoreTarget",
-			"DBUrl":  db.DbURL,
-			"DBName": db.DbName,
-			"err":    err.Error(),
-		}).Warn("Failed to connect to DB!")
+			"err": err.Error(),
+		}).Warn("Failed to prepare insert statement")
+		db.Close()
+		return nil, err
 	}
+	return db, nil
+}
 
-	file, err := os.Create(c.FilePath)
+// OpenDB opens connection to DB of configured Backend and returns it with its dialect
+func OpenDB(c config.StoreConfig) (*sql.DB, string, error) {
+	switch c.Backend {
+	case DialectSQLite:
+		db, err := sql.Open("sqlite", SQLiteDSN(c.SQLitePath))
+		if err != nil {
+			return nil, "", err
+		}
+		return db, DialectSQLite, nil
+	case DialectMySQL:
+		db := DbStore{User: c.DbUser, Pwd: c.DbPwd, DbURL: "tcp(" + c.DbURL + ")", DbName: c.DbName}
+		if err := db.OpenConnection(); err != nil {
+			return nil, "", err
+		}
+		return db.DbPool, DialectMySQL, nil
+	case DialectPostgres:
+		pool, err := sql.Open("postgres", PostgresDSN(c))
+		if err != nil {
+			return nil, "", err
+		}
+		if err = pool.Ping(); err != nil {
+			pool.Close()
+			return nil, "", err
+		}
+		return pool, DialectPostgres, nil
+	}
+	return nil, "", fmt.Errorf("store backend '%s' isn't SQL DB", c.Backend)
+}
+
+// prepare prepares statements used for storing
+func (db *DbStore) prepare() error {
+	p := db.TablePrefix
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		// MySQL assigns columns left to right and later expressions read new values, so last_seen is assigned last
+		{&db.upsertVideo, "insert into " + p + "videos (id, link, title, channel, first_seen, last_seen, visits) values (?,?,?,?,?,?,1) " +
+			"on duplicate key update link = values(link), " +
+			"title = if(values(title) <> '' and (title = '' or values(last_seen) is null or last_seen is null or values(last_seen) >= last_seen), values(title), title), " +
+			"channel = if(values(channel) <> '' and (channel = '' or values(last_seen) is null or last_seen is null or values(last_seen) >= last_seen), values(channel), channel), " +
+			"first_seen = if(first_seen is null or values(first_seen) < first_seen, coalesce(values(first_seen), first_seen), first_seen), " +
+			"visits = visits + values(visits), " +
+			"last_seen = if(last_seen is null or values(last_seen) > last_seen, coalesce(values(last_seen), last_seen), last_seen)"},
+		{&db.insertEdge, "insert into " + p + "edges (job_id, number, parent_id, video_id, visited_at) values (?,?,?,?,?)"},
+		{&db.upsertJob, "insert into " + p + "jobs (id, seed, label, n_of_iterations, status, visited, error, created, started, ended) values (?,?,?,?,?,?,?,?,?,?) " +
+			"on duplicate key update status = values(status), visited = values(visited), error = values(error), started = values(started), ended = values(ended)"},
+		{&db.insertAttempt, "insert into " + p + "fetch_attempts (job_id, video_id, url, status_code, error, duration_ms, attempted_at) values (?,?,?,?,?,?,?)"},
+	}
+	for _, s := range statements {
+		stmt, err := db.DbPool.Prepare(s.query)
+		if err != nil {
+			return err
+		}
+		*s.stmt = stmt
+	}
+	return nil
+}
+
+// NewFileStore creates file at filePath and returns FileStore storing data to it, path of the file is printed to out
+func NewFileStore(filePath string, out io.Writer, log *logrus.Logger) (Storer, error) {
+	file, err := os.Create(filePath)
 
 	if err != nil {
 		log.WithFields(logrus.Fields{
@@ -112,7 +244,7 @@ func decideStoreTarget(c config.StoreConfig, log *logrus.Logger) (Storer, error)
 	}
 
 	path, err := filepath.Abs(filepath.Dir(file.Name()))
-	fmt.Printf("Created file at '%v'\n", path)
+	fmt.Fprintf(output(out), "Created file at '%v'\n", path)
 	log.WithFields(logrus.Fields{
 		"path": path,
 	}).Trace("Created file at path")
@@ -123,7 +255,7 @@ func decideStoreTarget(c config.StoreConfig, log *logrus.Logger) (Storer, error)
 // OpenConnection opens connection to db
 func (db *DbStore) OpenConnection() error {
 	var err error
-	connectionString := db.User + ":" + db.Pwd + "@" + db.DbURL + "/" + db.DbName
+	connectionString := db.User + ":" + db.Pwd + "@" + db.DbURL + "/" + db.DbName + "?parseTime=true"
 	db.DbPool, err = sql.Open("mysql", connectionString)
 	if err != nil {
 		return err
@@ -136,69 +268,268 @@ func (db *DbStore) OpenConnection() error {
 }
 
 //Store stores data to DB
-func (db DbStore) Store(link models.NextLink) error {
-	_, err := db.insertYoutubeLinks.Exec(link.Title, link.Link, link.ID, link.Number)
-
+// video and its edge are stored in single transaction, so visit is never counted without its edge
+func (db *DbStore) Store(link models.NextLink) error {
+	err := db.StoreBatch([]models.NextLink{link})
 	if err != nil {
-		log.Printf("Insert failed: %s", err)
 		db.log.WithFields(logrus.Fields{
 			"err":            err.Error(),
 			"nextLinkID":     link.ID,
+			"nextLinkJobID":  link.JobID,
 			"nextLinkTitle":  link.Title,
 			"nextLinkLink":   link.Link,
 			"nextLinkNumber": link.Number,
 		}).Warn("Failed to insert data to DB")
 	}
-	return nil
+	return err
+}
+
+// Ping checks connection to DB
+func (db *DbStore) Ping() error {
+	return db.DbPool.Ping()
+}
+
+// StoreBatch stores links in single transaction
+func (db *DbStore) StoreBatch(links []models.NextLink) error {
+	tx, err := db.DbPool.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsertVideo, insertEdge := tx.Stmt(db.upsertVideo), tx.Stmt(db.insertEdge)
+	defer upsertVideo.Close()
+	defer insertEdge.Close()
+	for _, link := range links {
+		visited := nullTime(link.VisitedAt)
+		if _, err := upsertVideo.Exec(link.ID, link.Link, link.Title, link.Channel, visited, visited); err != nil {
+			return err
+		}
+		if _, err := insertEdge.Exec(link.JobID, link.Number, nullString(link.ParentID), link.ID, visited); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// StoreJob inserts job or updates its state if it's already stored
+func (db *DbStore) StoreJob(job models.Job) error {
+	_, err := db.upsertJob.Exec(job.ID, job.Seed.Link, job.Seed.Label, job.Seed.NOfIterations, string(job.Status), job.Visited,
+		nullString(job.Error), job.Created, timePtr(job.Started), timePtr(job.Ended))
+	return err
+}
+
+// StoreAttempt inserts fetch attempt
+func (db *DbStore) StoreAttempt(a models.FetchAttempt) error {
+	_, err := db.insertAttempt.Exec(a.JobID, a.VideoID, a.URL, a.StatusCode, nullString(a.Error), a.Duration.Milliseconds(), a.Time)
+	return err
 }
 
-func (db DbStore) Close() {
-	db.insertYoutubeLinks.Close()
+func (db *DbStore) Close() {
+	for _, stmt := range []*sql.Stmt{db.upsertVideo, db.insertEdge, db.upsertJob, db.insertAttempt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
 	db.DbPool.Close()
 
 }
 
+// nullString returns NULL for empty string
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullTime returns NULL for zero time, times are stored in UTC so they can be compared even as text in SQLite
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+func timePtr(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return nullTime(*t)
+}
+
 //Store store data to file
 func (f FileStore) Store(link models.NextLink) error {
-	s := "[ID: '" + link.ID + "', Link: '" + link.Link + "', Title: '" + link.Title + "', no.: '" + strconv.Itoa(link.Number) + "']\n"
-	_, err := f.destFile.Write([]byte(s))
+	_, err := f.destFile.Write([]byte(textLine(link)))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// textLine formats link as single line of text
+func textLine(link models.NextLink) string {
+	return "[ID: '" + link.ID + "', Job: '" + link.JobID + "', Parent: '" + link.ParentID + "', Link: '" + link.Link + "', Title: '" + link.Title + "', Channel: '" + link.Channel + "', no.: '" + strconv.Itoa(link.Number) + "']\n"
+}
+
+// StoreAttempt stores fetch attempt if destination can store attempts
+func (m *Manager) StoreAttempt(attempt models.FetchAttempt) {
+	s, ok := m.StoreDestination.(AttemptStorer)
+	if !ok {
+		return
+	}
+	if err := s.StoreAttempt(attempt); err != nil {
+		m.log.WithFields(logrus.Fields{
+			"err":     err.Error(),
+			"jobID":   attempt.JobID,
+			"videoID": attempt.VideoID,
+		}).Warn("Failed to store fetch attempt")
+	}
+}
+
+// TrackJobs stores state of jobs on every job event published on bus if destination can store jobs
+// returned subscription should be closed once tracking isn't needed, it's nil if destination can't store jobs
+func (m *Manager) TrackJobs(bus *events.Bus) *events.Subscription {
+	s, ok := m.StoreDestination.(JobStorer)
+	if !ok {
+		return nil
+	}
+	sub := bus.SubscribeUnbounded(events.JobLifecycle...)
+	go func() {
+		for e := range sub.C {
+			if e.Job == nil {
+				continue
+			}
+			if err := s.StoreJob(*e.Job); err != nil {
+				m.log.WithFields(logrus.Fields{
+					"err":    err.Error(),
+					"jobID":  e.Job.ID,
+					"status": e.Job.Status,
+				}).Warn("Failed to store job")
+			}
+		}
+	}()
+	return sub
+}
+
 // StoreData stores data to configured destination
+// destinations implementing BatchStorer get links in batches of BatchSize, batch is stored at least every FlushInterval.
+// StorePipe isn't read while batch is being stored, so once it's full crawling threads block until the store catches up
 func (m *Manager) StoreData() {
+	batcher, ok := m.StoreDestination.(BatchStorer)
+	if !ok || m.BatchSize <= 1 {
+		m.storeEach()
+	} else {
+		m.storeBatches(batcher)
+	}
+
+	fmt.Fprintln(output(m.Out), "Store channel closed, shutting down")
+	m.log.Info("storePipe chan closed, shutting down")
+	m.StoreDestination.Close()
+	m.Shutdown <- true
+	close(m.Shutdown)
+}
+
+// storeEach stores links one by one until StorePipe is closed
+func (m *Manager) storeEach() {
+	for data := range m.StorePipe {
+		m.store(data)
+	}
+}
+
+// store stores single link, link that fails to store is written to dead-letter file,
+// failure to store it without dead-letter file stops the application
+func (m *Manager) store(data models.NextLink) {
+	if err := m.StoreDestination.Store(data); err != nil {
+		m.storeFailed(data, err)
+	}
+}
+
+// storeFailed writes link that failed to store to dead-letter file, it stops the application without dead-letter file
+func (m *Manager) storeFailed(data models.NextLink, err error) {
+	if m.DeadLetters != nil {
+		dlErr := m.DeadLetters.Add(data, err)
+		if dlErr == nil {
+			fmt.Fprintf(output(m.Out), "Failed to store data [ID: %v], iteration %v, written to dead-letter file, reason: %s\n", data.ID, data.Number, err)
+			m.log.WithFields(logrus.Fields{
+				"err":            err.Error(),
+				"nextLinkID":     data.ID,
+				"nextLinkJobID":  data.JobID,
+				"nextLinkNumber": data.Number,
+				"deadLetters":    m.DeadLetters.Path(),
+			}).Warn("Failed to store data, written to dead-letter file")
+			return
+		}
+		err = fmt.Errorf("%s, failed to write it to dead-letter file: %s", err, dlErr)
+	}
+	fmt.Fprintf(output(m.Out), "Failed to store data [ID: %v], iteration %v, reason: %s\n", data.ID, data.Number, err)
+	m.log.WithFields(logrus.Fields{
+		"err":            err.Error(),
+		"nextLinkID":     data.ID,
+		"nextLinkTitle":  data.Title,
+		"nextLinkLink":   data.Link,
+		"nextLinkNumber": data.Number,
+	}).Fatal("Failed to store data")
+}
+
+// storeBatches collects links to batches and stores them until StorePipe is closed
+func (m *Manager) storeBatches(batcher BatchStorer) {
+	interval := m.FlushInterval
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]models.NextLink, 0, m.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if len(m.StorePipe) == cap(m.StorePipe) {
+			m.log.WithFields(logrus.Fields{
+				"pending": len(m.StorePipe),
+				"batch":   len(batch),
+			}).Warn("Store falls behind, crawling waits for batch to be stored")
+		}
+		m.storeBatch(batcher, batch)
+		batch = batch[:0]
+	}
 
 	for {
 		select {
 		case data, ok := <-m.StorePipe:
 			if !ok {
-				fmt.Println("Store channel closed, shutting down")
-				m.log.Info("storePipe chan closed, shutting down")
-				m.StoreDestination.Close()
-				m.Shutdown <- true
-				close(m.Shutdown)
+				flush()
 				return
 			}
-			err := m.StoreDestination.Store(data)
-			if err != nil {
-				fmt.Printf("Failed to store data [ID: %v], iteration %v, reason: %s", data.ID, data.Number, err)
-				m.log.WithFields(logrus.Fields{
-					"err":            err.Error(),
-					"nextLinkID":     data.ID,
-					"nextLinkTitle":  data.Title,
-					"nextLinkLink":   data.Link,
-					"nextLinkNumber": data.Number,
-				}).Fatal("Failed to store data")
+			batch = append(batch, data)
+			if len(batch) >= m.BatchSize {
+				flush()
+				ticker.Reset(interval)
 			}
-		default:
-
+		case <-ticker.C:
+			flush()
 		}
+	}
+}
 
+// storeBatch stores batch in single transaction, if it fails links are stored one by one so only failing links are lost
+// links of BatchError aren't stored again, the rest of batch was stored already
+func (m *Manager) storeBatch(batcher BatchStorer, batch []models.NextLink) {
+	err := batcher.StoreBatch(batch)
+	if err == nil {
+		return
+	}
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		for i, data := range batchErr.Links {
+			m.storeFailed(data, batchErr.Errs[i])
+		}
+		return
+	}
+	fmt.Fprintf(output(m.Out), "Failed to store batch of %d links, storing them one by one, reason: %s\n", len(batch), err)
+	m.log.WithFields(logrus.Fields{
+		"err":   err.Error(),
+		"links": len(batch),
+	}).Warn("Failed to store batch")
+	for _, data := range batch {
+		m.store(data)
 	}
-	fmt.Println("Storing data finished")
 }
 
 func (f FileStore) Close() {
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/config"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/webhooks"
+)
+
+// BackendWebhook posts stored links to HTTP endpoint
+const BackendWebhook = "webhook"
+
+// webhookTimeout is timeout of single POST request
+const webhookTimeout = 10 * time.Second
+
+// WebhookStore posts every link as JSON object to URL, batch is posted as JSON array
+// body is signed the same way as job event webhooks if secret is set, non 2xx response is error
+type WebhookStore struct {
+	url    string
+	secret string
+	client *http.Client
+	log    *logrus.Logger
+}
+
+// NewWebhookStore returns WebhookStore posting to URL
+func NewWebhookStore(rawURL, secret string, log *logrus.Logger) (*WebhookStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL '%s'", rawURL)
+	}
+	return &WebhookStore{
+		url:    rawURL,
+		secret: secret,
+		client: &http.Client{Timeout: webhookTimeout},
+		log:    log,
+	}, nil
+}
+
+// Store posts link
+func (s *WebhookStore) Store(link models.NextLink) error {
+	return s.post(link)
+}
+
+// StoreBatch posts links in single request
+func (s *WebhookStore) StoreBatch(links []models.NextLink) error {
+	return s.post(links)
+}
+
+func (s *WebhookStore) post(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != "" {
+		req.Header.Set(webhooks.SignatureHeader, webhooks.Sign(s.secret, body))
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", res.Status)
+	}
+	return nil
+}
+
+// Close releases idle connections
+func (s *WebhookStore) Close() {
+	s.client.CloseIdleConnections()
+}
+
+func init() {
+	Register(BackendWebhook, func(c config.StoreConfig, log *logrus.Logger) (Storer, error) {
+		return NewWebhookStore(c.WebhookURL, c.WebhookSecret, log)
+	})
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// Formats supported by WriterStore
+const (
+	FormatText  = "text"  // same lines as FileStore writes
+	FormatJSONL = "jsonl" // one JSON object per line
+)
+
+// WriterStore writes data to io.Writer, e.g. stdout, in text or JSON Lines format
+type WriterStore struct {
+	w       io.Writer
+	format  string
+	encoder *json.Encoder
+}
+
+// NewWriterStore returns WriterStore writing to w in given format
+// if w is io.Closer it's closed by WriterStore.Close
+func NewWriterStore(w io.Writer, format string) (*WriterStore, error) {
+	switch format {
+	case FormatText, FormatJSONL:
+	default:
+		return nil, fmt.Errorf("unsupported output format '%s'", format)
+	}
+	return &WriterStore{w: w, format: format, encoder: json.NewEncoder(w)}, nil
+}
+
+// Store writes link to the writer
+func (ws *WriterStore) Store(link models.NextLink) error {
+	if ws.format == FormatJSONL {
+		return ws.encoder.Encode(link)
+	}
+	_, err := io.WriteString(ws.w, textLine(link))
+	return err
+}
+
+// Close closes underlying writer if it can be closed
+func (ws *WriterStore) Close() {
+	if closer, ok := ws.w.(io.Closer); ok {
+		closer.Close()
+	}
+}
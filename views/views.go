@@ -0,0 +1,8 @@
+package views
+
+import "embed"
+
+// FS holds page templates embedded in the binary
+//
+//go:embed *.gohtml
+var FS embed.FS
@@ -0,0 +1,357 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+// Headers sent with every delivery
+const (
+	SignatureHeader = "X-Crawler-Signature" // `sha256=` followed by hex encoded HMAC-SHA256 of the body keyed by webhook secret
+	EventHeader     = "X-Crawler-Event"
+	DeliveryHeader  = "X-Crawler-Delivery"
+)
+
+// Delivery statuses
+const (
+	Pending   = "pending"
+	Delivered = "delivered"
+	Failed    = "failed"
+)
+
+// maxLogSize is number of deliveries kept in delivery log
+const maxLogSize = 1000
+
+// maxDeliveries is number of deliveries sent at once, next deliveries wait for them to finish
+const maxDeliveries = 16
+
+// DefaultEvents are events webhook is fired on when it doesn't set its own filter
+var DefaultEvents = []events.Type{events.JobStarted, events.JobCompleted, events.JobFailed}
+
+// Webhook is single configured receiver of job events
+type Webhook struct {
+	URL    string        `json:"url"`
+	Secret string        `json:"secret,omitempty"`
+	Events []events.Type `json:"events,omitempty"` // events to fire on, DefaultEvents if empty
+}
+
+// Payload is JSON body sent to webhook
+type Payload struct {
+	DeliveryID string      `json:"delivery_id"`
+	Event      events.Type `json:"event"`
+	Time       time.Time   `json:"time"`
+	Job        models.Job  `json:"job"`
+	Stats      Stats       `json:"stats"`
+}
+
+// Stats summarizes job at the time of event
+type Stats struct {
+	Visited         int     `json:"visited"`
+	Iterations      int     `json:"iterations"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// Delivery is record of sending single event to single webhook
+type Delivery struct {
+	ID           string      `json:"id"`
+	URL          string      `json:"url"`
+	Event        events.Type `json:"event"`
+	JobID        string      `json:"job_id"`
+	Status       string      `json:"status"`
+	Attempts     int         `json:"attempts"`
+	ResponseCode int         `json:"response_code,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	Created      time.Time   `json:"created"`
+	Updated      time.Time   `json:"updated"`
+}
+
+// Notifier fires webhooks on crawler events and keeps log of deliveries
+type Notifier struct {
+	webhooks    []Webhook
+	maxAttempts int
+	backoff     time.Duration // wait before second attempt, doubled for every next one
+	client      *http.Client
+	log         *logrus.Logger
+
+	mu         sync.Mutex
+	deliveries []*Delivery // delivery log, oldest first
+	wg         sync.WaitGroup
+	sending    chan struct{} // semaphore of deliveries in progress
+}
+
+// New returns *Notifier firing given webhooks, each delivery is attempted at most maxAttempts times
+func New(webhooks []Webhook, maxAttempts int, log *logrus.Logger) *Notifier {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	for i := range webhooks {
+		if len(webhooks[i].Events) == 0 {
+			webhooks[i].Events = DefaultEvents
+		}
+	}
+	return &Notifier{
+		webhooks:    webhooks,
+		maxAttempts: maxAttempts,
+		backoff:     time.Second,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		log:         log,
+		sending:     make(chan struct{}, maxDeliveries),
+	}
+}
+
+// Load reads list of webhooks from JSON file
+func Load(path string) ([]Webhook, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var webhooks []Webhook
+	if err = json.NewDecoder(file).Decode(&webhooks); err != nil {
+		return nil, fmt.Errorf("invalid webhooks file '%s': %s", path, err)
+	}
+	for _, w := range webhooks {
+		if w.URL == "" {
+			return nil, fmt.Errorf("invalid webhooks file '%s': webhook without url", path)
+		}
+		for _, e := range w.Events {
+			if !isJobEvent(e) {
+				return nil, fmt.Errorf("invalid webhooks file '%s': webhook %s fires on '%s' that isn't job event", path, w.URL, e)
+			}
+		}
+	}
+	return webhooks, nil
+}
+
+// Run fires webhooks for events received from bus until subscription is closed
+// subscription gets only job events webhooks fire on and it doesn't drop any of them
+func (n *Notifier) Run(bus *events.Bus) *events.Subscription {
+	types := n.eventTypes()
+	if len(types) == 0 {
+		// subscription without types would get all events
+		types = DefaultEvents
+	}
+	s := bus.SubscribeUnbounded(types...)
+	go func() {
+		for e := range s.C {
+			n.Notify(e)
+		}
+		n.wg.Wait()
+	}()
+	return s
+}
+
+// eventTypes returns job events any webhook fires on
+func (n *Notifier) eventTypes() []events.Type {
+	var types []events.Type
+	for _, t := range events.JobLifecycle {
+		for _, w := range n.webhooks {
+			if w.wants(t) {
+				types = append(types, t)
+				break
+			}
+		}
+	}
+	return types
+}
+
+// Notify sends event to all webhooks interested in it, deliveries are done in background
+// at most maxDeliveries are sent at once, Notify blocks until delivery can start
+func (n *Notifier) Notify(e events.Event) {
+	if e.Job == nil {
+		return
+	}
+	for _, w := range n.webhooks {
+		if !w.wants(e.Type) {
+			continue
+		}
+
+		payload := Payload{
+			DeliveryID: models.NewJobID(),
+			Event:      e.Type,
+			Time:       e.Time,
+			Job:        *e.Job,
+			Stats:      stats(*e.Job, e.Time),
+		}
+		d := &Delivery{
+			ID:      payload.DeliveryID,
+			URL:     w.URL,
+			Event:   e.Type,
+			JobID:   e.JobID,
+			Status:  Pending,
+			Created: time.Now(),
+			Updated: time.Now(),
+		}
+		n.record(d)
+
+		n.wg.Add(1)
+		n.sending <- struct{}{}
+		go n.deliver(w, d, payload)
+	}
+}
+
+// Webhooks returns configured webhooks without secrets
+func (n *Notifier) Webhooks() []Webhook {
+	webhooks := make([]Webhook, len(n.webhooks))
+	for i, w := range n.webhooks {
+		webhooks[i] = Webhook{URL: w.URL, Events: w.Events}
+	}
+	return webhooks
+}
+
+// Deliveries returns deliveries from log, newest first, filtered by job ID and status if they are not empty
+func (n *Notifier) Deliveries(jobID, status string) []Delivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	deliveries := make([]Delivery, 0)
+	for i := len(n.deliveries) - 1; i >= 0; i-- {
+		d := n.deliveries[i]
+		if (jobID == "" || d.JobID == jobID) && (status == "" || d.Status == status) {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	return deliveries
+}
+
+// Wait blocks until all deliveries in progress are done
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+// deliver sends payload to webhook, retries with exponential backoff until it succeeds or runs out of attempts
+func (n *Notifier) deliver(w Webhook, d *Delivery, payload Payload) {
+	defer n.wg.Done()
+	defer func() { <-n.sending }()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		n.update(d, Failed, 0, err)
+		return
+	}
+
+	wait := n.backoff
+	for attempt := 1; attempt <= n.maxAttempts; attempt++ {
+		code, err := n.post(w, d, body)
+		if err == nil {
+			n.update(d, Delivered, code, nil)
+			return
+		}
+
+		status := Pending
+		if attempt == n.maxAttempts {
+			status = Failed
+		}
+		n.update(d, status, code, err)
+		n.log.WithFields(logrus.Fields{
+			"deliveryID": d.ID,
+			"url":        w.URL,
+			"attempt":    attempt,
+			"err":        err.Error(),
+		}).Warn("Webhook delivery failed")
+
+		if status == Pending {
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+}
+
+// post sends single delivery attempt, non 2xx response is returned as error
+func (n *Notifier) post(w Webhook, d *Delivery, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(d.Event))
+	req.Header.Set(DeliveryHeader, d.ID)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("webhook responded %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// record adds delivery to log, dropping the oldest one if log is full
+func (n *Notifier) record(d *Delivery) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.deliveries) >= maxLogSize {
+		n.deliveries = n.deliveries[1:]
+	}
+	n.deliveries = append(n.deliveries, d)
+}
+
+func (n *Notifier) update(d *Delivery, status string, code int, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	d.Status = status
+	d.Attempts++
+	d.ResponseCode = code
+	d.Error = ""
+	if err != nil {
+		d.Error = err.Error()
+	}
+	d.Updated = time.Now()
+}
+
+// Sign returns value of SignatureHeader for body signed by secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func isJobEvent(t events.Type) bool {
+	for _, e := range events.JobLifecycle {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Webhook) wants(t events.Type) bool {
+	for _, e := range w.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+func stats(job models.Job, at time.Time) Stats {
+	s := Stats{Visited: job.Visited, Iterations: job.Seed.NOfIterations}
+	if job.Started != nil {
+		end := at
+		if job.Ended != nil {
+			end = *job.Ended
+		}
+		s.DurationSeconds = end.Sub(*job.Started).Seconds()
+	}
+	return s
+}
@@ -0,0 +1,149 @@
+package webhooks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/events"
+	"github.com/vildapavlicek/GoLang/youtubeCrawler/models"
+)
+
+func TestNotify(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	started := time.Now().Add(-time.Minute)
+	job := models.Job{ID: "job", Status: models.JobCompleted, Visited: 10, Started: &started}
+
+	t.Run("Signed delivery after retry", func(t *testing.T) {
+		calls := int32(0)
+		validSignature := int32(0)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if r.Header.Get(SignatureHeader) == Sign("secret", body) && r.Header.Get(EventHeader) == string(events.JobCompleted) {
+				atomic.AddInt32(&validSignature, 1)
+			}
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		n := New([]Webhook{{URL: server.URL, Secret: "secret"}}, 3, log)
+		n.backoff = time.Millisecond
+		n.Notify(events.Event{Type: events.JobCompleted, JobID: job.ID, Job: &job})
+		n.Wait()
+
+		assertCountEquals(t, 2, int(atomic.LoadInt32(&calls)))
+		assertCountEquals(t, 2, int(atomic.LoadInt32(&validSignature)))
+		deliveries := n.Deliveries(job.ID, Delivered)
+		if len(deliveries) != 1 || deliveries[0].Attempts != 2 {
+			t.Errorf("Got deliveries %+v, want one delivered after 2 attempts", deliveries)
+		}
+	})
+
+	t.Run("Failed after all attempts", func(t *testing.T) {
+		server := makeHTTPServer(http.StatusInternalServerError)
+		defer server.Close()
+
+		n := New([]Webhook{{URL: server.URL}}, 2, log)
+		n.backoff = time.Millisecond
+		n.Notify(events.Event{Type: events.JobCompleted, JobID: job.ID, Job: &job})
+		n.Wait()
+
+		deliveries := n.Deliveries("", Failed)
+		if len(deliveries) != 1 || deliveries[0].Attempts != 2 || deliveries[0].ResponseCode != http.StatusInternalServerError {
+			t.Errorf("Got deliveries %+v, want one failed after 2 attempts", deliveries)
+		}
+	})
+
+	t.Run("Event filter", func(t *testing.T) {
+		server := makeHTTPServer(http.StatusOK)
+		defer server.Close()
+
+		n := New([]Webhook{{URL: server.URL}, {URL: server.URL, Events: []events.Type{events.JobCancelled}}}, 1, log)
+		n.Notify(events.Event{Type: events.JobCancelled, JobID: job.ID, Job: &job})
+		n.Notify(events.Event{Type: events.VideoVisited, JobID: job.ID})
+		n.Wait()
+
+		assertCountEquals(t, 1, len(n.Deliveries("", "")))
+	})
+
+	t.Run("Run delivers every job event despite visits", func(t *testing.T) {
+		server := makeHTTPServer(http.StatusOK)
+		defer server.Close()
+
+		bus := events.NewBus()
+		n := New([]Webhook{{URL: server.URL, Events: []events.Type{events.JobCompleted}}}, 1, log)
+		s := n.Run(bus)
+		for i := 0; i < 2000; i++ {
+			bus.Publish(events.Event{Type: events.VideoVisited, JobID: job.ID})
+		}
+		for i := 0; i < 100; i++ {
+			bus.Publish(events.Event{Type: events.JobCompleted, JobID: job.ID, Job: &job})
+		}
+		for start := time.Now(); len(n.Deliveries("", Delivered)) < 100 && time.Since(start) < 5*time.Second; {
+			time.Sleep(10 * time.Millisecond)
+		}
+		s.Close()
+		n.Wait()
+
+		assertCountEquals(t, 100, len(n.Deliveries("", Delivered)))
+		assertCountEquals(t, 0, int(s.Dropped()))
+	})
+
+	t.Run("Limited number of deliveries at once", func(t *testing.T) {
+		inProgress, most := int32(0), int32(0)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := atomic.AddInt32(&inProgress, 1)
+			for {
+				m := atomic.LoadInt32(&most)
+				if now <= m || atomic.CompareAndSwapInt32(&most, m, now) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inProgress, -1)
+		}))
+		defer server.Close()
+
+		n := New([]Webhook{{URL: server.URL}}, 1, log)
+		for i := 0; i < 5*maxDeliveries; i++ {
+			n.Notify(events.Event{Type: events.JobCompleted, JobID: job.ID, Job: &job})
+		}
+		n.Wait()
+
+		assertCountEquals(t, 5*maxDeliveries, len(n.Deliveries("", Delivered)))
+		if m := atomic.LoadInt32(&most); m > maxDeliveries {
+			t.Errorf("Got %d deliveries at once, want at most %d", m, maxDeliveries)
+		}
+	})
+}
+
+func TestLoadRejectsNonJobEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	if err := ioutil.WriteFile(path, []byte(`[{"url": "http://localhost/hook", "events": ["video.visited"]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Got no error for webhook firing on video.visited")
+	}
+}
+
+func makeHTTPServer(status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+}
+
+func assertCountEquals(t *testing.T, want, got int) {
+	t.Helper()
+	if want != got {
+		t.Errorf("Got '%v', want: '%v'", got, want)
+	}
+}